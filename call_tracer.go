@@ -0,0 +1,242 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+)
+
+// revertSelector is the selector of the Error(string) revert data emitted by
+// Solidity for require and revert with a reason.
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// callErrors are the messages of the callTracer for the known execution
+// errors, other errors are reported with their own message.
+var callErrors = map[error]string{
+	errExecutionReverted:        "execution reverted",
+	ErrOutOfGas:                 "out of gas",
+	ErrCodeStoreOutOfGas:        "contract creation code storage out of gas",
+	ErrDepth:                    "max call depth exceeded",
+	ErrInsufficientBalance:      "insufficient balance for transfer",
+	ErrContractAddressCollision: "contract address collision",
+	errWriteProtection:          "write protection",
+	errReturnDataOutOfBounds:    "return data out of bounds",
+	errMaxCodeSizeExceeded:      "max code size exceeded",
+	errInvalidJump:              "invalid jump destination",
+	errInvalidCode:              "invalid code: must not begin with 0xef",
+	errGasUintOverflow:          "gas uint64 overflow",
+}
+
+// callError returns the callTracer message of an execution error.
+func callError(err error) string {
+	if msg, ok := callErrors[err]; ok {
+		return msg
+	}
+	return err.Error()
+}
+
+// CallFrame is a message call recorded by the CallTracer.
+type CallFrame struct {
+	Type         CallType
+	From         types.Address
+	To           types.Address
+	Value        *big.Int // nil for delegate and static calls
+	Gas          uint64
+	GasUsed      uint64
+	Input        []byte
+	Output       []byte
+	Error        string
+	RevertReason string
+	Calls        []*CallFrame
+}
+
+// callFrameJSON is the JSON encoding of a call frame, compatible with the
+// output of the common callTracer.
+type callFrameJSON struct {
+	Type         string         `json:"type"`
+	From         hexutil.Bytes  `json:"from"`
+	To           hexutil.Bytes  `json:"to"`
+	Value        *hexutil.Big   `json:"value,omitempty"`
+	Gas          hexutil.Uint64 `json:"gas"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Input        hexutil.Bytes  `json:"input"`
+	Output       hexutil.Bytes  `json:"output,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	Calls        []*CallFrame   `json:"calls,omitempty"`
+}
+
+// MarshalJSON encodes the frame and its nested calls in the callTracer format.
+func (f *CallFrame) MarshalJSON() ([]byte, error) {
+	enc := callFrameJSON{
+		Type:         f.Type.String(),
+		From:         f.From[:],
+		To:           f.To[:],
+		Value:        (*hexutil.Big)(f.Value),
+		Gas:          hexutil.Uint64(f.Gas),
+		GasUsed:      hexutil.Uint64(f.GasUsed),
+		Input:        f.Input,
+		Output:       f.Output,
+		Error:        f.Error,
+		RevertReason: f.RevertReason,
+		Calls:        f.Calls,
+	}
+	if enc.Input == nil {
+		enc.Input = []byte{}
+	}
+	return json.Marshal(&enc)
+}
+
+// finish records the outcome of the call.
+func (f *CallFrame) finish(output []byte, gasUsed uint64, err error) {
+	f.GasUsed = gasUsed
+	f.Output = common.CopyBytes(output)
+	if err != nil {
+		f.Error = callError(err)
+		if err == errExecutionReverted {
+			f.RevertReason, _ = unpackRevertReason(output)
+		}
+	}
+}
+
+// CallTracerConfig are the configuration options for the CallTracer.
+type CallTracerConfig struct {
+	OnlyTopCall bool // don't record nested calls
+}
+
+// CallTracer is a Tracer recording one frame per message call, including
+// calls to system contracts, as a tree of nested calls. Unlike the
+// StructLogger it doesn't look at the individual instructions.
+type CallTracer struct {
+	cfg   CallTracerConfig
+	root  *CallFrame
+	stack []*CallFrame // open call frames, the top level one first
+}
+
+// NewCallTracer returns a new call tracer.
+func NewCallTracer(cfg *CallTracerConfig) *CallTracer {
+	tracer := &CallTracer{}
+	if cfg != nil {
+		tracer.cfg = *cfg
+	}
+	return tracer
+}
+
+// CaptureTxStart implements the Tracer interface.
+func (t *CallTracer) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (t *CallTracer) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureStart implements the Tracer interface to record the top level call.
+func (t *CallTracer) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CallTypeCall
+	if create {
+		typ = CallTypeCreate
+	}
+	t.root = &CallFrame{
+		Type:  typ,
+		From:  from,
+		To:    to,
+		Gas:   gas,
+		Input: common.CopyBytes(input),
+	}
+	if value != nil {
+		t.root.Value = new(big.Int).Set(value)
+	}
+	t.stack = []*CallFrame{t.root}
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface to open a nested call frame.
+func (t *CallTracer) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	if t.cfg.OnlyTopCall || len(t.stack) == 0 {
+		return nil
+	}
+	frame := &CallFrame{
+		Type:  typ,
+		From:  from,
+		To:    to,
+		Gas:   gas,
+		Input: common.CopyBytes(input),
+	}
+	if value != nil {
+		frame.Value = new(big.Int).Set(value)
+	}
+	t.stack = append(t.stack, frame)
+	return nil
+}
+
+// CaptureExit implements the Tracer interface to close a nested call frame
+// and attach it to its parent.
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if t.cfg.OnlyTopCall || len(t.stack) < 2 {
+		return nil
+	}
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	frame.finish(output, gasUsed, err)
+
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	return nil
+}
+
+// CaptureState implements the Tracer interface, instructions aren't traced.
+func (t *CallTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *CallTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface to finish the top level call.
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if t.root != nil {
+		t.root.finish(output, gasUsed, err)
+	}
+	return nil
+}
+
+// Result returns the top level call frame, or nil if nothing was traced.
+func (t *CallTracer) Result() *CallFrame { return t.root }
+
+// GetResult returns the call tree in the JSON format of the callTracer.
+func (t *CallTracer) GetResult() (json.RawMessage, error) {
+	if t.root == nil {
+		return json.RawMessage("null"), nil
+	}
+	return json.Marshal(t.root)
+}
+
+// unpackRevertReason decodes the reason string of Error(string) revert data.
+func unpackRevertReason(data []byte) (string, bool) {
+	if len(data) < 4 || !bytes.Equal(data[:4], revertSelector) {
+		return "", false
+	}
+	data = data[4:]
+	if len(data) < 32 {
+		return "", false
+	}
+	offset := new(big.Int).SetBytes(data[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data))-32 {
+		return "", false
+	}
+	start := offset.Uint64() + 32
+	length := new(big.Int).SetBytes(data[start-32 : start])
+	if !length.IsUint64() || length.Uint64() > uint64(len(data))-start {
+		return "", false
+	}
+	return string(data[start : start+length.Uint64()]), true
+}
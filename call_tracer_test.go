@@ -0,0 +1,102 @@
+package evm
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// revertReason returns the Error(string) revert data for reason.
+func revertReason(reason string) []byte {
+	data := append([]byte{}, revertSelector...)
+	data = append(data, util.HashToBytes(util.BigToHash(big.NewInt(32)))...)
+	data = append(data, util.HashToBytes(util.BigToHash(big.NewInt(int64(len(reason)))))...)
+	return append(data, util.HashToBytes(util.BytesToHash(append([]byte(reason), make([]byte, 32-len(reason))...)))...)
+}
+
+func TestUnpackRevertReason(t *testing.T) {
+	assert := assert.New(t)
+	reason, ok := unpackRevertReason(revertReason("nope"))
+	assert.True(ok)
+	assert.Equal("nope", reason)
+
+	_, ok = unpackRevertReason(nil)
+	assert.False(ok)
+	_, ok = unpackRevertReason(revertReason("nope")[:40])
+	assert.False(ok)
+	invalid := revertReason("nope")
+	invalid[4+31] = 0xff
+	_, ok = unpackRevertReason(invalid)
+	assert.False(ok)
+}
+
+func TestCallTracer(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc     = mockPreBlockChain()
+		tracer = NewCallTracer(nil)
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+		callee = util.HexToAddress("0x000000000000000000000000000000000000000b")
+	)
+	// Call the callee with one byte of input, then stop.
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 1, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, callee[:]...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(STOP))
+	bc.SetCode(contractAddress, code)
+
+	// Revert with the reason appended to the code.
+	payload := revertReason("nope")
+	revert := []byte{byte(PUSH1), byte(len(payload)), byte(PUSH1), 12, byte(PUSH1), 0, byte(CODECOPY), byte(PUSH1), byte(len(payload)), byte(PUSH1), 0, byte(REVERT)}
+	bc.CreateAccount(callee)
+	bc.SetCode(callee, append(revert, payload...))
+
+	_, left, err := env.Call(AccountRef(callerAddress), contractAddress, []byte{0xab}, 1000000, new(big.Int))
+	assert.Nil(err)
+
+	root := tracer.Result()
+	assert.Equal(CallTypeCall, root.Type)
+	assert.Equal(contractAddress, root.To)
+	assert.Equal([]byte{0xab}, root.Input)
+	assert.Equal(1000000-left, root.GasUsed)
+	assert.Equal(1, len(root.Calls))
+
+	call := root.Calls[0]
+	assert.Equal(CallTypeCall, call.Type)
+	assert.Equal(contractAddress, call.From)
+	assert.Equal(callee, call.To)
+	assert.Equal([]byte{0}, call.Input)
+	assert.Equal(payload, call.Output)
+	assert.Equal("execution reverted", call.Error)
+	assert.Equal("nope", call.RevertReason)
+	assert.True(call.GasUsed > 0 && call.GasUsed < call.Gas)
+
+	res, err := tracer.GetResult()
+	assert.Nil(err)
+	var decoded map[string]interface{}
+	assert.Nil(json.Unmarshal(res, &decoded))
+	assert.Equal("CALL", decoded["type"])
+	assert.Equal("0xab", decoded["input"])
+	assert.Equal("0x0", decoded["value"])
+	calls := decoded["calls"].([]interface{})
+	assert.Equal("execution reverted", calls[0].(map[string]interface{})["error"])
+	assert.Equal("nope", calls[0].(map[string]interface{})["revertReason"])
+	assert.Equal("0x000000000000000000000000000000000000000b", calls[0].(map[string]interface{})["to"])
+
+	// Only the top level call is recorded if requested.
+	tracer = NewCallTracer(&CallTracerConfig{OnlyTopCall: true})
+	env = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(0, len(tracer.Result().Calls))
+
+	// Out of gas is reported with the message of the common callTracer.
+	tracer = NewCallTracer(nil)
+	env = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 10, new(big.Int))
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal("out of gas", tracer.Result().Error)
+}
@@ -0,0 +1,113 @@
+// Copyright(c) 2018 DSiSc Group. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// evmdebug runs contract code in an in-memory state and debugs the execution
+// interactively, e.g.
+//
+//	evmdebug -code 0x6001600201 -input 0x
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/repository/config"
+)
+
+var (
+	callerAddress   = util.HexToAddress("0x00000000000000000000000000000000000c0ffe")
+	contractAddress = util.HexToAddress("0x000000000000000000000000000000000000c0de")
+)
+
+// eventCenter discards the events of the repository.
+type eventCenter struct{}
+
+func (*eventCenter) Subscribe(types.EventType, types.EventFunc) types.Subscriber { return nil }
+func (*eventCenter) UnSubscribe(types.EventType, types.Subscriber) error         { return nil }
+func (*eventCenter) Notify(types.EventType, interface{}) error                   { return nil }
+func (*eventCenter) NotifySubscriber(types.EventFunc, interface{})               {}
+func (*eventCenter) NotifyAll() []error                                          { return nil }
+func (*eventCenter) UnSubscribeAll()                                             {}
+
+func main() {
+	var (
+		codeFlag  = flag.String("code", "", "hex encoded contract code")
+		inputFlag = flag.String("input", "0x", "hex encoded call input")
+		gasFlag   = flag.Uint64("gas", 10000000, "gas available to the call")
+		valueFlag = flag.Uint64("value", 0, "value transferred by the call")
+		stopFlag  = flag.Bool("stop", true, "pause before the first instruction")
+	)
+	flag.Parse()
+
+	code, err := hexutil.Decode(*codeFlag)
+	if err != nil {
+		fatalf("invalid code: %v", err)
+	}
+	input, err := hexutil.Decode(*inputFlag)
+	if err != nil {
+		fatalf("invalid input: %v", err)
+	}
+
+	err = repository.InitRepository(config.RepositoryConfig{PluginName: repository.PLUGIN_MEMDB}, &eventCenter{})
+	if err != nil {
+		fatalf("failed to create state: %v", err)
+	}
+	state, err := repository.NewLatestStateRepository()
+	if err != nil {
+		fatalf("failed to create state: %v", err)
+	}
+	value := new(big.Int).SetUint64(*valueFlag)
+	state.CreateAccount(callerAddress)
+	state.AddBalance(callerAddress, value)
+	state.CreateAccount(contractAddress)
+	state.SetCode(contractAddress, code)
+
+	var (
+		debugger = evm.NewDebugger(&evm.DebuggerConfig{StopOnEntry: *stopFlag})
+		context  = evm.Context{
+			CanTransfer: evm.CanTransfer,
+			Transfer:    evm.Transfer,
+			GetHash:     func(uint64) types.Hash { return types.Hash{} },
+			Origin:      callerAddress,
+			GasPrice:    new(big.Int),
+			GasLimit:    *gasFlag,
+			BlockNumber: new(big.Int),
+			Time:        new(big.Int),
+			Difficulty:  new(big.Int),
+		}
+		env = evm.NewEVMWithConfig(context, state, params.AllEthashProtocolChanges, evm.Config{Debug: true, Tracer: debugger})
+	)
+	run := func() error {
+		ret, left, err := env.Call(evm.AccountRef(callerAddress), contractAddress, input, *gasFlag, value)
+		fmt.Printf("output 0x%x, gas used %d\n", ret, *gasFlag-left)
+		return err
+	}
+	fmt.Println(`Type "help" for the commands, "run" to start.`)
+	if err := evm.NewDebugConsole(debugger, run, os.Stdout).Run(os.Stdin); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
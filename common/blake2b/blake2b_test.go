@@ -0,0 +1,25 @@
+package blake2b
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// TestF hashes "abc" in a single block, RFC 7693 appendix A.
+func TestF(t *testing.T) {
+	h := iv
+	h[0] ^= 0x01010000 ^ 64 // no key, 64 byte digest
+	var m [16]uint64
+	m[0] = 0x636261
+	F(&h, m, [2]uint64{3, 0}, true, 12)
+
+	digest := make([]byte, 64)
+	for i, word := range h {
+		binary.LittleEndian.PutUint64(digest[i*8:], word)
+	}
+	want := "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"
+	if got := hex.EncodeToString(digest); got != want {
+		t.Errorf("digest mismatch: have %s, want %s", got, want)
+	}
+}
@@ -49,8 +49,13 @@ type Contract struct {
 	caller        ContractRef
 	self          ContractRef
 
-	jumpdests map[types.Hash]bitvec // Aggregated result of JUMPDEST analysis.
-	analysis  bitvec                // Locally cached result of JUMPDEST analysis
+	jumpdests  map[types.Hash]bitvec        // Aggregated result of JUMPDEST analysis.
+	analysis   bitvec                       // Locally cached result of JUMPDEST analysis
+	containers map[types.Hash]*eofContainer // Aggregated result of EOF validation.
+
+	eof        *eofContainer // Validated EOF container of the code, nil for legacy code
+	eofSection int           // Index of the EOF code section being executed
+	eofReturns []eofReturn   // Return stack of the EOF CALLF instruction
 
 	Code     []byte
 	CodeHash types.Hash
@@ -68,8 +73,10 @@ func NewContract(caller ContractRef, object ContractRef, value *big.Int, gas uin
 	if parent, ok := caller.(*Contract); ok {
 		// Reuse JUMPDEST analysis from parent context if available.
 		c.jumpdests = parent.jumpdests
+		c.containers = parent.containers
 	} else {
 		c.jumpdests = make(map[types.Hash]bitvec)
+		c.containers = make(map[types.Hash]*eofContainer)
 	}
 
 	// Gas should be a pointer so it can safely be reduced through the run
@@ -82,6 +89,10 @@ func NewContract(caller ContractRef, object ContractRef, value *big.Int, gas uin
 }
 
 func (c *Contract) validJumpdest(dest *big.Int) bool {
+	// EOF code has no dynamic jumps, so it is never analysed.
+	if c.eof != nil {
+		return false
+	}
 	udest := dest.Uint64()
 	// PC cannot go beyond len(code) and certainly can't be bigger than 63bits.
 	// Don't bother checking for JUMPDEST in that case.
@@ -114,6 +125,25 @@ func (c *Contract) validJumpdest(dest *big.Int) bool {
 	return c.analysis.codeSegment(udest)
 }
 
+// eofContainer returns the validated EOF container of the contract code.
+// Like the JUMPDEST analysis, the result is shared with the parent context
+// if the code hash is known.
+func (c *Contract) eofContainer(jt *JumpTable) (*eofContainer, error) {
+	if c.CodeHash != (types.Hash{}) {
+		if container, exist := c.containers[c.CodeHash]; exist {
+			return container, nil
+		}
+	}
+	container, err := validateEOF(c.Code, jt)
+	if err != nil {
+		return nil, err
+	}
+	if c.CodeHash != (types.Hash{}) {
+		c.containers[c.CodeHash] = container
+	}
+	return container, nil
+}
+
 // AsDelegate sets the contract to be a delegate call and returns the current
 // contract (for chaining calls)
 func (c *Contract) AsDelegate() *Contract {
@@ -17,15 +17,24 @@
 package evm
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/crypto-suite/crypto/bn256"
 	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/common/blake2b"
 	"github.com/DSiSc/evm-NG/common/math"
 	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/util"
+	"github.com/iden3/go-iden3-crypto/constants"
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	bls12381 "github.com/kilic/bls12-381"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
 	"golang.org/x/crypto/ripemd160"
 	"math/big"
 )
@@ -60,6 +69,58 @@ var PrecompiledContractsByzantium = map[types.Address]PrecompiledContract{
 	util.BytesToAddress([]byte{8}): &bn256Pairing{},
 }
 
+// PrecompiledContractsEIP152 contains the pre-compiled contracts added to the
+// Byzantium set after the EIP152 fork, the BLAKE2b F compression.
+var PrecompiledContractsEIP152 = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{9}): &blake2F{},
+}
+
+// PrecompiledContractsEIP2537 contains the pre-compiled contracts added to the
+// default set after the EIP2537 fork, the BLS12-381 curve operations.
+var PrecompiledContractsEIP2537 = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{0x0b}): &bls12381G1Add{},
+	util.BytesToAddress([]byte{0x0c}): &bls12381G1MultiExp{},
+	util.BytesToAddress([]byte{0x0d}): &bls12381G2Add{},
+	util.BytesToAddress([]byte{0x0e}): &bls12381G2MultiExp{},
+	util.BytesToAddress([]byte{0x0f}): &bls12381Pairing{},
+	util.BytesToAddress([]byte{0x10}): &bls12381MapG1{},
+	util.BytesToAddress([]byte{0x11}): &bls12381MapG2{},
+}
+
+// PrecompiledContractsRIP7212 contains the pre-compiled contracts added to the
+// default set after the RIP7212 fork, the secp256r1 signature verification.
+var PrecompiledContractsRIP7212 = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{1, 0}): &p256Verify{},
+}
+
+// PrecompiledContractsEIP2565 contains the pre-compiled contracts replaced in
+// the default set after the EIP2565 fork, the repriced modexp.
+var PrecompiledContractsEIP2565 = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{5}): &bigModExp{eip2565: true},
+}
+
+// PrecompiledContractsEIP7823 contains the pre-compiled contracts replaced in
+// the default set after the EIP7823 fork, the modexp with bounded operand
+// lengths, priced by EIP-2565 whether that fork is active or not.
+var PrecompiledContractsEIP7823 = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{5}): &bigModExp{eip2565: true, eip7823: true},
+}
+
+// PrecompiledContractsSMCrypto contains the pre-compiled contracts added to the
+// default set after the SMCrypto fork, the SM3 hash and the SM2 signatures of
+// the Chinese national cryptographic standards.
+var PrecompiledContractsSMCrypto = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{2, 1}): &sm3hash{},
+	util.BytesToAddress([]byte{2, 2}): &sm2Verify{},
+	util.BytesToAddress([]byte{2, 3}): &sm2Recover{},
+}
+
+// PrecompiledContractsPoseidon contains the pre-compiled contracts added to
+// the default set after the Poseidon fork, the ZK friendly Poseidon hash.
+var PrecompiledContractsPoseidon = map[types.Address]PrecompiledContract{
+	util.BytesToAddress([]byte{3, 0}): &poseidonHash{},
+}
+
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
 func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
 	gas := p.RequiredGas(input)
@@ -102,6 +163,132 @@ func (c *ecrecover) Run(input []byte) ([]byte, error) {
 	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32), nil
 }
 
+const p256VerifyInputLength = 160
+
+// P256VERIFY implemented as a native contract, see RIP-7212.
+type p256Verify struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *p256Verify) RequiredGas(input []byte) uint64 {
+	return params.P256VerifyGas
+}
+
+func (c *p256Verify) Run(input []byte) ([]byte, error) {
+	// "input" is (hash, r, s, x, y), each 32 bytes. Invalid inputs and
+	// signatures return nothing, without failing.
+	if len(input) != p256VerifyInputLength {
+		return nil, nil
+	}
+	var (
+		hash = input[:32]
+		r    = new(big.Int).SetBytes(input[32:64])
+		s    = new(big.Int).SetBytes(input[64:96])
+		x    = new(big.Int).SetBytes(input[96:128])
+		y    = new(big.Int).SetBytes(input[128:160])
+	)
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	if ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s) {
+		return true32Byte, nil
+	}
+	return nil, nil
+}
+
+const (
+	sm2VerifyInputLength  = 160
+	sm2RecoverInputLength = 128
+)
+
+// SM2 signature verification implemented as a native contract, see GM/T
+// 0003-2012.
+type sm2Verify struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *sm2Verify) RequiredGas(input []byte) uint64 {
+	return params.Sm2VerifyGas
+}
+
+func (c *sm2Verify) Run(input []byte) ([]byte, error) {
+	// "input" is (hash, r, s, x, y), each 32 bytes, the hash being the SM3
+	// digest of the signer's ZA and the message. Invalid inputs and signatures
+	// return nothing, without failing.
+	if len(input) != sm2VerifyInputLength {
+		return nil, nil
+	}
+	var (
+		hash = input[:32]
+		r    = new(big.Int).SetBytes(input[32:64])
+		s    = new(big.Int).SetBytes(input[64:96])
+		x    = new(big.Int).SetBytes(input[96:128])
+		y    = new(big.Int).SetBytes(input[128:160])
+	)
+	curve := sm2.P256Sm2()
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	if sm2.Verify(&sm2.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s) {
+		return true32Byte, nil
+	}
+	return nil, nil
+}
+
+// SM2 public key recovery implemented as a native contract.
+type sm2Recover struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *sm2Recover) RequiredGas(input []byte) uint64 {
+	return params.Sm2RecoverGas
+}
+
+func (c *sm2Recover) Run(input []byte) ([]byte, error) {
+	input = common.RightPadBytes(input, sm2RecoverInputLength)
+	// "input" is (hash, v, r, s), each 32 bytes, like for ecrecover, v being
+	// 27 or 28 by the parity of the y coordinate of the signature point kG.
+	// The recovered public key is returned as (x, y), each 32 bytes.
+	var (
+		curve = sm2.P256Sm2()
+		n     = curve.Params().N
+		p     = curve.Params().P
+		e     = new(big.Int).SetBytes(input[:32])
+		r     = new(big.Int).SetBytes(input[64:96])
+		s     = new(big.Int).SetBytes(input[96:128])
+	)
+	if !allZero(input[32:63]) || (input[63] != 27 && input[63] != 28) {
+		return nil, nil
+	}
+	if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+		return nil, nil
+	}
+	t := new(big.Int).Add(r, s)
+	if t.Mod(t, n).Sign() == 0 {
+		return nil, nil
+	}
+	// r = e + x1 mod n, where (x1, y1) = kG is on y^2 = x^3 - 3x + b
+	x1 := new(big.Int).Sub(r, e)
+	x1.Mod(x1, n)
+	y1 := new(big.Int).Exp(x1, big.NewInt(3), p)
+	y1.Sub(y1, new(big.Int).Mul(x1, big.NewInt(3))).Add(y1, curve.Params().B)
+	if y1.ModSqrt(y1.Mod(y1, p), p) == nil {
+		return nil, nil
+	}
+	if y1.Bit(0) != uint(input[63]-27) {
+		y1.Sub(p, y1)
+	}
+	// kG = sG + tP with t = r + s, so P = t^-1 kG - t^-1 s G
+	tInv := new(big.Int).ModInverse(t, n)
+	u := new(big.Int).Mul(s, tInv)
+	u.Sub(n, u.Mod(u, n))
+	x, y := curve.ScalarMult(x1, y1, tInv.Bytes())
+	ux, uy := curve.ScalarBaseMult(u.Bytes())
+	x, y = curve.Add(x, y, ux, uy)
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	return append(common.LeftPadBytes(x.Bytes(), 32), common.LeftPadBytes(y.Bytes(), 32)...), nil
+}
+
 // SHA256 implemented as a native contract.
 type sha256hash struct{}
 
@@ -133,6 +320,70 @@ func (c *ripemd160hash) Run(input []byte) ([]byte, error) {
 	return common.LeftPadBytes(ripemd.Sum(nil), 32), nil
 }
 
+// SM3 implemented as a native contract, see GM/T 0004-2012.
+type sm3hash struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+//
+// This method does not require any overflow checking as the input size gas costs
+// required for anything significant is so high it's impossible to pay for.
+func (c *sm3hash) RequiredGas(input []byte) uint64 {
+	return uint64(len(input)+31)/32*params.Sm3PerWordGas + params.Sm3BaseGas
+}
+func (c *sm3hash) Run(input []byte) ([]byte, error) {
+	return sm3.Sm3Sum(input), nil
+}
+
+// Widths of the supported Poseidon permutations, the number of inputs plus
+// the capacity element.
+const (
+	poseidonMinWidth = 3
+	poseidonMaxWidth = 6
+)
+
+// poseidonGas are the prices of the Poseidon permutations by width.
+var poseidonGas = [...]uint64{params.PoseidonT3Gas, params.PoseidonT4Gas, params.PoseidonT5Gas, params.PoseidonT6Gas}
+
+var (
+	errPoseidonInvalidInputLength  = errors.New("invalid input length")
+	errPoseidonInvalidFieldElement = errors.New("invalid field element")
+)
+
+// poseidonHash implements the Poseidon hash over the BN254 scalar field with
+// the parameters of circomlib as a native contract. The input is from 2 to 5
+// field elements of 32 bytes, big endian, hashed by a permutation of width
+// one more than their number.
+type poseidonHash struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *poseidonHash) RequiredGas(input []byte) uint64 {
+	// Invalid inputs fail in Run, without charging for a permutation
+	width := len(input)/32 + 1
+	if len(input)%32 != 0 || width < poseidonMinWidth || width > poseidonMaxWidth {
+		return 0
+	}
+	return poseidonGas[width-poseidonMinWidth]
+}
+
+func (c *poseidonHash) Run(input []byte) ([]byte, error) {
+	width := len(input)/32 + 1
+	if len(input)%32 != 0 || width < poseidonMinWidth || width > poseidonMaxWidth {
+		return nil, errPoseidonInvalidInputLength
+	}
+	elements := make([]*big.Int, width-1)
+	for i := range elements {
+		elements[i] = new(big.Int).SetBytes(input[i*32 : (i+1)*32])
+		if elements[i].Cmp(constants.Q) >= 0 {
+			return nil, errPoseidonInvalidFieldElement
+		}
+	}
+	hash, err := poseidon.Hash(elements)
+	if err != nil {
+		return nil, err
+	}
+	return common.LeftPadBytes(hash.Bytes(), 32), nil
+}
+
 // data copy implemented as a native contract.
 type dataCopy struct{}
 
@@ -148,11 +399,21 @@ func (c *dataCopy) Run(in []byte) ([]byte, error) {
 }
 
 // bigModExp implements a native big integer exponential modular operation.
-type bigModExp struct{}
+// After the EIP2565 fork it is priced by EIP-2565, after the EIP7823 fork
+// the lengths of its operands are bounded by params.ModExpMaxInputLength.
+type bigModExp struct {
+	eip2565 bool
+	eip7823 bool
+}
+
+// errModExpInputTooLarge is returned if the length of a modexp operand is out
+// of bounds.
+var errModExpInputTooLarge = errors.New("modexp input too large")
 
 var (
 	big1      = big.NewInt(1)
 	big4      = big.NewInt(4)
+	big7      = big.NewInt(7)
 	big8      = big.NewInt(8)
 	big16     = big.NewInt(16)
 	big32     = big.NewInt(32)
@@ -201,6 +462,22 @@ func (c *bigModExp) RequiredGas(input []byte) uint64 {
 
 	// Calculate the gas cost of the operation
 	gas := new(big.Int).Set(math.BigMax(modLen, baseLen))
+	if c.eip2565 {
+		// The multiplication complexity is the square of the number of 8 byte
+		// words, with a lower divisor and a minimum price
+		gas.Add(gas, big7).Div(gas, big8)
+		gas.Mul(gas, gas)
+		gas.Mul(gas, math.BigMax(adjExpLen, big1))
+		gas.Div(gas, new(big.Int).SetUint64(params.ModExpQuadCoeffDivEIP2565))
+
+		if gas.BitLen() > 64 {
+			return math.MaxUint64
+		}
+		if gas.Uint64() < params.ModExpMinGasEIP2565 {
+			return params.ModExpMinGasEIP2565
+		}
+		return gas.Uint64()
+	}
 	switch {
 	case gas.Cmp(big64) <= 0:
 		gas.Mul(gas, gas)
@@ -226,28 +503,45 @@ func (c *bigModExp) RequiredGas(input []byte) uint64 {
 
 func (c *bigModExp) Run(input []byte) ([]byte, error) {
 	var (
-		baseLen = new(big.Int).SetBytes(getData(input, 0, 32)).Uint64()
-		expLen  = new(big.Int).SetBytes(getData(input, 32, 32)).Uint64()
-		modLen  = new(big.Int).SetBytes(getData(input, 64, 32)).Uint64()
+		baseLen, baseOverflow = bigUint64(new(big.Int).SetBytes(getData(input, 0, 32)))
+		expLen, expOverflow   = bigUint64(new(big.Int).SetBytes(getData(input, 32, 32)))
+		modLen, modOverflow   = bigUint64(new(big.Int).SetBytes(getData(input, 64, 32)))
 	)
 	if len(input) > 96 {
 		input = input[96:]
 	} else {
 		input = input[:0]
 	}
+	if c.eip7823 && (baseOverflow || expOverflow || modOverflow ||
+		baseLen > params.ModExpMaxInputLength || expLen > params.ModExpMaxInputLength || modLen > params.ModExpMaxInputLength) {
+		return nil, errModExpInputTooLarge
+	}
 	// Handle a special case when both the base and mod length is zero
-	if baseLen == 0 && modLen == 0 {
+	if baseLen == 0 && modLen == 0 && !baseOverflow && !modOverflow {
 		return []byte{}, nil
 	}
-	// Retrieve the operands and execute the exponentiation
-	var (
-		base = new(big.Int).SetBytes(getData(input, 0, baseLen))
-		exp  = new(big.Int).SetBytes(getData(input, baseLen, expLen))
-		mod  = new(big.Int).SetBytes(getData(input, baseLen+expLen, modLen))
-	)
-	if mod.BitLen() == 0 {
-		// Modulo 0 is undefined, return zero
-		return common.LeftPadBytes([]byte{}, int(modLen)), nil
+	// Lengths this large can't be paid for, reject them before allocating
+	if baseOverflow || expOverflow || modOverflow || baseLen+expLen < baseLen || baseLen+expLen+modLen < baseLen+expLen {
+		return nil, errModExpInputTooLarge
+	}
+	// The result is empty without modulus, or zero for the moduli 0, which
+	// is undefined, and 1
+	if modLen == 0 {
+		return []byte{}, nil
+	}
+	mod := new(big.Int).SetBytes(getData(input, baseLen+expLen, modLen))
+	if mod.Cmp(big1) <= 0 {
+		return make([]byte, modLen), nil
+	}
+	// Retrieve the other operands and execute the exponentiation, base^0
+	// being 1 and 0^exp 0 otherwise
+	exp := new(big.Int).SetBytes(getData(input, baseLen, expLen))
+	if exp.Sign() == 0 {
+		return common.LeftPadBytes(big1.Bytes(), int(modLen)), nil
+	}
+	base := new(big.Int).SetBytes(getData(input, 0, baseLen))
+	if base.Sign() == 0 {
+		return make([]byte, modLen), nil
 	}
 	return common.LeftPadBytes(base.Exp(base, exp, mod).Bytes(), int(modLen)), nil
 }
@@ -359,3 +653,377 @@ func (c *bn256Pairing) Run(input []byte) ([]byte, error) {
 	}
 	return false32Byte, nil
 }
+
+const blake2FInputLength = 213
+
+var (
+	errBlake2FInvalidInputLength = errors.New("invalid input length")
+	errBlake2FInvalidFinalFlag   = errors.New("invalid final flag")
+)
+
+// blake2F implements the BLAKE2b F compression function as a native contract,
+// see EIP-152.
+type blake2F struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *blake2F) RequiredGas(input []byte) uint64 {
+	// Invalid inputs fail in Run, without charging for their rounds
+	if len(input) != blake2FInputLength {
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(input[0:4])) * params.Blake2FPerRoundGas
+}
+
+func (c *blake2F) Run(input []byte) ([]byte, error) {
+	// The input is the number of rounds, the state h, the message block m,
+	// the offset counters t and the final block flag f
+	if len(input) != blake2FInputLength {
+		return nil, errBlake2FInvalidInputLength
+	}
+	if input[212] != 0 && input[212] != 1 {
+		return nil, errBlake2FInvalidFinalFlag
+	}
+	var (
+		rounds = binary.BigEndian.Uint32(input[0:4])
+		final  = input[212] == 1
+		h      [8]uint64
+		m      [16]uint64
+		t      [2]uint64
+	)
+	for i := range h {
+		h[i] = binary.LittleEndian.Uint64(input[4+i*8:])
+	}
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(input[68+i*8:])
+	}
+	t[0] = binary.LittleEndian.Uint64(input[196:])
+	t[1] = binary.LittleEndian.Uint64(input[204:])
+
+	blake2b.F(&h, m, t, final, rounds)
+
+	output := make([]byte, 64)
+	for i, word := range h {
+		binary.LittleEndian.PutUint64(output[i*8:], word)
+	}
+	return output, nil
+}
+
+// Sizes of the BLS12-381 encodings of EIP-2537. A field element is encoded
+// in 64 bytes, big endian, its top 16 bytes being zero. An Fp2 element is
+// encoded as c0 then c1, a point as x then y, and the point at infinity as
+// zeros. A scalar is encoded in 32 bytes, big endian.
+const (
+	bls12381FieldElementLength = 64
+	bls12381G1PointLength      = 2 * bls12381FieldElementLength
+	bls12381G2PointLength      = 4 * bls12381FieldElementLength
+	bls12381ScalarLength       = 32
+)
+
+var (
+	errBLS12381InvalidInputLength          = errors.New("invalid input length")
+	errBLS12381InvalidFieldElementTopBytes = errors.New("invalid field element top bytes")
+	errBLS12381G1PointSubgroup             = errors.New("g1 point is not in the correct subgroup")
+	errBLS12381G2PointSubgroup             = errors.New("g2 point is not in the correct subgroup")
+)
+
+// bls12381G1Add implements the BLS12-381 G1 point addition as a native
+// contract, see EIP-2537.
+type bls12381G1Add struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G1Add) RequiredGas(input []byte) uint64 {
+	return params.Bls12381G1AddGas
+}
+
+func (c *bls12381G1Add) Run(input []byte) ([]byte, error) {
+	// The input is two G1 points, which are not checked to be in the subgroup
+	if len(input) != 2*bls12381G1PointLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g := bls12381.NewG1()
+	p0, err := decodeBLS12381G1Point(g, input[:bls12381G1PointLength])
+	if err != nil {
+		return nil, err
+	}
+	p1, err := decodeBLS12381G1Point(g, input[bls12381G1PointLength:])
+	if err != nil {
+		return nil, err
+	}
+	r := g.New()
+	g.Add(r, p0, p1)
+	return encodeBLS12381G1Point(g, r), nil
+}
+
+// bls12381G1MultiExp implements the BLS12-381 G1 multi scalar multiplication
+// as a native contract, see EIP-2537.
+type bls12381G1MultiExp struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G1MultiExp) RequiredGas(input []byte) uint64 {
+	k := len(input) / (bls12381G1PointLength + bls12381ScalarLength)
+	return bls12381MultiExpGas(k, params.Bls12381G1MulGas, params.Bls12381G1MultiExpDiscount)
+}
+
+func (c *bls12381G1MultiExp) Run(input []byte) ([]byte, error) {
+	// The input is k pairs of a G1 point and a scalar
+	const pairLength = bls12381G1PointLength + bls12381ScalarLength
+	if len(input) == 0 || len(input)%pairLength != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	var (
+		g       = bls12381.NewG1()
+		k       = len(input) / pairLength
+		points  = make([]*bls12381.PointG1, k)
+		scalars = make([]*big.Int, k)
+	)
+	for i := 0; i < k; i++ {
+		pair := input[i*pairLength : (i+1)*pairLength]
+		p, err := decodeBLS12381G1Point(g, pair[:bls12381G1PointLength])
+		if err != nil {
+			return nil, err
+		}
+		if !g.InCorrectSubgroup(p) {
+			return nil, errBLS12381G1PointSubgroup
+		}
+		points[i] = p
+		scalars[i] = new(big.Int).SetBytes(pair[bls12381G1PointLength:])
+	}
+	r := g.New()
+	if _, err := g.MultiExpBig(r, points, scalars); err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G1Point(g, r), nil
+}
+
+// bls12381G2Add implements the BLS12-381 G2 point addition as a native
+// contract, see EIP-2537.
+type bls12381G2Add struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G2Add) RequiredGas(input []byte) uint64 {
+	return params.Bls12381G2AddGas
+}
+
+func (c *bls12381G2Add) Run(input []byte) ([]byte, error) {
+	// The input is two G2 points, which are not checked to be in the subgroup
+	if len(input) != 2*bls12381G2PointLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g := bls12381.NewG2()
+	p0, err := decodeBLS12381G2Point(g, input[:bls12381G2PointLength])
+	if err != nil {
+		return nil, err
+	}
+	p1, err := decodeBLS12381G2Point(g, input[bls12381G2PointLength:])
+	if err != nil {
+		return nil, err
+	}
+	r := g.New()
+	g.Add(r, p0, p1)
+	return encodeBLS12381G2Point(g, r), nil
+}
+
+// bls12381G2MultiExp implements the BLS12-381 G2 multi scalar multiplication
+// as a native contract, see EIP-2537.
+type bls12381G2MultiExp struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381G2MultiExp) RequiredGas(input []byte) uint64 {
+	k := len(input) / (bls12381G2PointLength + bls12381ScalarLength)
+	return bls12381MultiExpGas(k, params.Bls12381G2MulGas, params.Bls12381G2MultiExpDiscount)
+}
+
+func (c *bls12381G2MultiExp) Run(input []byte) ([]byte, error) {
+	// The input is k pairs of a G2 point and a scalar
+	const pairLength = bls12381G2PointLength + bls12381ScalarLength
+	if len(input) == 0 || len(input)%pairLength != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	var (
+		g       = bls12381.NewG2()
+		k       = len(input) / pairLength
+		points  = make([]*bls12381.PointG2, k)
+		scalars = make([]*big.Int, k)
+	)
+	for i := 0; i < k; i++ {
+		pair := input[i*pairLength : (i+1)*pairLength]
+		p, err := decodeBLS12381G2Point(g, pair[:bls12381G2PointLength])
+		if err != nil {
+			return nil, err
+		}
+		if !g.InCorrectSubgroup(p) {
+			return nil, errBLS12381G2PointSubgroup
+		}
+		points[i] = p
+		scalars[i] = new(big.Int).SetBytes(pair[bls12381G2PointLength:])
+	}
+	r := g.New()
+	if _, err := g.MultiExpBig(r, points, scalars); err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G2Point(g, r), nil
+}
+
+// bls12381MultiExpGas returns the price of a multi scalar multiplication of
+// k pairs at the given discount, in thousandths.
+func bls12381MultiExpGas(k int, mulGas uint64, discount func(int) uint64) uint64 {
+	if k == 0 {
+		return 0
+	}
+	return uint64(k) * mulGas * discount(k) / 1000
+}
+
+// bls12381Pairing implements a pairing pre-compile for the BLS12-381 curve,
+// see EIP-2537.
+type bls12381Pairing struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381Pairing) RequiredGas(input []byte) uint64 {
+	k := uint64(len(input) / (bls12381G1PointLength + bls12381G2PointLength))
+	return params.Bls12381PairingBaseGas + k*params.Bls12381PairingPerPairGas
+}
+
+func (c *bls12381Pairing) Run(input []byte) ([]byte, error) {
+	// The input is k pairs of a G1 and a G2 point, checked to be in the
+	// subgroups. Pairs including the point at infinity don't count.
+	const pairLength = bls12381G1PointLength + bls12381G2PointLength
+	if len(input) == 0 || len(input)%pairLength != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	e := bls12381.NewEngine()
+	for i := 0; i < len(input); i += pairLength {
+		p1, err := decodeBLS12381G1Point(e.G1, input[i:i+bls12381G1PointLength])
+		if err != nil {
+			return nil, err
+		}
+		p2, err := decodeBLS12381G2Point(e.G2, input[i+bls12381G1PointLength:i+pairLength])
+		if err != nil {
+			return nil, err
+		}
+		if !e.G1.InCorrectSubgroup(p1) {
+			return nil, errBLS12381G1PointSubgroup
+		}
+		if !e.G2.InCorrectSubgroup(p2) {
+			return nil, errBLS12381G2PointSubgroup
+		}
+		e.AddPair(p1, p2)
+	}
+	if e.Check() {
+		return true32Byte, nil
+	}
+	return false32Byte, nil
+}
+
+// bls12381MapG1 implements the mapping of a field element to a BLS12-381 G1
+// point as a native contract, see EIP-2537.
+type bls12381MapG1 struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381MapG1) RequiredGas(input []byte) uint64 {
+	return params.Bls12381MapG1Gas
+}
+
+func (c *bls12381MapG1) Run(input []byte) ([]byte, error) {
+	if len(input) != bls12381FieldElementLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	fe, err := decodeBLS12381FieldElement(input)
+	if err != nil {
+		return nil, err
+	}
+	g := bls12381.NewG1()
+	r, err := g.MapToCurve(fe)
+	if err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G1Point(g, r), nil
+}
+
+// bls12381MapG2 implements the mapping of an Fp2 element to a BLS12-381 G2
+// point as a native contract, see EIP-2537.
+type bls12381MapG2 struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *bls12381MapG2) RequiredGas(input []byte) uint64 {
+	return params.Bls12381MapG2Gas
+}
+
+func (c *bls12381MapG2) Run(input []byte) ([]byte, error) {
+	if len(input) != 2*bls12381FieldElementLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	c0, err := decodeBLS12381FieldElement(input[:bls12381FieldElementLength])
+	if err != nil {
+		return nil, err
+	}
+	c1, err := decodeBLS12381FieldElement(input[bls12381FieldElementLength:])
+	if err != nil {
+		return nil, err
+	}
+	g := bls12381.NewG2()
+	// The library encodes Fp2 elements as c1 then c0
+	r, err := g.MapToCurve(append(c1, c0...))
+	if err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G2Point(g, r), nil
+}
+
+// decodeBLS12381FieldElement returns the 48 byte field element encoded in
+// 64 bytes. Its range is checked when decoding the point using it.
+func decodeBLS12381FieldElement(in []byte) ([]byte, error) {
+	if !allZero(in[:16]) {
+		return nil, errBLS12381InvalidFieldElementTopBytes
+	}
+	return append([]byte{}, in[16:]...), nil
+}
+
+// decodeBLS12381G1Point unmarshals a G1 point, returning an error if it isn't
+// on the curve.
+func decodeBLS12381G1Point(g *bls12381.G1, in []byte) (*bls12381.PointG1, error) {
+	x, err := decodeBLS12381FieldElement(in[:bls12381FieldElementLength])
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBLS12381FieldElement(in[bls12381FieldElementLength:])
+	if err != nil {
+		return nil, err
+	}
+	return g.FromBytes(append(x, y...))
+}
+
+// decodeBLS12381G2Point unmarshals a G2 point, returning an error if it isn't
+// on the curve.
+func decodeBLS12381G2Point(g *bls12381.G2, in []byte) (*bls12381.PointG2, error) {
+	var fes [4][]byte
+	for i := range fes {
+		fe, err := decodeBLS12381FieldElement(in[i*bls12381FieldElementLength : (i+1)*bls12381FieldElementLength])
+		if err != nil {
+			return nil, err
+		}
+		fes[i] = fe
+	}
+	// The library encodes Fp2 elements as c1 then c0
+	in = append(append(append(fes[1], fes[0]...), fes[3]...), fes[2]...)
+	return g.FromBytes(in)
+}
+
+// encodeBLS12381G1Point marshals a G1 point.
+func encodeBLS12381G1Point(g *bls12381.G1, p *bls12381.PointG1) []byte {
+	out := make([]byte, bls12381G1PointLength)
+	raw := g.ToBytes(p)
+	copy(out[16:bls12381FieldElementLength], raw[:48])
+	copy(out[bls12381FieldElementLength+16:], raw[48:])
+	return out
+}
+
+// encodeBLS12381G2Point marshals a G2 point.
+func encodeBLS12381G2Point(g *bls12381.G2, p *bls12381.PointG2) []byte {
+	out := make([]byte, bls12381G2PointLength)
+	raw := g.ToBytes(p)
+	// The library encodes Fp2 elements as c1 then c0
+	for i, j := range []int{1, 0, 3, 2} {
+		copy(out[i*bls12381FieldElementLength+16:(i+1)*bls12381FieldElementLength], raw[j*48:(j+1)*48])
+	}
+	return out
+}
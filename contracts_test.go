@@ -17,10 +17,14 @@
 package evm
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"math/big"
 	"testing"
 
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/util"
 )
 
@@ -32,6 +36,14 @@ type precompiledTest struct {
 	noBenchmark     bool // Benchmark primarily the worst-cases
 }
 
+// precompiledFailureTest defines the input/error pairs for precompiled
+// contract failure tests.
+type precompiledFailureTest struct {
+	input         string
+	expectedError error
+	name          string
+}
+
 // modexpTests are the test and benchmark data for the modexp precompiled contract.
 var modexpTests = []precompiledTest{
 	{
@@ -336,8 +348,565 @@ var bn256PairingTests = []precompiledTest{
 	},
 }
 
+// blake2FInput returns an EIP-152 input compressing "abc" with the given
+// number of rounds and final block flag, all hex encoded.
+func blake2FInput(rounds, final string) string {
+	return rounds +
+		"48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b" +
+		"6162630000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"03000000000000000000000000000000" +
+		final
+}
+
+// blake2FTests are the test vectors of EIP-152.
+var blake2FTests = []precompiledTest{
+	{
+		input:    blake2FInput("00000000", "01"),
+		expected: "08c9bcf367e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d282e6ad7f520e511f6c3e2b8c68059b9442be0454267ce079217e1319cde05b",
+		name:     "vector 4",
+	}, {
+		input:    blake2FInput("0000000c", "01"),
+		expected: "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923",
+		name:     "vector 5",
+	}, {
+		input:    blake2FInput("0000000c", "00"),
+		expected: "75ab69d3190a562c51aef8d88f1c2775876944407270c42c9844252c26d2875298743e7f6d5ea2f2d3e8d226039cd31b4e426ac4f2d3d666a610c2116fde4735",
+		name:     "vector 6",
+	}, {
+		input:    blake2FInput("00000001", "01"),
+		expected: "b63a380cb2897d521994a85234ee2c181b5f844d2c624c002677e9703449d2fba551b3a8333bcdf5f2f7e08993d53923de3d64fcc68c034e717b9293fed7a421",
+		name:     "vector 7",
+	},
+}
+
+// blake2FFailureTests are the failing test vectors of EIP-152.
+var blake2FFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBlake2FInvalidInputLength,
+		name:          "vector 0: empty input",
+	}, {
+		input:         blake2FInput("00000c", "01"),
+		expectedError: errBlake2FInvalidInputLength,
+		name:          "vector 1: less rounds length",
+	}, {
+		input:         blake2FInput("000000000c", "01"),
+		expectedError: errBlake2FInvalidInputLength,
+		name:          "vector 2: more rounds length",
+	}, {
+		input:         blake2FInput("0000000c", "02"),
+		expectedError: errBlake2FInvalidFinalFlag,
+		name:          "vector 3: malformed final block indicator flag",
+	},
+}
+
+// p256VerifyTests are the test data for the secp256r1 signature verification
+// precompile: P-256 SHA-256 vectors of the NIST CAVP SigVer file, with the
+// message replaced by its hash, and malformed inputs.
+var p256VerifyTests = []precompiledTest{
+	{
+		input:    "a82c31412f537135d1c418bd7136fb5fde9426e70c70e7c2fb11f02f30fdeae2d19ff48b324915576416097d2544f7cbdf8768b1454ad20e0baac50e211f23b0a3e81e59311cdfff2d4784949f7a2cb50ba6c3a91fa54710568e61aca3e847c687f8f2b218f49845f6f10eec3877136269f5c1a54736dbdf69f89940cad41555e15f369036f49842fac7a86c8a2b0557609776814448b8f5e84aa9f4395205e9",
+		expected: "",
+		name:     "vector 0: s changed",
+	}, {
+		input:    "5984eab8854d0a9aa5f0c70f96deeb510e5f9ff8c51befcdc3c41bac53577f22dc23d130c6117fb5751201455e99f36f59aba1a6a21cf2d0e7481a97451d6693d6ce7708c18dbf35d4f8aa7240922dc6823f2e7058cbc1484fcad1599db5018c5cf02a00d205bdfee2016f7421807fc38ae69e6b7ccd064ee689fc1a94a9f7d2ec530ce3cc5c9d1af463f264d685afe2b4db4b5828d7e61b748930f3ce622a85",
+		expected: "",
+		name:     "vector 1: r changed",
+	}, {
+		input:    "44b02ad3088076f997220a68ff0b27a58ecfa528b604427097cce5ca956274c59913111cff6f20c5bf453a99cd2c2019a4e749a49724a08774d14e4c113edda89467cd4cd21ecb56b0cab0a9a453b43386845459127a952421f5c6382866c5cc2ddfd145767883ffbb0ac003ab4a44346d08fa2570b3120dcce94562422244cb5f70c7d11ac2b7a435ccfbbae02c3df1ea6b532cc0e9db74f93fffca7c6f9a64",
+		expected: "",
+		name:     "vector 2: q changed",
+	}, {
+		input:    "d1b8ef21eb4182ee270638061063a3f3c16c114e33937f69fb232cc833965a94bf96b99aa49c705c910be33142017c642ff540c76349b9dab72f981fd9347f4f17c55095819089c2e03b9cd415abdf12444e323075d98f31920b9e0f57ec871ce424dc61d4bb3cb7ef4344a7f8957a0c5134e16f7a67c074f82e6e12f49abf3c970eed7aa2bc48651545949de1dddaf0127e5965ac85d1243d6f60e7dfaee927",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "vector 3",
+	}, {
+		input:    "b9336a8d1f3e8ede001d19f41320bc7672d772a3d2cb0e435fff3c27d6804a2c1d75830cd36f4c9aa181b2c4221e87f176b7f05b7c87824e82e396c88315c407cb2acb01dac96efc53a32d4a0d85d0c2e48955214783ecf50a4f0414a319c05ae0fc6a6f50e1c57475673ee54e3a57f9a49f3328e743bf52f335e3eeaa3d28647f59d689c91e463607d9194d99faf316e25432870816dde63f5d4b373f12f22a",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "vector 4",
+	}, {
+		input:    "640c13e290147a48c83e0ea75a0f92723cda125ee21a747e34c8d1b36f16cf2d25acc3aa9d9e84c7abf08f73fa4195acc506491d6fc37cb9074528a7db87b9d69b21d5b5259ed3f2ef07dfec6cc90d3a37855d1ce122a85ba6a333f307d31537a849bef575cac3c6920fbce675c3b787136209f855de19ffe2e8d29b31a5ad86bf5fe4f7858f9b805bd8dcc05ad5e7fb889de2f822f3d8b41694e6c55c16b471",
+		expected: "",
+		name:     "vector 5: r changed",
+	}, {
+		input:    "8a3e7ad7b9b1b0cdc48e58d1e651fe6d710fef1420addeb61582bdd982d2b44c548886278e5ec26bed811dbb72db1e154b6f17be70deb1b210107decb1ec2a5ae93bfebd2f14f3d827ca32b464be6e69187f5edbd52def4f96599c37d58eee753dfb6f40f2471b29b77fdccba72d37c21bba019efa40c1c8f91ec405d7dcc5dff22f953f1e395a52ead7f3ae3fc47451b438117b1e04d613bc8555b7d6e6d1bb",
+		expected: "",
+		name:     "vector 6: q changed",
+	}, {
+		input:    "d80e9933e86769731ec16ff31e6821531bcf07fcbad9e2ac16ec9e6cb343a870288f7a1cd391842cce21f00e6f15471c04dc182fe4b14d92dc18910879799790247b3c4e89a3bcadfea73c7bfd361def43715fa382b8c3edf4ae15d6e55e997969b7667056e1e11d6caf6e45643f8b21e7a4bebda463c7fdbc13bc98efbd0214d3f9b12eb46c7c6fda0da3fc85bc1fd831557f9abc902a3be3cb3e8be7d1aa2f",
+		expected: "",
+		name:     "vector 7: message changed",
+	}, {
+		input:    "7c1048884558961c7e178b3a9b22583fca0d17f355a9887e2f96d363d2a776a3f5acb06c59c2b4927fb852faa07faf4b1852bbb5d06840935e849c4d293d1bad049dab79c89cc02f1484c437f523e080a75f134917fda752f2d5ca397addfe5dbf02cbcf6d8cc26e91766d8af0b164fc5968535e84c158eb3bc4e2d79c3cc682069ba6cb06b49d60812066afa16ecf7b51352f2c03bd93ec220822b1f3dfba03",
+		expected: "",
+		name:     "vector 8: s changed",
+	}, {
+		input:    "4c8d1afb724ad0c2ec458d866ac1dbb4497e273bbf05f88153102987e376fa7587b93ee2fecfda54deb8dff8e426f3c72c8864991f8ec2b3205bb3b416de93d24044a24df85be0cc76f21a4430b75b8e77b932a87f51e4eccbc45c263ebf8f66224a4d65b958f6d6afb2904863efd2a734b31798884801fcab5a590f4d6da9de178d51fddada62806f097aa615d33b8f2404e6b1479f5fd4859d595734d6d2b9",
+		expected: "",
+		name:     "vector 9: r changed",
+	}, {
+		input:    "",
+		expected: "",
+		name:     "empty input",
+	}, {
+		input:    "d1b8ef21eb4182ee270638061063a3f3c16c114e33937f69fb232cc833965a94bf96b99aa49c705c910be33142017c642ff540c76349b9dab72f981fd9347f4f17c55095819089c2e03b9cd415abdf12444e323075d98f31920b9e0f57ec871ce424dc61d4bb3cb7ef4344a7f8957a0c5134e16f7a67c074f82e6e12f49abf3c970eed7aa2bc48651545949de1dddaf0127e5965ac85d1243d6f60e7dfaee92700",
+		expected: "",
+		name:     "long input",
+	}, {
+		input:    "d1b8ef21eb4182ee270638061063a3f3c16c114e33937f69fb232cc833965a94000000000000000000000000000000000000000000000000000000000000000017c55095819089c2e03b9cd415abdf12444e323075d98f31920b9e0f57ec871ce424dc61d4bb3cb7ef4344a7f8957a0c5134e16f7a67c074f82e6e12f49abf3c970eed7aa2bc48651545949de1dddaf0127e5965ac85d1243d6f60e7dfaee927",
+		expected: "",
+		name:     "zero r",
+	}, {
+		input:    "d1b8ef21eb4182ee270638061063a3f3c16c114e33937f69fb232cc833965a94bf96b99aa49c705c910be33142017c642ff540c76349b9dab72f981fd9347f4f17c55095819089c2e03b9cd415abdf12444e323075d98f31920b9e0f57ec871c00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		expected: "",
+		name:     "point at infinity",
+	}, {
+		input:    "d1b8ef21eb4182ee270638061063a3f3c16c114e33937f69fb232cc833965a94bf96b99aa49c705c910be33142017c642ff540c76349b9dab72f981fd9347f4f17c55095819089c2e03b9cd415abdf12444e323075d98f31920b9e0f57ec871ce424dc61d4bb3cb7ef4344a7f8957a0c5134e16f7a67c074f82e6e12f49abf3c970eed7aa2bc48651545949de1dddaf0127e5965ac85d1243d6f60e7dfaee928",
+		expected: "",
+		name:     "point not on curve",
+	},
+}
+
+// sm3Tests are the test data for the SM3 precompile, from GM/T 0004-2012.
+var sm3Tests = []precompiledTest{
+	{
+		input:    "616263",
+		expected: "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0",
+		name:     "abc",
+	}, {
+		input:    "61626364616263646162636461626364616263646162636461626364616263646162636461626364616263646162636461626364616263646162636461626364",
+		expected: "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732",
+		name:     "abcd*16",
+	}, {
+		input:    "",
+		expected: "1ab21d8355cfa17f8e61194831e81a8f22bec8c728fefb747ed035eb5082aa2b",
+		name:     "empty",
+	},
+}
+
+// sm2VerifyTests are the test data for the SM2 signature verification precompile.
+// The signatures were made on the recommended sm2p256v1 curve with the
+// default ID by the reference implementation, the examples of GM/T 0003-2012
+// using a test curve.
+var sm2VerifyTests = []precompiledTest{
+	{
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd6862479a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d7bff31626a8162a1d6b9bffb89eaaf2d5043bc543cef8d260d4fac59e74a765be36d6aaebe03b7dd4423f8a10cfbe233d3bb47aa4fcb6c0b20cdedb36421d51e",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "vector 0",
+	}, {
+		input:    "924577c84905d9783466160f79b13a5670805095f000440033fb6d16b5d01d1dea2998c5d5b0d30cd5109add1ead2430fe8a183ad976666d8ad8c3116dc5a7d12f572317eda00d5750b62b3dcb2acbbbc8b72c7a0ec079653468b904b5a7d05b67f7166c457b66009e960ef74452975c721fd81bb9e70f49c75e98d61bcb2eb6e59ab1e4a245c4a7485d63b9c077e33f5a2be2c3bf7174870b99f95df6c6843d",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "vector 1",
+	}, {
+		input:    "81f9c322f232dae48de50442dde3ec4bfdb3063435b4e654004fc044a2f830b88e4b0c6b97ec9871ed39f791360cbb59473636a1653f660b48d408c192c54c5df28b5073fbb32eb325e216e42c5ad7a599d81bc6543e59b69597252f46336c2d13398cd156d324fe3d62198fe09e6449d0742659e97a524cd9e135c4545d590aff3d38a4cabc96716c93d398c9b09f258ea1df3794113fd219fd8103a96a0350",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "vector 2",
+	}, {
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd6862479a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e507bff31626a8162a1d6b9bffb89eaaf2d5043bc543cef8d260d4fac59e74a765be36d6aaebe03b7dd4423f8a10cfbe233d3bb47aa4fcb6c0b20cdedb36421d51e",
+		expected: "",
+		name:     "s changed",
+	}, {
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd6862479a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d67f7166c457b66009e960ef74452975c721fd81bb9e70f49c75e98d61bcb2eb6e59ab1e4a245c4a7485d63b9c077e33f5a2be2c3bf7174870b99f95df6c6843d",
+		expected: "",
+		name:     "other key",
+	}, {
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd6862479a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d7bff31626a8162a1d6b9bffb89eaaf2d5043bc543cef8d260d4fac59e74a765be36d6aaebe03b7dd4423f8a10cfbe233d3bb47aa4fcb6c0b20cdedb36421d510",
+		expected: "",
+		name:     "point not on curve",
+	}, {
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd6862479a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d7bff31626a8162a1d6b9bffb89eaaf2d5043bc543cef8d260d4fac59e74a765b",
+		expected: "",
+		name:     "short input",
+	},
+}
+
+// sm2RecoverTests are the test data for the SM2 public key recovery precompile,
+// with the signatures of sm2VerifyTests.
+var sm2RecoverTests = []precompiledTest{
+	{
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd68624000000000000000000000000000000000000000000000000000000000000001c79a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d",
+		expected: "7bff31626a8162a1d6b9bffb89eaaf2d5043bc543cef8d260d4fac59e74a765be36d6aaebe03b7dd4423f8a10cfbe233d3bb47aa4fcb6c0b20cdedb36421d51e",
+		name:     "vector 0",
+	}, {
+		input:    "924577c84905d9783466160f79b13a5670805095f000440033fb6d16b5d01d1d000000000000000000000000000000000000000000000000000000000000001cea2998c5d5b0d30cd5109add1ead2430fe8a183ad976666d8ad8c3116dc5a7d12f572317eda00d5750b62b3dcb2acbbbc8b72c7a0ec079653468b904b5a7d05b",
+		expected: "67f7166c457b66009e960ef74452975c721fd81bb9e70f49c75e98d61bcb2eb6e59ab1e4a245c4a7485d63b9c077e33f5a2be2c3bf7174870b99f95df6c6843d",
+		name:     "vector 1",
+	}, {
+		input:    "81f9c322f232dae48de50442dde3ec4bfdb3063435b4e654004fc044a2f830b8000000000000000000000000000000000000000000000000000000000000001b8e4b0c6b97ec9871ed39f791360cbb59473636a1653f660b48d408c192c54c5df28b5073fbb32eb325e216e42c5ad7a599d81bc6543e59b69597252f46336c2d",
+		expected: "13398cd156d324fe3d62198fe09e6449d0742659e97a524cd9e135c4545d590aff3d38a4cabc96716c93d398c9b09f258ea1df3794113fd219fd8103a96a0350",
+		name:     "vector 2",
+	}, {
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd68624000000000000000000000000000000000000000000000000000000000000001d79a3342bb4e47d6810ad224924024153f8066e44bb3d129d8eb6035d04fd2905154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d",
+		expected: "",
+		name:     "invalid v",
+	}, {
+		input:    "540529cace211e44caad17b411d9a371b022f69fe8cdb8b6fda42d641fd68624000000000000000000000000000000000000000000000000000000000000001c0000000000000000000000000000000000000000000000000000000000000000154508aaf8006aef7d7c8d796f5b27a9f68844a37444fee1b69c875f9c226e5d",
+		expected: "",
+		name:     "zero r",
+	}, {
+		input:    "000000000000000000000000000000000000000000000000000000000000001b",
+		expected: "",
+		name:     "empty signature",
+	},
+}
+
+// poseidonTests are the test data for the Poseidon precompile, the hashes of
+// circomlib.
+var poseidonTests = []precompiledTest{
+	{
+		input:    "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		expected: "2098f5fb9e239eab3ceac3f27b81e481dc3124d55ffed523a839ee8446b64864",
+		name:     "t3-zeros",
+	}, {
+		input:    "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002",
+		expected: "115cc0f5e7d690413df64c6b9662e9cf2a3617f2743245519e19607a4417189a",
+		name:     "t3",
+	}, {
+		input:    "000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000003",
+		expected: "0e7732d89e6939c0ff03d5e58dab6302f3230e269dc5b968f725df34ab36d732",
+		name:     "t4",
+	}, {
+		input:    "30644e72e131a029b85045b68181585d2833e84879b9709143e1f593f000000030644e72e131a029b85045b68181585d2833e84879b9709143e1f593f000000030644e72e131a029b85045b68181585d2833e84879b9709143e1f593f0000000",
+		expected: "294e7ab38f79bf9f691b3ab92039bbc5718f4c6b69c785cb44032662ea0111f2",
+		name:     "t4-max",
+	}, {
+		input:    "0000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000030000000000000000000000000000000000000000000000000000000000000004",
+		expected: "299c867db6c1fdd79dcefa40e4510b9837e60ebb1ce0663dbaa525df65250465",
+		name:     "t5",
+	}, {
+		input:    "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000300000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000005",
+		expected: "0dab9449e4a1398a15224c0b15a49d598b2174d305a316c918125f8feeb123c0",
+		name:     "t6",
+	},
+}
+
+// poseidonFailureTests are the failing test data for the Poseidon precompile.
+var poseidonFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errPoseidonInvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         "0000000000000000000000000000000000000000000000000000000000000001",
+		expectedError: errPoseidonInvalidInputLength,
+		name:          "t2",
+	}, {
+		input:         "000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000003000000000000000000000000000000000000000000000000000000000000000400000000000000000000000000000000000000000000000000000000000000050000000000000000000000000000000000000000000000000000000000000006",
+		expectedError: errPoseidonInvalidInputLength,
+		name:          "t7",
+	}, {
+		input:         "000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000",
+		expectedError: errPoseidonInvalidInputLength,
+		name:          "short input",
+	}, {
+		input:         "000000000000000000000000000000000000000000000000000000000000000130644e72e131a029b85045b68181585d2833e84879b9709143e1f593f0000001",
+		expectedError: errPoseidonInvalidFieldElement,
+		name:          "element out of range",
+	},
+}
+
+// BLS12-381 points and scalars of the EIP-2537 tests, in the encoding of the
+// EIP. The multiples of the generators were computed with an independent
+// implementation. bls12381G1Order3 is the point (0, 2), of order 3, and
+// bls12381G2NotInSubgroup an output of the SSWU map before the cofactor
+// clearing.
+const (
+	bls12381G1Generator     = "0000000000000000000000000000000017f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb0000000000000000000000000000000008b3f481e3aaa0f1a09e30ed741d8ae4fcf5e095d5d00af600db18cb2c04b3edd03cc744a2888ae40caa232946c5e7e1"
+	bls12381G1Double        = "000000000000000000000000000000000572cbea904d67468808c8eb50a9450c9721db309128012543902d0ac358a62ae28f75bb8f1c7c42c39a8c5529bf0f4e00000000000000000000000000000000166a9d8cabc673a322fda673779d8e3822ba3ecb8670e461f73bb9021d5fd76a4c56d9d4cd16bd1bba86881979749d28"
+	bls12381G1Triple        = "0000000000000000000000000000000009ece308f9d1f0131765212deca99697b112d61f9be9a5f1f3780a51335b3ff981747a0b2ca2179b96d2c0c9024e522400000000000000000000000000000000032b80d3a6f5b09f8a84623389c5f80ca69a0cddabc3097f9d9c27310fd43be6e745256c634af45ca3473b0590ae30d1"
+	bls12381G1NegGenerator  = "0000000000000000000000000000000017f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb00000000000000000000000000000000114d1d6855d545a8aa7d76c8cf2e21f267816aef1db507c96655b9d5caac42364e6f38ba0ecb751bad54dcd6b939c2ca"
+	bls12381G1Mul           = "000000000000000000000000000000000491d1b0ecd9bb917989f0e74f0dea0422eac4a873e5e2644f368dffb9a6e20fd6e10c1b77654d067c0618f6e5a7f79a0000000000000000000000000000000017cd7061575d3e8034fcea62adaa1a3bc38dca4b50e4c5c01d04dd78037c9cee914e17944ea99e7ad84278e5d49f36c4"
+	bls12381G1Zero          = "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+	bls12381G1Order3        = "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002"
+	bls12381G1Order3Neg     = "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaaa9"
+	bls12381G2Generator     = "00000000000000000000000000000000024aa2b2f08f0a91260805272dc51051c6e47ad4fa403b02b4510b647ae3d1770bac0326a805bbefd48056c8c121bdb80000000000000000000000000000000013e02b6052719f607dacd3a088274f65596bd0d09920b61ab5da61bbdc7f5049334cf11213945d57e5ac7d055d042b7e000000000000000000000000000000000ce5d527727d6e118cc9cdc6da2e351aadfd9baa8cbdd3a76d429a695160d12c923ac9cc3baca289e193548608b82801000000000000000000000000000000000606c4a02ea734cc32acd2b02bc28b99cb3e287e85a763af267492ab572e99ab3f370d275cec1da1aaa9075ff05f79be"
+	bls12381G2Double        = "000000000000000000000000000000001638533957d540a9d2370f17cc7ed5863bc0b995b8825e0ee1ea1e1e4d00dbae81f14b0bf3611b78c952aacab827a053000000000000000000000000000000000a4edef9c1ed7f729f520e47730a124fd70662a904ba1074728114d1031e1572c6c886f6b57ec72a6178288c47c33577000000000000000000000000000000000468fb440d82b0630aeb8dca2b5256789a66da69bf91009cbfe6bd221e47aa8ae88dece9764bf3bd999d95d71e4c9899000000000000000000000000000000000f6d4552fa65dd2638b361543f887136a43253d9c66c411697003f7a13c308f5422e1aa0a59c8967acdefd8b6e36ccf3"
+	bls12381G2Triple        = "00000000000000000000000000000000122915c824a0857e2ee414a3dccb23ae691ae54329781315a0c75df1c04d6d7a50a030fc866f09d516020ef82324afae0000000000000000000000000000000009380275bbc8e5dcea7dc4dd7e0550ff2ac480905396eda55062650f8d251c96eb480673937cc6d9d6a44aaa56ca66dc000000000000000000000000000000000b21da7955969e61010c7a1abc1a6f0136961d1e3b20b1a7326ac738fef5c721479dfd948b52fdf2455e44813ecfd8920000000000000000000000000000000008f239ba329b3967fe48d718a36cfe5f62a7e42e0bf1c1ed714150a166bfbd6bcf6b3b58b975b9edea56d53f23a0e849"
+	bls12381G2Mul           = "0000000000000000000000000000000014856c22d8cdb2967c720e963eedc999e738373b14172f06fc915769d3cc5ab7ae0a1b9c38f48b5585fb09d4bd2733bb000000000000000000000000000000000c400b70f6f8cd35648f5c126cce5417f3be4d8eefbd42ceb4286a14df7e03135313fe5845e3a575faab3e8b949d248800000000000000000000000000000000149a0aacc34beba2beb2f2a19a440166e76e373194714f108e4ab1c3fd331e80f4e73e6b9ea65fe3ec96d7136de81544000000000000000000000000000000000e4622fef26bdb9b1e8ef6591a7cc99f5b73164500c1ee224b6a761e676b8799b09a3fd4fa7e242645cc1a34708285e4"
+	bls12381G2Zero          = "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+	bls12381G2NotInSubgroup = "0000000000000000000000000000000018ed3794ad43c781816c523776188deafba67ab773189b8f18c49bc7aa841cd81525171f7a5203b2a340579192403bef000000000000000000000000000000000727d90785d179e7b5732c8a34b660335fed03b913710b60903cf4954b651ed3466dc3728e21855ae822d4a0f1d065870000000000000000000000000000000000764a5cf6c5f61c52c838523460eb2168b5a5b43705e19cb612e006f29b717897facfd15dd1c8874c915f6d53d0342d0000000000000000000000000000000019290bb9797c12c1d275817aa2605ebe42275b66860f0e4d04487ebc2e47c50b36edd86c685a60c20a2bd584a82b011a"
+	bls12381Scalar1         = "263dbd792f5b1be47ed85f8938c0f29586af0d3ac7b977f21c278fe1462040e3"
+	bls12381Scalar2         = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	bls12381FieldModulus    = "000000000000000000000000000000001a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaaab"
+)
+
+// bls12381G1AddTests are the test data for the BLS12-381 G1 addition precompile.
+var bls12381G1AddTests = []precompiledTest{
+	{
+		input:    bls12381G1Generator + bls12381G1Double,
+		expected: bls12381G1Triple,
+		name:     "g1+2g1",
+	}, {
+		input:    bls12381G1Generator + bls12381G1Zero,
+		expected: bls12381G1Generator,
+		name:     "g1+0",
+	}, {
+		input:    bls12381G1Generator + bls12381G1NegGenerator,
+		expected: bls12381G1Zero,
+		name:     "g1-g1",
+	}, {
+		input:    bls12381G1Order3 + bls12381G1Order3,
+		expected: bls12381G1Order3Neg,
+		name:     "not in subgroup",
+	},
+}
+
+// bls12381G1AddFailureTests are the malformed inputs of the BLS12-381 G1 addition precompile.
+var bls12381G1AddFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381G1Generator,
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "short input",
+	}, {
+		input:         "01" + bls12381G1Generator[2:] + bls12381G1Double,
+		expectedError: errBLS12381InvalidFieldElementTopBytes,
+		name:          "invalid top bytes",
+	},
+}
+
+// bls12381G1MultiExpTests are the test data for the BLS12-381 G1 multi scalar
+// multiplication precompile.
+var bls12381G1MultiExpTests = []precompiledTest{
+	{
+		input:    bls12381G1Generator + bls12381Scalar1,
+		expected: bls12381G1Mul,
+		name:     "g1*k1",
+	}, {
+		input:    bls12381G1Generator + bls12381Scalar1 + bls12381G1Double + bls12381Scalar2,
+		expected: "000000000000000000000000000000000616e476d8dbd5acb943c1a9f7872a0fcbda8df52191507b3f46f24ec730f5dfc41edf90f2744015a3ea6fa24c10e6cc000000000000000000000000000000000a2fd6efc2c8c9dbfcc9ba371d17720a4f140ce7c77c23f65af259cc54bf47e35c9d249bd7451e23f704e4ba236b9191",
+		name:     "g1*k1+2g1*k2",
+	}, {
+		input:    bls12381G1Zero + bls12381Scalar1,
+		expected: bls12381G1Zero,
+		name:     "0*k1",
+	}, {
+		input:    bls12381G1Generator + bls12381G1Zero[:64],
+		expected: bls12381G1Zero,
+		name:     "g1*0",
+	},
+}
+
+// bls12381G1MultiExpFailureTests are the malformed inputs of the BLS12-381 G1
+// multi scalar multiplication precompile.
+var bls12381G1MultiExpFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381G1Generator + bls12381Scalar1[2:],
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "short input",
+	}, {
+		input:         bls12381G1Order3 + bls12381Scalar1,
+		expectedError: errBLS12381G1PointSubgroup,
+		name:          "not in subgroup",
+	},
+}
+
+// bls12381G2AddTests are the test data for the BLS12-381 G2 addition precompile.
+var bls12381G2AddTests = []precompiledTest{
+	{
+		input:    bls12381G2Generator + bls12381G2Double,
+		expected: bls12381G2Triple,
+		name:     "g2+2g2",
+	}, {
+		input:    bls12381G2Zero + bls12381G2Generator,
+		expected: bls12381G2Generator,
+		name:     "0+g2",
+	},
+}
+
+// bls12381G2AddFailureTests are the malformed inputs of the BLS12-381 G2 addition precompile.
+var bls12381G2AddFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381G2Generator + bls12381G1Generator,
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "short input",
+	}, {
+		input:         bls12381G2Generator + bls12381G2Double[:128] + "01" + bls12381G2Double[130:],
+		expectedError: errBLS12381InvalidFieldElementTopBytes,
+		name:          "invalid top bytes",
+	},
+}
+
+// bls12381G2MultiExpTests are the test data for the BLS12-381 G2 multi scalar
+// multiplication precompile.
+var bls12381G2MultiExpTests = []precompiledTest{
+	{
+		input:    bls12381G2Generator + bls12381Scalar1,
+		expected: bls12381G2Mul,
+		name:     "g2*k1",
+	}, {
+		input:    bls12381G2Generator + bls12381Scalar1 + bls12381G2Double + bls12381Scalar2,
+		expected: "0000000000000000000000000000000003afde1b70db25b633dbab1b0a396c8fec96878734d28e8662e614f6a4f48009bf63aa91c75af02c65b818d1cf0f7cf0000000000000000000000000000000000a09651279b5d673d16a57ae3a691605936b540010895e4cdd72fc697d45416dfbf765d8e469db8128a2c51ee6fc5eb10000000000000000000000000000000005374979e18b82f74b86f420ef7b394a45b0c603a4be323f416c4e253896fa962603339b8639095b20e0e90dfce8ad9500000000000000000000000000000000114f7e9a6ba6ada17ad9f9fa60b0eceab685f15730f2ba1e83ffbdec7ce3978a54eceb8d6f5a28b548f6b26f8bcaba7f",
+		name:     "g2*k1+2g2*k2",
+	},
+}
+
+// bls12381G2MultiExpFailureTests are the malformed inputs of the BLS12-381 G2
+// multi scalar multiplication precompile.
+var bls12381G2MultiExpFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381G2NotInSubgroup + bls12381Scalar1,
+		expectedError: errBLS12381G2PointSubgroup,
+		name:          "not in subgroup",
+	},
+}
+
+// bls12381PairingTests are the test data for the BLS12-381 pairing check precompile.
+var bls12381PairingTests = []precompiledTest{
+	{
+		input:    bls12381G1Mul + bls12381G2Generator + bls12381G1NegGenerator + bls12381G2Mul,
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "e(k1*g1,g2)*e(-g1,k1*g2)",
+	}, {
+		input:    bls12381G1Mul + bls12381G2Generator + bls12381G1NegGenerator + bls12381G2Generator,
+		expected: "0000000000000000000000000000000000000000000000000000000000000000",
+		name:     "e(k1*g1,g2)*e(-g1,g2)",
+	}, {
+		input:    bls12381G1Zero + bls12381G2Generator,
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "e(0,g2)",
+	},
+}
+
+// bls12381PairingFailureTests are the malformed inputs of the BLS12-381 pairing
+// check precompile.
+var bls12381PairingFailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381G1Generator + bls12381G2Generator[2:],
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "short input",
+	}, {
+		input:         bls12381G1Order3 + bls12381G2Generator,
+		expectedError: errBLS12381G1PointSubgroup,
+		name:          "g1 not in subgroup",
+	}, {
+		input:         bls12381G1Generator + bls12381G2NotInSubgroup,
+		expectedError: errBLS12381G2PointSubgroup,
+		name:          "g2 not in subgroup",
+	},
+}
+
+// bls12381MapG1Tests are the test data for the BLS12-381 field element to G1
+// precompile, from the BLS12381G1_XMD:SHA-256_SSWU_NU_ suite of the hash to
+// curve specification.
+var bls12381MapG1Tests = []precompiledTest{
+	{
+		input:    "00000000000000000000000000000000156c8a6a2c184569d69a76be144b5cdc5141d2d2ca4fe341f011e25e3969c55ad9e9b9ce2eb833c81a908e5fa4ac5f03",
+		expected: "00000000000000000000000000000000184bb665c37ff561a89ec2122dd343f20e0f4cbcaec84e3c3052ea81d1834e192c426074b02ed3dca4e7676ce4ce48ba0000000000000000000000000000000004407b8d35af4dacc809927071fc0405218f1401a6d15af775810e4e460064bcc9468beeba82fdc751be70476c888bf3",
+		name:     "vector 0",
+	}, {
+		input:    "00000000000000000000000000000000147e1ed29f06e4c5079b9d14fc89d2820d32419b990c1c7bb7dbea2a36a045124b31ffbde7c99329c05c559af1c6cc82",
+		expected: "00000000000000000000000000000000009769f3ab59bfd551d53a5f846b9984c59b97d6842b20a2c565baa167945e3d026a3755b6345df8ec7e6acb6868ae6d000000000000000000000000000000001532c00cf61aa3d0ce3e5aa20c3b531a2abd2c770a790a2613818303c6b830ffc0ecf6c357af3317b9575c567f11cd2c",
+		name:     "vector 1",
+	}, {
+		input:    "0000000000000000000000000000000004090815ad598a06897dd89bcda860f25837d54e897298ce31e6947378134d3761dc59a572154963e8c954919ecfa82d",
+		expected: "000000000000000000000000000000001974dbb8e6b5d20b84df7e625e2fbfecb2cdb5f77d5eae5fb2955e5ce7313cae8364bc2fff520a6c25619739c6bdcb6a0000000000000000000000000000000015f9897e11c6441eaa676de141c8d83c37aab8667173cbe1dfd6de74d11861b961dccebcd9d289ac633455dfcc7013a3",
+		name:     "vector 2",
+	}, {
+		input:    "0000000000000000000000000000000008dccd088ca55b8bfbc96fb50bb25c592faa867a8bb78d4e94a8cc2c92306190244532e91feba2b7fed977e3c3bb5a1f",
+		expected: "000000000000000000000000000000000a7a047c4a8397b3446450642c2ac64d7239b61872c9ae7a59707a8f4f950f101e766afe58223b3bff3a19a7f754027c000000000000000000000000000000001383aebba1e4327ccff7cf9912bda0dbc77de048b71ef8c8a81111d71dc33c5e3aa6edee9cf6f5fe525d50cc50b77cc9",
+		name:     "vector 3",
+	}, {
+		input:    "000000000000000000000000000000000dd824886d2123a96447f6c56e3a3fa992fbfefdba17b6673f9f630ff19e4d326529db37e1c1be43f905bf9202e0278d",
+		expected: "000000000000000000000000000000000e7a16a975904f131682edbb03d9560d3e48214c9986bd50417a77108d13dc957500edf96462a3d01e62dc6cd468ef11000000000000000000000000000000000ae89e677711d05c30a48d6d75e76ca9fb70fe06c6dd6ff988683d89ccde29ac7d46c53bb97a59b1901abf1db66052db",
+		name:     "vector 4",
+	},
+}
+
+// bls12381MapG1FailureTests are the malformed inputs of the BLS12-381 field
+// element to G1 precompile.
+var bls12381MapG1FailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381Scalar1 + bls12381Scalar1 + "00",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "long input",
+	}, {
+		input:         "01" + bls12381FieldModulus[2:],
+		expectedError: errBLS12381InvalidFieldElementTopBytes,
+		name:          "invalid top bytes",
+	},
+}
+
+// bls12381MapG2Tests are the test data for the BLS12-381 Fp2 element to G2
+// precompile, from the BLS12381G2_XMD:SHA-256_SSWU_NU_ suite of the hash to
+// curve specification.
+var bls12381MapG2Tests = []precompiledTest{
+	{
+		input:    "0000000000000000000000000000000007355d25caf6e7f2f0cb2812ca0e513bd026ed09dda65b177500fa31714e09ea0ded3a078b526bed3307f804d4b93b040000000000000000000000000000000002829ce3c021339ccb5caf3e187f6370e1e2a311dec9b75363117063ab2015603ff52c3d3b98f19c2f65575e99e8b78c",
+		expected: "0000000000000000000000000000000000e7f4568a82b4b7dc1f14c6aaa055edf51502319c723c4dc2688c7fe5944c213f510328082396515734b6612c4e7bb700000000000000000000000000000000126b855e9e69b1f691f816e48ac6977664d24d99f8724868a184186469ddfd4617367e94527d4b74fc86413483afb35b000000000000000000000000000000000caead0fd7b6176c01436833c79d305c78be307da5f6af6c133c47311def6ff1e0babf57a0fb5539fce7ee12407b0a42000000000000000000000000000000001498aadcf7ae2b345243e281ae076df6de84455d766ab6fcdaad71fab60abb2e8b980a440043cd305db09d283c895e3d",
+		name:     "vector 0",
+	}, {
+		input:    "00000000000000000000000000000000138879a9559e24cecee8697b8b4ad32cced053138ab913b99872772dc753a2967ed50aabc907937aefb2439ba06cc50c000000000000000000000000000000000a1ae7999ea9bab1dcc9ef8887a6cb6e8f1e22566015428d220b7eec90ffa70ad1f624018a9ad11e78d588bd3617f9f2",
+		expected: "00000000000000000000000000000000108ed59fd9fae381abfd1d6bce2fd2fa220990f0f837fa30e0f27914ed6e1454db0d1ee957b219f61da6ff8be0d6441f000000000000000000000000000000000296238ea82c6d4adb3c838ee3cb2346049c90b96d602d7bb1b469b905c9228be25c627bffee872def773d5b2a2eb57d00000000000000000000000000000000033f90f6057aadacae7963b0a0b379dd46750c1c94a6357c99b65f63b79e321ff50fe3053330911c56b6ceea08fee65600000000000000000000000000000000153606c417e59fb331b7ae6bce4fbf7c5190c33ce9402b5ebe2b70e44fca614f3f1382a3625ed5493843d0b0a652fc3f",
+		name:     "vector 1",
+	}, {
+		input:    "0000000000000000000000000000000018c16fe362b7dbdfa102e42bdfd3e2f4e6191d479437a59db4eb716986bf08ee1f42634db66bde97d6c16bbfd342b3b8000000000000000000000000000000000e37812ce1b146d998d5f92bdd5ada2a31bfd63dfe18311aa91637b5f279dd045763166aa1615e46a50d8d8f475f184e",
+		expected: "00000000000000000000000000000000038af300ef34c7759a6caaa4e69363cafeed218a1f207e93b2c70d91a1263d375d6730bd6b6509dcac3ba5b567e85bf3000000000000000000000000000000000da75be60fb6aa0e9e3143e40c42796edf15685cafe0279afd2a67c3dff1c82341f17effd402e4f1af240ea90f4b659b0000000000000000000000000000000019b148cbdf163cf0894f29660d2e7bfb2b68e37d54cc83fd4e6e62c020eaa48709302ef8e746736c0e19342cc1ce3df4000000000000000000000000000000000492f4fed741b073e5a82580f7c663f9b79e036b70ab3e51162359cec4e77c78086fe879b65ca7a47d34374c8315ac5e",
+		name:     "vector 2",
+	}, {
+		input:    "0000000000000000000000000000000008d4a0997b9d52fecf99427abb721f0fa779479963315fe21c6445250de7183e3f63bfdf86570da8929489e421d4ee950000000000000000000000000000000016cb4ccad91ec95aab070f22043916cd6a59c4ca94097f7f510043d48515526dc8eaaea27e586f09151ae613688d5a89",
+		expected: "000000000000000000000000000000000c5ae723be00e6c3f0efe184fdc0702b64588fe77dda152ab13099a3bacd3876767fa7bbad6d6fd90b3642e902b208f90000000000000000000000000000000012c8c05c1d5fc7bfa847f4d7d81e294e66b9a78bc9953990c358945e1f042eedafce608b67fdd3ab0cb2e6e263b9b1ad0000000000000000000000000000000004e77ddb3ede41b5ec4396b7421dd916efc68a358a0d7425bddd253547f2fb4830522358491827265dfc5bcc1928a5690000000000000000000000000000000011c624c56dbe154d759d021eec60fab3d8b852395a89de497e48504366feedd4662d023af447d66926a28076813dd646",
+		name:     "vector 3",
+	}, {
+		input:    "0000000000000000000000000000000003f80ce4ff0ca2f576d797a3660e3f65b274285c054feccc3215c879e2c0589d376e83ede13f93c32f05da0f68fd6a1000000000000000000000000000000000006488a837c5413746d868d1efb7232724da10eca410b07d8b505b9363bdccf0a1fc0029bad07d65b15ccfe6dd25e20d",
+		expected: "000000000000000000000000000000000ea4e7c33d43e17cc516a72f76437c4bf81d8f4eac69ac355d3bf9b71b8138d55dc10fd458be115afa798b55dac34be1000000000000000000000000000000001565c2f625032d232f13121d3cfb476f45275c303a037faa255f9da62000c2c864ea881e2bcddd111edc4a3c0da3e88d00000000000000000000000000000000043b6f5fe4e52c839148dc66f2b3751e69a0f6ebb3d056d6465d50d4108543ecd956e10fa1640dfd9bc0030cc2558d28000000000000000000000000000000000f8991d2a1ad662e7b6f58ab787947f1fa607fce12dde171bc17903b012091b657e15333e11701edcf5b63ba2a561247",
+		name:     "vector 4",
+	},
+}
+
+// bls12381MapG2FailureTests are the malformed inputs of the BLS12-381 Fp2
+// element to G2 precompile.
+var bls12381MapG2FailureTests = []precompiledFailureTest{
+	{
+		input:         "",
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "empty input",
+	}, {
+		input:         bls12381FieldModulus,
+		expectedError: errBLS12381InvalidInputLength,
+		name:          "short input",
+	},
+}
+
+// precompiledContract returns the precompiled contract at addr in the
+// largest default sets.
+func precompiledContract(addr string) PrecompiledContract {
+	for _, contracts := range []map[types.Address]PrecompiledContract{PrecompiledContractsEIP152, PrecompiledContractsEIP2537, PrecompiledContractsRIP7212, PrecompiledContractsSMCrypto, PrecompiledContractsPoseidon} {
+		if p, ok := contracts[util.HexToAddress(addr)]; ok {
+			return p
+		}
+	}
+	return PrecompiledContractsByzantium[util.HexToAddress(addr)]
+}
+
 func testPrecompiled(addr string, test precompiledTest, t *testing.T) {
-	p := PrecompiledContractsByzantium[util.HexToAddress(addr)]
+	p := precompiledContract(addr)
 	in := util.Hex2Bytes(test.input)
 	contract := NewContract(AccountRef(util.HexToAddress("1337")),
 		nil, new(big.Int), p.RequiredGas(in))
@@ -350,11 +919,24 @@ func testPrecompiled(addr string, test precompiledTest, t *testing.T) {
 	})
 }
 
+func testPrecompiledFailure(addr string, test precompiledFailureTest, t *testing.T) {
+	p := precompiledContract(addr)
+	in := util.Hex2Bytes(test.input)
+	contract := NewContract(AccountRef(util.HexToAddress("1337")),
+		nil, new(big.Int), p.RequiredGas(in))
+	t.Run(test.name, func(t *testing.T) {
+		_, err := RunPrecompiledContract(p, in, contract)
+		if err != test.expectedError {
+			t.Errorf("Expected error %v, got %v", test.expectedError, err)
+		}
+	})
+}
+
 func benchmarkPrecompiled(addr string, test precompiledTest, bench *testing.B) {
 	if test.noBenchmark {
 		return
 	}
-	p := PrecompiledContractsByzantium[util.HexToAddress(addr)]
+	p := precompiledContract(addr)
 	in := util.Hex2Bytes(test.input)
 	reqGas := p.RequiredGas(in)
 	contract := NewContract(AccountRef(util.HexToAddress("1337")),
@@ -426,6 +1008,74 @@ func BenchmarkPrecompiledIdentity(bench *testing.B) {
 	benchmarkPrecompiled("04", t, bench)
 }
 
+// Tests the sample inputs of the secp256r1 signature verification RIP 7212.
+func TestPrecompiledP256Verify(t *testing.T) {
+	for _, test := range p256VerifyTests {
+		testPrecompiled("0100", test, t)
+	}
+}
+
+// Benchmarks the sample inputs of the secp256r1 signature verification RIP 7212.
+func BenchmarkPrecompiledP256Verify(bench *testing.B) {
+	for _, test := range p256VerifyTests {
+		benchmarkPrecompiled("0100", test, bench)
+	}
+}
+
+// Tests the sample inputs of the SM3 hash.
+func TestPrecompiledSm3(t *testing.T) {
+	for _, test := range sm3Tests {
+		testPrecompiled("0201", test, t)
+	}
+}
+
+// Tests the sample inputs of the SM2 signature verification.
+func TestPrecompiledSm2Verify(t *testing.T) {
+	for _, test := range sm2VerifyTests {
+		testPrecompiled("0202", test, t)
+	}
+}
+
+// Tests the sample inputs of the SM2 public key recovery.
+func TestPrecompiledSm2Recover(t *testing.T) {
+	for _, test := range sm2RecoverTests {
+		testPrecompiled("0203", test, t)
+	}
+}
+
+// Benchmarks the sample inputs of the SM2 public key recovery.
+func BenchmarkPrecompiledSm2Recover(bench *testing.B) {
+	for _, test := range sm2RecoverTests {
+		benchmarkPrecompiled("0203", test, bench)
+	}
+}
+
+// Tests the Poseidon precompile and its pricing by width.
+func TestPrecompiledPoseidon(t *testing.T) {
+	for i, test := range poseidonTests {
+		testPrecompiled("0300", test, t)
+
+		gas := precompiledContract("0300").RequiredGas(util.Hex2Bytes(test.input))
+		want := []uint64{params.PoseidonT3Gas, params.PoseidonT4Gas, params.PoseidonT5Gas, params.PoseidonT6Gas}[len(test.input)/64-2]
+		if gas != want {
+			t.Errorf("test %d: expected gas %d, got %d", i, want, gas)
+		}
+	}
+}
+
+func TestPrecompiledPoseidonFailure(t *testing.T) {
+	for _, test := range poseidonFailureTests {
+		testPrecompiledFailure("0300", test, t)
+	}
+}
+
+// Benchmarks the Poseidon precompile.
+func BenchmarkPrecompiledPoseidon(bench *testing.B) {
+	for _, test := range poseidonTests {
+		benchmarkPrecompiled("0300", test, bench)
+	}
+}
+
 // Tests the sample inputs from the ModExp EIP 198.
 func TestPrecompiledModExp(t *testing.T) {
 	for _, test := range modexpTests {
@@ -440,6 +1090,176 @@ func BenchmarkPrecompiledModExp(bench *testing.B) {
 	}
 }
 
+// modexpGas are the prices of the modexp test data before and after EIP 2565.
+var modexpGas = map[string][2]uint64{
+	"eip_example1":          {13056, 1360},
+	"eip_example2":          {13056, 1360},
+	"nagydani-1-square":     {204, 200},
+	"nagydani-1-qube":       {204, 200},
+	"nagydani-1-pow0x10001": {3276, 341},
+	"nagydani-2-square":     {665, 200},
+	"nagydani-2-qube":       {665, 200},
+	"nagydani-2-pow0x10001": {10649, 1365},
+	"nagydani-3-square":     {1894, 341},
+	"nagydani-3-qube":       {1894, 341},
+	"nagydani-3-pow0x10001": {30310, 5461},
+	"nagydani-4-square":     {5580, 1365},
+	"nagydani-4-qube":       {5580, 1365},
+	"nagydani-4-pow0x10001": {89292, 21845},
+	"nagydani-5-square":     {17868, 5461},
+	"nagydani-5-qube":       {17868, 5461},
+	"nagydani-5-pow0x10001": {285900, 87381},
+}
+
+// modexpInput returns the modexp input of the given operands.
+func modexpInput(base, exp, mod []byte) []byte {
+	input := make([]byte, 96, 96+len(base)+len(exp)+len(mod))
+	new(big.Int).SetInt64(int64(len(base))).FillBytes(input[:32])
+	new(big.Int).SetInt64(int64(len(exp))).FillBytes(input[32:64])
+	new(big.Int).SetInt64(int64(len(mod))).FillBytes(input[64:96])
+	input = append(input, base...)
+	input = append(input, exp...)
+	return append(input, mod...)
+}
+
+// Tests the pricing of the modexp sample inputs by EIP 198 and EIP 2565, and
+// that both variants compute the same results.
+func TestPrecompiledModExpGas(t *testing.T) {
+	eip2565 := PrecompiledContractsEIP2565[util.BytesToAddress([]byte{5})]
+	for _, test := range modexpTests {
+		in := util.Hex2Bytes(test.input)
+		if gas := precompiledContract("05").RequiredGas(in); gas != modexpGas[test.name][0] {
+			t.Errorf("%s: expected gas %d, got %d", test.name, modexpGas[test.name][0], gas)
+		}
+		if gas := eip2565.RequiredGas(in); gas != modexpGas[test.name][1] {
+			t.Errorf("%s: expected EIP 2565 gas %d, got %d", test.name, modexpGas[test.name][1], gas)
+		}
+		if res, err := eip2565.Run(in); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if util.Bytes2Hex(res) != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, util.Bytes2Hex(res))
+		}
+	}
+	// Huge operands are priced out of reach
+	huge := util.Hex2Bytes("00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	if gas := eip2565.RequiredGas(huge); gas != math.MaxUint64 {
+		t.Errorf("expected gas %d for a huge modulus, got %d", uint64(math.MaxUint64), gas)
+	}
+}
+
+// Tests the results of the modexp shortcuts and the bounds on the operands,
+// which only apply after EIP 7823.
+func TestPrecompiledModExpEdgeCases(t *testing.T) {
+	var (
+		legacy  = precompiledContract("05")
+		eip2565 = PrecompiledContractsEIP2565[util.BytesToAddress([]byte{5})]
+		eip7823 = PrecompiledContractsEIP7823[util.BytesToAddress([]byte{5})]
+		long    = make([]byte, 1025)
+	)
+	long[0] = 1
+	for _, test := range []struct {
+		name     string
+		input    []byte
+		expected string
+		err      error
+		errEIP   error
+	}{
+		{name: "empty", input: nil, expected: ""},
+		{name: "no modulus", input: modexpInput([]byte{2}, []byte{3}, nil), expected: ""},
+		{name: "zero modulus", input: modexpInput([]byte{2}, []byte{3}, []byte{0, 0}), expected: "0000"},
+		{name: "unit modulus", input: modexpInput([]byte{2}, []byte{3}, []byte{0, 1}), expected: "0000"},
+		{name: "zero exponent", input: modexpInput([]byte{2}, nil, []byte{0, 5}), expected: "0001"},
+		{name: "zero base zero exponent", input: modexpInput(nil, []byte{0}, []byte{0, 5}), expected: "0001"},
+		{name: "zero base", input: modexpInput([]byte{0}, []byte{3}, []byte{0, 5}), expected: "0000"},
+		{name: "short input", input: modexpInput([]byte{2}, []byte{3}, []byte{0, 5})[:99], expected: "0000"},
+		{name: "long modulus", input: modexpInput([]byte{2}, []byte{3}, long), expected: util.Bytes2Hex(append(make([]byte, 1024), 8)), errEIP: errModExpInputTooLarge},
+		{name: "long exponent", input: modexpInput([]byte{2}, long, []byte{5}), expected: "01", errEIP: errModExpInputTooLarge},
+		{
+			name:     "huge exponent length",
+			input:    util.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff0000000000000000000000000000000000000000000000000000000000000000"),
+			expected: "",
+			errEIP:   errModExpInputTooLarge,
+		}, {
+			name:   "huge modulus length",
+			input:  util.Hex2Bytes("00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+			err:    errModExpInputTooLarge,
+			errEIP: errModExpInputTooLarge,
+		}, {
+			name:   "overflowing lengths",
+			input:  util.Hex2Bytes("000000000000000000000000000000000000000000000000ffffffffffffffff000000000000000000000000000000000000000000000000ffffffffffffffff0000000000000000000000000000000000000000000000000000000000000001"),
+			err:    errModExpInputTooLarge,
+			errEIP: errModExpInputTooLarge,
+		},
+	} {
+		for _, p := range []PrecompiledContract{legacy, eip2565} {
+			res, err := p.Run(test.input)
+			if err != test.err {
+				t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+			} else if err == nil && util.Bytes2Hex(res) != test.expected {
+				t.Errorf("%s: expected %v, got %v", test.name, test.expected, util.Bytes2Hex(res))
+			}
+		}
+		errEIP := test.errEIP
+		if errEIP == nil {
+			errEIP = test.err
+		}
+		res, err := eip7823.Run(test.input)
+		if err != errEIP {
+			t.Errorf("%s: expected EIP 7823 error %v, got %v", test.name, errEIP, err)
+		} else if err == nil && util.Bytes2Hex(res) != test.expected {
+			t.Errorf("%s: expected EIP 7823 result %v, got %v", test.name, test.expected, util.Bytes2Hex(res))
+		}
+	}
+}
+
+// Fuzzes the modexp operands against the big integer exponentiation.
+func FuzzPrecompiledModExp(f *testing.F) {
+	f.Add([]byte{}, []byte{}, []byte{})
+	f.Add([]byte{2}, []byte{}, []byte{1})
+	f.Add([]byte{0}, []byte{0}, []byte{0})
+	f.Add([]byte{3}, []byte{0xff, 0xff}, []byte{0, 0, 1})
+	for _, test := range modexpTests {
+		in := util.Hex2Bytes(test.input)
+		var (
+			baseLen = new(big.Int).SetBytes(in[:32]).Uint64()
+			expLen  = new(big.Int).SetBytes(in[32:64]).Uint64()
+		)
+		in = in[96:]
+		f.Add(in[:baseLen], in[baseLen:baseLen+expLen], in[baseLen+expLen:])
+	}
+	var (
+		legacy  = &bigModExp{}
+		eip2565 = &bigModExp{eip2565: true}
+	)
+	f.Fuzz(func(t *testing.T, base, exp, mod []byte) {
+		if len(base) > 256 || len(exp) > 256 || len(mod) > 256 {
+			return
+		}
+		expected := []byte{}
+		if m := new(big.Int).SetBytes(mod); len(mod) > 0 {
+			res := new(big.Int)
+			if m.Sign() != 0 {
+				res.Exp(new(big.Int).SetBytes(base), new(big.Int).SetBytes(exp), m)
+			}
+			expected = make([]byte, len(mod))
+			res.FillBytes(expected)
+		}
+		in := modexpInput(base, exp, mod)
+		for _, p := range []*bigModExp{legacy, eip2565} {
+			res, err := p.Run(in)
+			if err != nil {
+				t.Fatalf("eip2565=%v: %v", p.eip2565, err)
+			}
+			if !bytes.Equal(res, expected) {
+				t.Fatalf("eip2565=%v: expected %x, got %x", p.eip2565, expected, res)
+			}
+			if p.RequiredGas(in) == 0 && p.eip2565 {
+				t.Fatal("expected a minimum price")
+			}
+		}
+	})
+}
+
 // Tests the sample inputs from the elliptic curve addition EIP 213.
 func TestPrecompiledBn256Add(t *testing.T) {
 	for _, test := range bn256AddTests {
@@ -481,3 +1301,111 @@ func BenchmarkPrecompiledBn256Pairing(bench *testing.B) {
 		benchmarkPrecompiled("08", test, bench)
 	}
 }
+
+// Tests the sample inputs of the BLAKE2b F compression EIP 152.
+func TestPrecompiledBlake2F(t *testing.T) {
+	for _, test := range blake2FTests {
+		testPrecompiled("09", test, t)
+	}
+}
+
+// Tests the malformed inputs of the BLAKE2b F compression EIP 152.
+func TestPrecompiledBlake2FFailure(t *testing.T) {
+	for _, test := range blake2FFailureTests {
+		testPrecompiledFailure("09", test, t)
+	}
+}
+
+// Benchmarks the sample inputs of the BLAKE2b F compression EIP 152.
+func BenchmarkPrecompiledBlake2F(bench *testing.B) {
+	for _, test := range blake2FTests {
+		benchmarkPrecompiled("09", test, bench)
+	}
+}
+
+// Tests the sample inputs of the BLS12-381 precompiles of EIP 2537.
+func TestPrecompiledBLS12381(t *testing.T) {
+	for _, suite := range []struct {
+		addr  string
+		tests []precompiledTest
+	}{
+		{"0b", bls12381G1AddTests},
+		{"0c", bls12381G1MultiExpTests},
+		{"0d", bls12381G2AddTests},
+		{"0e", bls12381G2MultiExpTests},
+		{"0f", bls12381PairingTests},
+		{"10", bls12381MapG1Tests},
+		{"11", bls12381MapG2Tests},
+	} {
+		for _, test := range suite.tests {
+			testPrecompiled(suite.addr, test, t)
+		}
+	}
+}
+
+// Tests the malformed inputs of the BLS12-381 precompiles of EIP 2537.
+func TestPrecompiledBLS12381Failure(t *testing.T) {
+	for _, suite := range []struct {
+		addr  string
+		tests []precompiledFailureTest
+	}{
+		{"0b", bls12381G1AddFailureTests},
+		{"0c", bls12381G1MultiExpFailureTests},
+		{"0d", bls12381G2AddFailureTests},
+		{"0e", bls12381G2MultiExpFailureTests},
+		{"0f", bls12381PairingFailureTests},
+		{"10", bls12381MapG1FailureTests},
+		{"11", bls12381MapG2FailureTests},
+	} {
+		for _, test := range suite.tests {
+			testPrecompiledFailure(suite.addr, test, t)
+		}
+	}
+	// Points off the curve and field elements out of range are rejected by
+	// the curve implementation.
+	for _, test := range []struct{ addr, input string }{
+		{"0b", bls12381G1Generator + bls12381G1Generator[:254] + "bc"},
+		{"0d", bls12381G2Generator[:510] + "bf" + bls12381G2Generator},
+		{"10", bls12381FieldModulus},
+		{"11", bls12381FieldModulus + bls12381Scalar1 + bls12381Scalar1},
+	} {
+		p := PrecompiledContractsEIP2537[util.HexToAddress(test.addr)]
+		if _, err := p.Run(util.Hex2Bytes(test.input)); err == nil {
+			t.Errorf("%s: expected an error for the invalid input %s", test.addr, test.input)
+		}
+	}
+}
+
+// Tests the gas pricing of the BLS12-381 precompiles of EIP 2537.
+func TestPrecompiledBLS12381Gas(t *testing.T) {
+	for _, test := range []struct {
+		addr     string
+		inputLen int
+		gas      uint64
+	}{
+		{"0b", 256, 375},
+		{"0c", 0, 0},
+		{"0c", 160, 12000},
+		{"0c", 2 * 160, 2 * 12000 * 949 / 1000},
+		{"0c", 200 * 160, 200 * 12000 * 519 / 1000},
+		{"0d", 512, 600},
+		{"0e", 288, 22500},
+		{"0e", 2 * 288, 2 * 22500},
+		{"0e", 128 * 288, 128 * 22500 * 524 / 1000},
+		{"0f", 2 * 384, 2*32600 + 37700},
+		{"10", 64, 5500},
+		{"11", 128, 23800},
+	} {
+		p := PrecompiledContractsEIP2537[util.HexToAddress(test.addr)]
+		if gas := p.RequiredGas(make([]byte, test.inputLen)); gas != test.gas {
+			t.Errorf("%s with %d bytes: expected gas %d, got %d", test.addr, test.inputLen, test.gas, gas)
+		}
+	}
+}
+
+// Benchmarks the sample inputs of the BLS12-381 pairing check EIP 2537.
+func BenchmarkPrecompiledBLS12381Pairing(bench *testing.B) {
+	for _, test := range bls12381PairingTests {
+		benchmarkPrecompiled("0f", test, bench)
+	}
+}
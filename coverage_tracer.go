@@ -0,0 +1,197 @@
+package evm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+)
+
+// CoverageTracer is a Tracer recording how often every instruction has been
+// executed, per code hash, aggregated over all traced transactions. Using
+// the source maps of compiler artifacts the coverage can be written as an
+// LCOV report of the source files.
+type CoverageTracer struct {
+	codes map[types.Hash][]byte
+	hits  map[types.Hash]map[uint64]uint64
+
+	contract *Contract         // contract of the last step
+	current  map[uint64]uint64 // hits of the code of contract
+}
+
+// NewCoverageTracer returns a new coverage tracer.
+func NewCoverageTracer() *CoverageTracer {
+	return &CoverageTracer{
+		codes: make(map[types.Hash][]byte),
+		hits:  make(map[types.Hash]map[uint64]uint64),
+	}
+}
+
+// Reset discards the recorded coverage.
+func (t *CoverageTracer) Reset() {
+	t.codes = make(map[types.Hash][]byte)
+	t.hits = make(map[types.Hash]map[uint64]uint64)
+	t.contract, t.current = nil, nil
+}
+
+// CaptureTxStart implements the Tracer interface.
+func (t *CoverageTracer) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (t *CoverageTracer) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureStart implements the Tracer interface.
+func (t *CoverageTracer) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface.
+func (t *CoverageTracer) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (t *CoverageTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface to count the execution of
+// the instruction.
+func (t *CoverageTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if contract != t.contract {
+		// The code hash isn't known for the init code of creations.
+		hash := contract.CodeHash
+		if hash == (types.Hash{}) {
+			hash = crypto.Keccak256Hash(contract.Code)
+		}
+		if t.hits[hash] == nil {
+			t.codes[hash] = contract.Code
+			t.hits[hash] = make(map[uint64]uint64)
+		}
+		t.contract, t.current = contract, t.hits[hash]
+	}
+	t.current[pc]++
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *CoverageTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (t *CoverageTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	t.contract, t.current = nil, nil
+	return nil
+}
+
+// Code returns the executed code of a code hash.
+func (t *CoverageTracer) Code(hash types.Hash) []byte { return t.codes[hash] }
+
+// Hits returns how often the instructions of the code of a code hash have
+// been executed, by pc.
+func (t *CoverageTracer) Hits(hash types.Hash) map[uint64]uint64 { return t.hits[hash] }
+
+// LineHits maps the executed code to the lines of the source files of the
+// artifacts, returning how often each line has been executed by file name.
+// Runtime code is matched exactly and creation code by prefix, as it is
+// followed by the constructor arguments. Lines are attributed the hits of
+// the most executed instruction whose source range starts on them.
+func (t *CoverageTracer) LineHits(artifacts ...*CompilerArtifact) map[string]map[int]uint64 {
+	lines := make(map[string]map[int]uint64)
+	for _, artifact := range artifacts {
+		for _, contract := range artifact.Contracts {
+			var (
+				creation = t.matchCode(contract.Code, true)
+				runtime  = t.matchCode(contract.RuntimeCode, false)
+			)
+			t.addLines(lines, artifact, contract.Code, contract.SourceMap, creation)
+			t.addLines(lines, artifact, contract.RuntimeCode, contract.RuntimeSrcMap, runtime)
+		}
+	}
+	return lines
+}
+
+// matchCode returns the hits of all executed code matching compiled code.
+func (t *CoverageTracer) matchCode(code []byte, prefix bool) []map[uint64]uint64 {
+	if len(code) == 0 {
+		return nil
+	}
+	var matches []map[uint64]uint64
+	for hash, executed := range t.codes {
+		if bytes.Equal(executed, code) || (prefix && bytes.HasPrefix(executed, code)) {
+			matches = append(matches, t.hits[hash])
+		}
+	}
+	return matches
+}
+
+// addLines adds the lines of the instructions of compiled code, with the
+// hits of the matching executed code.
+func (t *CoverageTracer) addLines(lines map[string]map[int]uint64, artifact *CompilerArtifact, code []byte, srcmap []SourceMapEntry, matches []map[uint64]uint64) {
+	if len(code) == 0 {
+		return
+	}
+	for i, pc := range instructionPcs(code) {
+		if i >= len(srcmap) {
+			break
+		}
+		file, ok := artifact.Sources[srcmap[i].File]
+		if !ok || file.Content == nil {
+			continue
+		}
+		var hits uint64
+		for _, match := range matches {
+			hits += match[pc]
+		}
+		if lines[file.Name] == nil {
+			lines[file.Name] = make(map[int]uint64)
+		}
+		line := file.line(srcmap[i].Offset)
+		if prev, ok := lines[file.Name][line]; !ok || hits > prev {
+			lines[file.Name][line] = hits
+		}
+	}
+}
+
+// WriteLCOV writes the line coverage of the source files of the artifacts
+// in the LCOV trace file format.
+func (t *CoverageTracer) WriteLCOV(writer io.Writer, artifacts ...*CompilerArtifact) error {
+	files := t.LineHits(artifacts...)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := bufio.NewWriter(writer)
+	for _, name := range names {
+		lines := make([]int, 0, len(files[name]))
+		for line := range files[name] {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+
+		fmt.Fprintf(w, "TN:\nSF:%s\n", name)
+		var hit int
+		for _, line := range lines {
+			hits := files[name][line]
+			if hits > 0 {
+				hit++
+			}
+			fmt.Fprintf(w, "DA:%d,%d\n", line, hits)
+		}
+		fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return w.Flush()
+}
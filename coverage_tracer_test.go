@@ -0,0 +1,58 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/stretchr/testify/assert"
+)
+
+const coverageSource = "contract C {\n  function f() {\n    a();\n    b();\n  }\n}\n"
+
+func TestCoverageTracer(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc     = mockPreBlockChain()
+		tracer = NewCoverageTracer()
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	)
+	// The instructions after STOP are never executed.
+	code := []byte{byte(PUSH1), 1, byte(POP), byte(STOP), byte(PUSH1), 2, byte(POP)}
+	bc.SetCode(contractAddress, code)
+	for i := 0; i < 2; i++ {
+		_, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 100000, new(big.Int))
+		assert.Nil(err)
+	}
+	hits := tracer.Hits(bc.GetCodeHash(contractAddress))
+	assert.Equal(map[uint64]uint64{0: 2, 2: 2, 3: 2}, hits)
+	assert.Equal(code, tracer.Code(bc.GetCodeHash(contractAddress)))
+
+	// Map the instructions to the lines of a call to a(), the function
+	// declaration and a call to b().
+	dir, err := ioutil.TempDir("", "coverage")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "c.sol"), []byte(coverageSource), 0644))
+
+	combined := `{
+		"contracts": {"c.sol:C": {"bin-runtime": "` + hex.EncodeToString(code) + `", "srcmap-runtime": "34:4:0:-;;13:30;43:4;"}},
+		"sourceList": ["c.sol"]
+	}`
+	artifact, err := LoadCompilerArtifact([]byte(combined))
+	assert.Nil(err)
+	assert.Nil(artifact.LoadSources(dir))
+	assert.Equal(map[string]map[int]uint64{"c.sol": {2: 2, 3: 2, 4: 0}}, tracer.LineHits(artifact))
+
+	var lcov bytes.Buffer
+	assert.Nil(tracer.WriteLCOV(&lcov, artifact))
+	assert.Equal("TN:\nSF:c.sol\nDA:2,2\nDA:3,2\nDA:4,0\nLF:3\nLH:2\nend_of_record\n", lcov.String())
+
+	tracer.Reset()
+	assert.Nil(tracer.Hits(bc.GetCodeHash(contractAddress)))
+}
@@ -0,0 +1,116 @@
+package evm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DSiSc/evm-NG/params"
+)
+
+var (
+	errOpCodeInUse          = errors.New("opcode already defined")
+	errInvalidOperationSpec = errors.New("invalid operation specification")
+)
+
+// OperationSpec specifies an instruction added to a jump table by an
+// embedder, e.g. to provide chain specific functionality. The stack bounds
+// follow the built-in instructions: an instruction popping n and pushing m
+// items has MinStack n and MaxStack params.StackLimit+n-m, see StackBounds.
+type OperationSpec struct {
+	Execute     ExecutionFunc
+	ConstantGas uint64
+	DynamicGas  GasFunc // optional, charged after ConstantGas
+	MinStack    int
+	MaxStack    int
+	MemorySize  MemorySizeFunc // optional, memory is expanded before Execute
+
+	Halts   bool // execution stops after the instruction
+	Jumps   bool // the instruction sets the program counter itself
+	Writes  bool // the instruction modifies the state and fails in static calls
+	Reverts bool // the instruction reverts the state changes (implicitly halts)
+	Returns bool // the result of the instruction becomes the return data
+}
+
+// StackBounds returns the MinStack and MaxStack values of an instruction
+// popping pops and pushing pushes items.
+func StackBounds(pops, pushes int) (min, max int) {
+	return minStack(pops, pushes), maxStack(pops, pushes)
+}
+
+// NewJumpTable returns a copy of the default instruction set, which can be
+// customised with Register and Disable and passed in Config.JumpTable.
+// Custom instructions are not available to EOF code.
+func NewJumpTable() JumpTable {
+	return byzantiumInstructionSet
+}
+
+// Register adds an instruction in an unused opcode slot. Built-in
+// instructions have to be disabled before they can be replaced.
+func (jt *JumpTable) Register(op OpCode, spec OperationSpec) error {
+	if jt[op].valid {
+		return fmt.Errorf("%v: %v", errOpCodeInUse, op)
+	}
+	if spec.Execute == nil || spec.MinStack < 0 || spec.MaxStack < 0 || spec.MaxStack > int(params.StackLimit)+spec.MinStack {
+		return fmt.Errorf("%v: %v", errInvalidOperationSpec, op)
+	}
+	jt[op] = operation{
+		execute:     spec.Execute,
+		constantGas: spec.ConstantGas,
+		dynamicGas:  spec.DynamicGas,
+		minStack:    spec.MinStack,
+		maxStack:    spec.MaxStack,
+		memorySize:  spec.MemorySize,
+		halts:       spec.Halts,
+		jumps:       spec.Jumps,
+		writes:      spec.Writes,
+		valid:       true,
+		reverts:     spec.Reverts,
+		returns:     spec.Returns,
+	}
+	return nil
+}
+
+// Disable removes instructions from the jump table. Executing them fails
+// like executing an undefined opcode, in EOF code too, and the matching
+// eWASM host functions fail: call, callCode, callDelegate and callStatic,
+// create, log, selfDestruct and storageStore.
+func (jt *JumpTable) Disable(ops ...OpCode) {
+	for _, op := range ops {
+		jt[op] = operation{disabled: true}
+	}
+}
+
+// instructionSets returns the instructions available to legacy and EOF code
+// with a configured jump table, the default ones if it is nil. The
+// instructions disabled in the configured table, or missing from it while
+// in the default one, are not available to EOF code either. This includes
+// the constantinople instructions, e.g. CREATE2, which are only in the
+// default table of EOF code.
+func instructionSets(jt *JumpTable) (legacy, eof *JumpTable) {
+	if jt == nil {
+		return &byzantiumInstructionSet, &eofInstructionSet
+	}
+	legacy, eof = new(JumpTable), new(JumpTable)
+	*legacy, *eof = *jt, eofInstructionSet
+	for op := range eof {
+		if jt[op].disabled || byzantiumInstructionSet[op].valid && !jt[op].valid {
+			eof[op] = operation{}
+		}
+	}
+	return legacy, eof
+}
+
+// RegisterOpCodeName names a custom opcode for OpCode.String and
+// StringToOp. It is not safe for concurrent use and should be called during
+// initialisation, e.g. from an init function.
+func RegisterOpCodeName(op OpCode, name string) error {
+	if _, ok := opCodeToString[op]; ok {
+		return fmt.Errorf("%v: %v", errOpCodeInUse, op)
+	}
+	if _, ok := stringToOp[name]; ok || name == "" {
+		return fmt.Errorf("invalid or duplicate opcode name %q", name)
+	}
+	opCodeToString[op] = name
+	stringToOp[name] = op
+	return nil
+}
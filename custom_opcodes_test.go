@@ -0,0 +1,147 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const opDouble OpCode = 0xc0
+
+func opDoubleTop(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	x := stack.Pop()
+	stack.Push(new(big.Int).Lsh(x, 1))
+	return nil, nil
+}
+
+func customEVM(jt *JumpTable) *EVM {
+	bc := mockPreBlockChain()
+	return NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{JumpTable: jt})
+}
+
+func TestRegisterOperation(t *testing.T) {
+	assert := assert.New(t)
+	jt := NewJumpTable()
+
+	min, max := StackBounds(1, 1)
+	assert.NotNil(jt.Register(ADD, OperationSpec{Execute: opDoubleTop, MinStack: min, MaxStack: max}))
+	assert.NotNil(jt.Register(opDouble, OperationSpec{MinStack: min, MaxStack: max}))
+	assert.NotNil(jt.Register(opDouble, OperationSpec{Execute: opDoubleTop, MinStack: 1, MaxStack: 2000}))
+	assert.Nil(jt.Register(opDouble, OperationSpec{Execute: opDoubleTop, ConstantGas: 100, MinStack: min, MaxStack: max}))
+
+	// PUSH1 21 DOUBLE PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	code := []byte{byte(PUSH1), 21, byte(opDouble), byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)}
+	evm := customEVM(&jt)
+	evm.StateDB.SetCode(contractAddress, code)
+	ret, left, err := evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(util.BigToHash(big.NewInt(42))), ret)
+	assert.True(100000-left > 100)
+
+	// The default instruction set is not affected.
+	evm = customEVM(nil)
+	evm.StateDB.SetCode(contractAddress, code)
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+}
+
+func TestRegisterWritingOperation(t *testing.T) {
+	assert := assert.New(t)
+	jt := NewJumpTable()
+	min, max := StackBounds(0, 0)
+	assert.Nil(jt.Register(opDouble, OperationSpec{
+		Execute: func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+			return nil, nil
+		},
+		MinStack: min,
+		MaxStack: max,
+		Writes:   true,
+	}))
+	evm := customEVM(&jt)
+	evm.StateDB.SetCode(contractAddress, []byte{byte(opDouble), byte(STOP)})
+	_, _, err := evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	_, _, err = evm.StaticCall(AccountRef(callerAddress), contractAddress, nil, 100000)
+	assert.Equal(errWriteProtection, err)
+}
+
+func TestDisableOperation(t *testing.T) {
+	assert := assert.New(t)
+	jt := NewJumpTable()
+	jt.Disable(SELFDESTRUCT, CREATE)
+
+	evm := customEVM(&jt)
+	evm.StateDB.SetCode(contractAddress, []byte{byte(PUSH1), 0, byte(SELFDESTRUCT)})
+	_, _, err := evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+	assert.False(evm.StateDB.HasSuicided(contractAddress))
+
+	evm = customEVM(nil)
+	evm.StateDB.SetCode(contractAddress, []byte{byte(PUSH1), 0, byte(SELFDESTRUCT)})
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+
+	// A table without any instruction is not replaced by the default one.
+	evm = customEVM(&JumpTable{})
+	evm.StateDB.SetCode(contractAddress, []byte{byte(PUSH1), 0, byte(SELFDESTRUCT)})
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+
+	// The instructions are disabled for EOF and eWASM code too.
+	config := *params.TestChainConfig
+	config.EOFBlock, config.EWASMBlock = big.NewInt(0), big.NewInt(0)
+	bc := mockPreBlockChain()
+	evm = NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{JumpTable: &jt})
+	create := eofCode(nil, eofTestSection{0, eofNonReturning, 3, eofOps(PUSH1, 0, PUSH1, 0, PUSH1, 0, CREATE, POP, STOP)})
+	evm.StateDB.SetCode(contractAddress, create)
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+	_, _, _, err = evm.Create(AccountRef(callerAddress), eofCode(create, eofTestSection{0, eofNonReturning, 3, eofOps(
+		DATASIZE, PUSH1, 0, PUSH1, 0, DATACOPY, DATASIZE, PUSH1, 0, RETURN,
+	)}), 1000000, big.NewInt(0))
+	assert.NotNil(err)
+
+	// selfDestruct(0)
+	destruct := ewasmContract([]eeiImport{{"selfDestruct", []byte{wi32}, nil}}, 0x41, 0, 0x10, 0)
+	evm.StateDB.SetCode(contractAddress, destruct)
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+	assert.False(evm.StateDB.HasSuicided(contractAddress))
+	evm = NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{})
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.True(evm.StateDB.HasSuicided(contractAddress))
+
+	// Constantinople instructions of EOF code can be disabled as well.
+	jt = NewJumpTable()
+	create2 := eofCode(nil, eofTestSection{0, eofNonReturning, 4, eofOps(PUSH1, 0, PUSH1, 0, PUSH1, 0, PUSH1, 0, CREATE2, POP, STOP)})
+	evm = NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{JumpTable: &jt})
+	evm.StateDB.SetCode(contractAddress, create2)
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	jt.Disable(CREATE2, SSTORE)
+	evm = NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{JumpTable: &jt})
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+
+	// storageStore(0, 32)
+	store := ewasmContract([]eeiImport{{"storageStore", []byte{wi32, wi32}, nil}}, 0x41, 0, 0x41, 32, 0x10, 0)
+	evm.StateDB.SetCode(contractAddress, store)
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+	evm = NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{})
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+}
+
+func TestRegisterOpCodeName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(RegisterOpCodeName(opDouble, "DOUBLE"))
+	assert.Equal("DOUBLE", opDouble.String())
+	assert.Equal(opDouble, StringToOp("DOUBLE"))
+	assert.NotNil(RegisterOpCodeName(opDouble, "TWICE"))
+	assert.NotNil(RegisterOpCodeName(0xc1, "ADD"))
+}
@@ -0,0 +1,289 @@
+package evm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/util"
+)
+
+const debugConsoleHelp = `Commands:
+  break [pc=N] [op=NAME] [addr=ADDRESS] [slot=SLOT] [depth=N]
+                      add a breakpoint matching all the conditions
+  delete ID           remove a breakpoint
+  breakpoints         list the breakpoints
+  run                 start the execution
+  continue, c         resume until the next breakpoint
+  step, s             step into the next instruction
+  next, n             step over calls
+  out, o              step out of the current call
+  state               show the current instruction
+  stack               show the stack, top first
+  memory, mem         dump the memory
+  storage SLOT        show a storage slot of the current contract
+  returndata, rd      show the return data of the last call
+  abort               cancel the execution
+  quit, q             leave the console
+`
+
+// DebugConsole is a line based terminal front-end of a Debugger.
+type DebugConsole struct {
+	debugger *Debugger
+	run      func() error
+	out      io.Writer
+
+	started  bool
+	finished bool
+}
+
+// NewDebugConsole returns a console debugging the execution of run, which
+// has to be traced by debugger.
+func NewDebugConsole(debugger *Debugger, run func() error, out io.Writer) *DebugConsole {
+	return &DebugConsole{debugger: debugger, run: run, out: out}
+}
+
+// Run reads and executes commands from in until it is exhausted or the
+// console is left. The execution is aborted if still paused.
+func (c *DebugConsole) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(c.out, "> ")
+	for scanner.Scan() {
+		quit, err := c.Execute(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		}
+		if quit {
+			break
+		}
+		fmt.Fprint(c.out, "> ")
+	}
+	if c.debugger.State() != nil {
+		c.debugger.Abort()
+	}
+	return scanner.Err()
+}
+
+// Execute executes a single command, reporting whether to leave the console.
+func (c *DebugConsole) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "help", "h":
+		fmt.Fprint(c.out, debugConsoleHelp)
+	case "break", "b":
+		bp, err := parseBreakpoint(args)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.out, "breakpoint %d\n", c.debugger.AddBreakpoint(bp))
+	case "delete", "d":
+		if len(args) != 1 {
+			return false, errors.New("usage: delete ID")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, err
+		}
+		if !c.debugger.RemoveBreakpoint(id) {
+			return false, fmt.Errorf("no breakpoint %d", id)
+		}
+	case "breakpoints":
+		for _, id := range c.debugger.Breakpoints() {
+			bp, _ := c.debugger.Breakpoint(id)
+			fmt.Fprintf(c.out, "%d: %s\n", id, formatBreakpoint(&bp))
+		}
+	case "run", "r":
+		if c.started {
+			return false, errDebuggerStarted
+		}
+		c.started = true
+		c.report(c.debugger.Start(c.run))
+	case "continue", "c":
+		return false, c.proceed(c.debugger.Continue)
+	case "step", "s":
+		return false, c.proceed(c.debugger.StepIn)
+	case "next", "n":
+		return false, c.proceed(c.debugger.StepOver)
+	case "out", "o":
+		return false, c.proceed(c.debugger.StepOut)
+	case "state":
+		state, err := c.paused()
+		if err != nil {
+			return false, err
+		}
+		c.printState(state)
+	case "stack":
+		state, err := c.paused()
+		if err != nil {
+			return false, err
+		}
+		for i := len(state.Stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(c.out, "%04d  %x\n", len(state.Stack)-1-i, math.PaddedBigBytes(state.Stack[i], 32))
+		}
+	case "memory", "mem":
+		state, err := c.paused()
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprint(c.out, hex.Dump(state.Memory))
+	case "storage", "sto":
+		if len(args) != 1 {
+			return false, errors.New("usage: storage SLOT")
+		}
+		slot, ok := math.ParseBig256(args[0])
+		if !ok {
+			return false, fmt.Errorf("invalid slot %q", args[0])
+		}
+		value, err := c.debugger.Storage(util.BigToHash(slot))
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.out, "%x\n", value)
+	case "returndata", "rd":
+		state, err := c.paused()
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.out, "0x%x\n", state.ReturnData)
+	case "abort":
+		if _, err := c.paused(); err != nil {
+			return false, err
+		}
+		c.debugger.Abort()
+		c.finished = true
+		fmt.Fprintln(c.out, "execution aborted")
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, see help", cmd)
+	}
+	return false, nil
+}
+
+// proceed resumes the execution by a stepping method of the debugger.
+func (c *DebugConsole) proceed(step func() (*DebugState, error)) error {
+	if _, err := c.paused(); err != nil {
+		return err
+	}
+	c.report(step())
+	return nil
+}
+
+// paused returns the state of the paused execution.
+func (c *DebugConsole) paused() (*DebugState, error) {
+	switch {
+	case !c.started:
+		return nil, errors.New("execution not started, see run")
+	case c.finished:
+		return nil, errors.New("execution finished")
+	}
+	return c.debugger.State(), nil
+}
+
+// report prints the outcome of starting or resuming the execution.
+func (c *DebugConsole) report(state *DebugState, err error) {
+	if state != nil {
+		c.printState(state)
+		return
+	}
+	c.finished = true
+	if err != nil {
+		fmt.Fprintf(c.out, "execution finished: %v\n", err)
+	} else {
+		fmt.Fprintln(c.out, "execution finished")
+	}
+}
+
+// printState prints the instruction the execution is paused at.
+func (c *DebugConsole) printState(state *DebugState) {
+	if state.Breakpoint != 0 {
+		fmt.Fprintf(c.out, "breakpoint %d: ", state.Breakpoint)
+	}
+	fmt.Fprintf(c.out, "%x pc=%d op=%v gas=%d cost=%d depth=%d\n", state.Address, state.Pc, state.Op, state.Gas, state.Cost, state.Depth)
+}
+
+// parseBreakpoint parses the key=value conditions of a breakpoint.
+func parseBreakpoint(args []string) (Breakpoint, error) {
+	var bp Breakpoint
+	if len(args) == 0 {
+		return bp, errors.New("usage: break [pc=N] [op=NAME] [addr=ADDRESS] [slot=SLOT] [depth=N]")
+	}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return bp, fmt.Errorf("invalid condition %q", arg)
+		}
+		key, value := parts[0], parts[1]
+		switch key {
+		case "pc":
+			pc, ok := math.ParseUint64(value)
+			if !ok {
+				return bp, fmt.Errorf("invalid pc %q", value)
+			}
+			bp.Pc = &pc
+		case "op":
+			op, ok := stringToOp[strings.ToUpper(value)]
+			if !ok {
+				return bp, fmt.Errorf("unknown opcode %q", value)
+			}
+			bp.Op = &op
+		case "addr":
+			raw, err := hexutil.Decode(value)
+			if err != nil || len(raw) != len(types.Address{}) {
+				return bp, fmt.Errorf("invalid address %q", value)
+			}
+			addr := util.BytesToAddress(raw)
+			bp.Address = &addr
+		case "slot":
+			slot, ok := math.ParseBig256(value)
+			if !ok {
+				return bp, fmt.Errorf("invalid slot %q", value)
+			}
+			hash := util.BigToHash(slot)
+			bp.Slot = &hash
+		case "depth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 1 {
+				return bp, fmt.Errorf("invalid depth %q", value)
+			}
+			bp.Depth = depth
+		default:
+			return bp, fmt.Errorf("unknown condition %q", key)
+		}
+	}
+	return bp, nil
+}
+
+// formatBreakpoint formats the conditions of a breakpoint like the break
+// command.
+func formatBreakpoint(bp *Breakpoint) string {
+	var conds []string
+	if bp.Pc != nil {
+		conds = append(conds, fmt.Sprintf("pc=%d", *bp.Pc))
+	}
+	if bp.Op != nil {
+		conds = append(conds, fmt.Sprintf("op=%v", *bp.Op))
+	}
+	if bp.Address != nil {
+		conds = append(conds, fmt.Sprintf("addr=0x%x", *bp.Address))
+	}
+	if bp.Slot != nil {
+		conds = append(conds, fmt.Sprintf("slot=%s", new(big.Int).SetBytes(bp.Slot[:])))
+	}
+	if bp.Depth != 0 {
+		conds = append(conds, fmt.Sprintf("depth=%d", bp.Depth))
+	}
+	return strings.Join(conds, " ")
+}
@@ -0,0 +1,311 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/util"
+)
+
+var (
+	errDebuggerNotPaused = errors.New("execution is not paused")
+	errDebuggerStarted   = errors.New("debugging session already started")
+)
+
+// Breakpoint pauses the execution at the instructions meeting all of its
+// conditions. Conditions left unset match every instruction.
+type Breakpoint struct {
+	Address *types.Address // address of the executing contract
+	Pc      *uint64
+	Op      *OpCode
+	Slot    *types.Hash // storage slot written by SSTORE
+	Depth   int         // call depth, starting at 1 for the top level call
+}
+
+// matches tells whether the breakpoint pauses the execution at an
+// instruction.
+func (bp *Breakpoint) matches(pc uint64, op OpCode, stack *Stack, contract *Contract, depth int) bool {
+	if bp.Address != nil && *bp.Address != contract.Address() {
+		return false
+	}
+	if bp.Pc != nil && *bp.Pc != pc {
+		return false
+	}
+	if bp.Op != nil && *bp.Op != op {
+		return false
+	}
+	if bp.Slot != nil && (op != SSTORE || stack.len() == 0 || util.BigToHash(stack.peek()) != *bp.Slot) {
+		return false
+	}
+	return bp.Depth == 0 || bp.Depth == depth
+}
+
+// DebugState is the state of the execution paused before an instruction.
+type DebugState struct {
+	Pc         uint64
+	Op         OpCode
+	Gas        uint64
+	Cost       uint64
+	Depth      int
+	Address    types.Address // address of the executing contract
+	Stack      []*big.Int    // the top of the stack last
+	Memory     []byte
+	ReturnData []byte // return data of the last call
+	Breakpoint int    // id of the breakpoint pausing the execution, 0 if stepping
+}
+
+// DebuggerConfig are the configuration options for the Debugger.
+type DebuggerConfig struct {
+	StopOnEntry bool // pause before the first instruction
+}
+
+// debugMode is how the execution continues after a pause.
+type debugMode int
+
+const (
+	debugRun debugMode = iota
+	debugStepIn
+	debugStepOver
+	debugStepOut
+)
+
+// Debugger is a Tracer pausing the execution at breakpoints, to inspect the
+// state and step through the instructions.
+//
+// The execution runs in its own goroutine, started by Start, and blocks in
+// CaptureState while paused. The session methods wait until the execution
+// pauses again or finishes, and must be called from a single goroutine.
+// Breakpoints can only be changed before the start or while paused.
+type Debugger struct {
+	cfg DebuggerConfig
+
+	breakpoints map[int]*Breakpoint
+	nextID      int
+
+	mode    debugMode
+	depth   int // call depth of the last pause
+	aborted bool
+
+	env     *EVM
+	state   *DebugState // state of the paused execution, nil if running
+	started bool
+
+	pause  chan *DebugState
+	resume chan bool // false aborts the execution
+	done   chan error
+}
+
+// NewDebugger returns a new debugger.
+func NewDebugger(cfg *DebuggerConfig) *Debugger {
+	debugger := &Debugger{
+		breakpoints: make(map[int]*Breakpoint),
+		pause:       make(chan *DebugState),
+		resume:      make(chan bool),
+		done:        make(chan error, 1),
+	}
+	if cfg != nil {
+		debugger.cfg = *cfg
+	}
+	if debugger.cfg.StopOnEntry {
+		debugger.mode = debugStepIn
+	}
+	return debugger
+}
+
+// AddBreakpoint adds a breakpoint and returns its id.
+func (d *Debugger) AddBreakpoint(bp Breakpoint) int {
+	d.nextID++
+	d.breakpoints[d.nextID] = &bp
+	return d.nextID
+}
+
+// RemoveBreakpoint removes a breakpoint, reporting whether it existed.
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	_, ok := d.breakpoints[id]
+	delete(d.breakpoints, id)
+	return ok
+}
+
+// Breakpoints returns the ids of the breakpoints, in order.
+func (d *Debugger) Breakpoints() []int {
+	ids := make([]int, 0, len(d.breakpoints))
+	for id := range d.breakpoints {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Breakpoint returns a breakpoint by id.
+func (d *Debugger) Breakpoint(id int) (Breakpoint, bool) {
+	bp, ok := d.breakpoints[id]
+	if !ok {
+		return Breakpoint{}, false
+	}
+	return *bp, true
+}
+
+// Start runs the execution, e.g. a call of an EVM traced by the debugger, in
+// a new goroutine and waits until it pauses or finishes. The state of the
+// paused execution is returned, or nil and the error of run once finished.
+func (d *Debugger) Start(run func() error) (*DebugState, error) {
+	if d.started {
+		return nil, errDebuggerStarted
+	}
+	d.started = true
+	go func() { d.done <- run() }()
+	return d.wait()
+}
+
+// State returns the state of the paused execution, or nil if not paused.
+func (d *Debugger) State() *DebugState { return d.state }
+
+// Continue resumes the execution until the next breakpoint.
+func (d *Debugger) Continue() (*DebugState, error) { return d.proceed(debugRun) }
+
+// StepIn resumes the execution until the next instruction, including those
+// of called contracts.
+func (d *Debugger) StepIn() (*DebugState, error) { return d.proceed(debugStepIn) }
+
+// StepOver resumes the execution until the next instruction of the current
+// call, or of its callers once it returns.
+func (d *Debugger) StepOver() (*DebugState, error) { return d.proceed(debugStepOver) }
+
+// StepOut resumes the execution until the current call has returned.
+func (d *Debugger) StepOut() (*DebugState, error) { return d.proceed(debugStepOut) }
+
+// Abort cancels the paused execution and waits until it has finished. The
+// paused instruction is not executed and the execution fails, reverting its
+// state changes.
+func (d *Debugger) Abort() error {
+	if d.state == nil {
+		return errDebuggerNotPaused
+	}
+	d.state = nil
+	d.resume <- false
+	_, err := d.wait()
+	if err == errExecutionAborted {
+		return nil
+	}
+	return err
+}
+
+// Storage returns the value of a storage slot of the contract the paused
+// execution is in.
+func (d *Debugger) Storage(slot types.Hash) (types.Hash, error) {
+	if d.state == nil {
+		return types.Hash{}, errDebuggerNotPaused
+	}
+	return d.env.StateDB.GetHashTypeState(d.state.Address, slot), nil
+}
+
+// proceed resumes the paused execution and waits until it pauses again.
+func (d *Debugger) proceed(mode debugMode) (*DebugState, error) {
+	if d.state == nil {
+		return nil, errDebuggerNotPaused
+	}
+	d.mode, d.depth = mode, d.state.Depth
+	d.state = nil
+	d.resume <- true
+	return d.wait()
+}
+
+// wait waits until the execution pauses or finishes.
+func (d *Debugger) wait() (*DebugState, error) {
+	select {
+	case state := <-d.pause:
+		d.state = state
+		return state, nil
+	case err := <-d.done:
+		return nil, err
+	}
+}
+
+// CaptureTxStart implements the Tracer interface.
+func (d *Debugger) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (d *Debugger) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureStart implements the Tracer interface.
+func (d *Debugger) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface.
+func (d *Debugger) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (d *Debugger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface to pause the execution
+// before the instruction if requested, until the session resumes it.
+func (d *Debugger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if d.aborted || err != nil {
+		return nil
+	}
+	var pause bool
+	switch d.mode {
+	case debugStepIn:
+		pause = true
+	case debugStepOver:
+		pause = depth <= d.depth
+	case debugStepOut:
+		pause = depth < d.depth
+	}
+	var breakpoint int
+	for id, bp := range d.breakpoints {
+		if (breakpoint == 0 || id < breakpoint) && bp.matches(pc, op, stack, contract, depth) {
+			pause, breakpoint = true, id
+		}
+	}
+	if !pause {
+		return nil
+	}
+	state := &DebugState{
+		Pc:         pc,
+		Op:         op,
+		Gas:        gas,
+		Cost:       cost,
+		Depth:      depth,
+		Address:    contract.Address(),
+		Stack:      make([]*big.Int, stack.len()),
+		Memory:     common.CopyBytes(memory.Data()),
+		Breakpoint: breakpoint,
+	}
+	for i, item := range stack.Data() {
+		state.Stack[i] = new(big.Int).Set(item)
+	}
+	if in, ok := env.Interpreter().(*EVMInterpreter); ok {
+		state.ReturnData = common.CopyBytes(in.returnData)
+	}
+	d.env = env
+	d.pause <- state
+	if !<-d.resume {
+		d.aborted = true
+		env.Cancel()
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (d *Debugger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (d *Debugger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
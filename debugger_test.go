@@ -0,0 +1,172 @@
+package evm
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var debugCallee = util.HexToAddress("0x000000000000000000000000000000000000000b")
+
+// debugSession deploys a contract storing 7 in slot 1 and calling another
+// contract, which adds two numbers, and returns a function running a call.
+func debugSession(tracer Tracer) func() error {
+	bc := mockPreBlockChain()
+	code := []byte{byte(PUSH1), 7, byte(PUSH1), 1, byte(SSTORE),
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, debugCallee[:]...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(POP), byte(STOP))
+	bc.SetCode(contractAddress, code)
+	bc.CreateAccount(debugCallee)
+	bc.SetCode(debugCallee, []byte{byte(PUSH1), 2, byte(PUSH1), 3, byte(ADD), byte(STOP)})
+
+	env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	return func() error {
+		_, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+		return err
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	assert := assert.New(t)
+	debugger := NewDebugger(&DebuggerConfig{StopOnEntry: true})
+	run := debugSession(debugger)
+
+	state, err := debugger.Start(run)
+	assert.Nil(err)
+	assert.Equal(uint64(0), state.Pc)
+	assert.Equal(1, state.Depth)
+	assert.Equal(contractAddress, state.Address)
+	assert.Equal(0, state.Breakpoint)
+	_, err = debugger.Start(run)
+	assert.Equal(errDebuggerStarted, err)
+
+	// Break before writing slot 1.
+	slot := util.BigToHash(big.NewInt(1))
+	id := debugger.AddBreakpoint(Breakpoint{Slot: &slot})
+	state, err = debugger.Continue()
+	assert.Nil(err)
+	assert.Equal(uint64(4), state.Pc)
+	assert.Equal(SSTORE, state.Op)
+	assert.Equal(id, state.Breakpoint)
+	assert.Equal([]*big.Int{big.NewInt(7), big.NewInt(1)}, state.Stack)
+	value, err := debugger.Storage(slot)
+	assert.Nil(err)
+	assert.Equal(types.Hash{}, value)
+
+	state, err = debugger.StepIn()
+	assert.Nil(err)
+	assert.Equal(uint64(5), state.Pc)
+	value, _ = debugger.Storage(slot)
+	assert.Equal(util.BigToHash(big.NewInt(7)), value)
+
+	// Step into the call and out of it again.
+	op := CALL
+	debugger.AddBreakpoint(Breakpoint{Op: &op})
+	assert.True(debugger.RemoveBreakpoint(id))
+	assert.False(debugger.RemoveBreakpoint(id))
+	state, _ = debugger.Continue()
+	assert.Equal(uint64(39), state.Pc)
+	state, _ = debugger.StepIn()
+	assert.Equal(uint64(0), state.Pc)
+	assert.Equal(2, state.Depth)
+	assert.Equal(debugCallee, state.Address)
+	state, _ = debugger.StepOut()
+	assert.Equal(uint64(40), state.Pc)
+	assert.Equal(1, state.Depth)
+
+	state, err = debugger.Continue()
+	assert.Nil(state)
+	assert.Nil(err)
+	_, err = debugger.StepIn()
+	assert.Equal(errDebuggerNotPaused, err)
+}
+
+func TestDebuggerStepOver(t *testing.T) {
+	assert := assert.New(t)
+	debugger := NewDebugger(nil)
+	pc := uint64(39)
+	debugger.AddBreakpoint(Breakpoint{Pc: &pc, Depth: 1})
+	debugger.AddBreakpoint(Breakpoint{Address: &debugCallee, Depth: 2})
+
+	state, err := debugger.Start(debugSession(debugger))
+	assert.Nil(err)
+	assert.Equal(uint64(39), state.Pc)
+	assert.Equal(1, state.Breakpoint)
+
+	// Breakpoints pause the execution while stepping over calls.
+	state, _ = debugger.StepOver()
+	assert.Equal(debugCallee, state.Address)
+	assert.Equal(2, state.Breakpoint)
+	assert.True(debugger.RemoveBreakpoint(2))
+	state, _ = debugger.StepOver()
+	assert.Equal(uint64(2), state.Pc)
+	assert.Equal(2, state.Depth)
+
+	assert.Nil(debugger.Abort())
+	assert.Nil(debugger.State())
+	assert.Equal(errDebuggerNotPaused, debugger.Abort())
+}
+
+func TestDebugConsole(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		debugger = NewDebugger(nil)
+		out      = new(bytes.Buffer)
+		console  = NewDebugConsole(debugger, debugSession(debugger), out)
+		script   = []string{
+			"step",
+			"break op=sstore slot=1",
+			"break pc=x",
+			"breakpoints",
+			"run",
+			"stack",
+			"storage 1",
+			"next",
+			"storage 1",
+			"continue",
+			"state",
+			"quit",
+		}
+	)
+	assert.Nil(console.Run(strings.NewReader(strings.Join(script, "\n"))))
+	output := out.String()
+	assert.Contains(output, "error: execution not started, see run\n")
+	assert.Contains(output, "breakpoint 1\n")
+	assert.Contains(output, `error: invalid pc "x"`)
+	assert.Contains(output, "1: op=SSTORE slot=1\n")
+	assert.Contains(output, "breakpoint 1: f74cc8824a00bcb96e8546bf3b4dc47ace9cab2c pc=4 op=SSTORE")
+	assert.Contains(output, "0000  0000000000000000000000000000000000000000000000000000000000000001\n0001  0000000000000000000000000000000000000000000000000000000000000007\n")
+	assert.Contains(output, "0000000000000000000000000000000000000000000000000000000000000000\n> f74cc8824a00bcb96e8546bf3b4dc47ace9cab2c pc=5")
+	assert.Contains(output, "0000000000000000000000000000000000000000000000000000000000000007\n")
+	assert.Contains(output, "execution finished\n")
+	assert.Contains(output, "error: execution finished\n")
+}
+
+func TestDebuggerAbort(t *testing.T) {
+	assert := assert.New(t)
+	debugger := NewDebugger(nil)
+	op := SSTORE
+	debugger.AddBreakpoint(Breakpoint{Op: &op})
+
+	bc := mockPreBlockChain()
+	bc.SetCode(contractAddress, []byte{byte(PUSH1), 7, byte(PUSH1), 1, byte(SSTORE), byte(STOP)})
+	env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: debugger})
+	var err error
+	state, _ := debugger.Start(func() error {
+		_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+		return err
+	})
+	assert.Equal(SSTORE, state.Op)
+
+	// The paused SSTORE is not executed and the call fails.
+	assert.Nil(debugger.Abort())
+	assert.Equal(errExecutionAborted, err)
+	assert.Equal(types.Hash{}, bc.GetHashTypeState(contractAddress, util.BigToHash(big.NewInt(1))))
+}
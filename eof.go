@@ -0,0 +1,407 @@
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/DSiSc/evm-NG/params"
+)
+
+// EVM Object Format v1 container layout:
+//
+//	magic(0xef00) version(0x01)
+//	0x01 types_size(u16)
+//	0x02 num_code_sections(u16) code_size(u16)...
+//	0x04 data_size(u16)
+//	0x00
+//	types: (inputs(u8) outputs(u8) max_stack_height(u16))...
+//	code sections
+//	data section
+//
+// The subset implemented here covers EIP-3540, EIP-3670, EIP-4200,
+// EIP-4750, EIP-5450 and EIP-6206. Calls and contract creation still use
+// the legacy instructions, as EXTCALL and EOFCREATE are not supported yet.
+const (
+	eofFormatByte = 0xef
+	eofMagicByte  = 0x00
+	eof1Version   = 0x01
+
+	eofKindTypes      = 0x01
+	eofKindCode       = 0x02
+	eofKindData       = 0x04
+	eofKindTerminator = 0x00
+
+	eofNonReturning     = 0x80 // outputs of a code section which never returns
+	eofMaxIO            = 0x7f // maximum number of inputs and outputs of a code section
+	eofMaxCodeSections  = 1024
+	eofMaxStackHeight   = 1023
+	eofReturnStackLimit = 1024
+)
+
+var (
+	errEOFInvalidMagic           = errors.New("eof: invalid magic")
+	errEOFInvalidVersion         = errors.New("eof: invalid version")
+	errEOFInvalidHeader          = errors.New("eof: invalid header")
+	errEOFInvalidSectionSize     = errors.New("eof: invalid section size")
+	errEOFInvalidContainerSize   = errors.New("eof: container size mismatch")
+	errEOFInvalidTypes           = errors.New("eof: invalid code section type")
+	errEOFUndefinedInstruction   = errors.New("eof: undefined instruction")
+	errEOFTruncatedImmediate     = errors.New("eof: truncated immediate")
+	errEOFInvalidJumpTarget      = errors.New("eof: invalid relative jump target")
+	errEOFInvalidSectionIndex    = errors.New("eof: invalid code section index")
+	errEOFInvalidDataOffset      = errors.New("eof: data offset out of bounds")
+	errEOFInvalidReturn          = errors.New("eof: invalid code section return")
+	errEOFUnreachableCode        = errors.New("eof: unreachable code")
+	errEOFNoTerminator           = errors.New("eof: code section does not terminate")
+	errEOFStackUnderflow         = errors.New("eof: stack underflow")
+	errEOFStackOverflow          = errors.New("eof: stack overflow")
+	errEOFStackHeightMismatch    = errors.New("eof: stack height mismatch")
+	errEOFMaxStackHeightMismatch = errors.New("eof: max stack height mismatch")
+)
+
+// eofValidationError reports the position of a code validation failure.
+type eofValidationError struct {
+	err     error
+	section int
+	pc      int
+}
+
+func (e *eofValidationError) Error() string {
+	return fmt.Sprintf("%v (section %d, pc %d)", e.err, e.section, e.pc)
+}
+
+// eofType is the signature of a code section.
+type eofType struct {
+	inputs         uint8
+	outputs        uint8
+	maxStackHeight uint16
+}
+
+// eofContainer is a parsed EOF container. The code sections are addressed by
+// their offsets within the container, so that program counters stay absolute
+// and relative jumps can be executed on the original code.
+type eofContainer struct {
+	types       []eofType
+	codeOffsets []int
+	codeSizes   []int
+	data        []byte
+}
+
+// eofReturn is an entry of the return stack used by CALLF and RETF.
+type eofReturn struct {
+	section int
+	pc      uint64
+}
+
+// hasEOFMagic tells whether code is meant to be an EOF container.
+func hasEOFMagic(code []byte) bool {
+	return len(code) >= 2 && code[0] == eofFormatByte && code[1] == eofMagicByte
+}
+
+// parseEOF decodes the header and the type section of an EOF container and
+// checks the section sizes add up to the size of the container.
+func parseEOF(code []byte) (*eofContainer, error) {
+	if !hasEOFMagic(code) {
+		return nil, errEOFInvalidMagic
+	}
+	if len(code) < 3 || code[2] != eof1Version {
+		return nil, errEOFInvalidVersion
+	}
+	pos := 3
+	kind := func(k byte) bool {
+		if pos >= len(code) || code[pos] != k {
+			return false
+		}
+		pos++
+		return true
+	}
+	size := func() (int, bool) {
+		if pos+2 > len(code) {
+			return 0, false
+		}
+		n := int(binary.BigEndian.Uint16(code[pos:]))
+		pos += 2
+		return n, true
+	}
+
+	if !kind(eofKindTypes) {
+		return nil, errEOFInvalidHeader
+	}
+	typesSize, ok := size()
+	if !ok {
+		return nil, errEOFInvalidHeader
+	}
+	if !kind(eofKindCode) {
+		return nil, errEOFInvalidHeader
+	}
+	numCode, ok := size()
+	if !ok {
+		return nil, errEOFInvalidHeader
+	}
+	if numCode == 0 || numCode > eofMaxCodeSections {
+		return nil, errEOFInvalidSectionSize
+	}
+	c := &eofContainer{
+		codeOffsets: make([]int, numCode),
+		codeSizes:   make([]int, numCode),
+	}
+	for i := range c.codeSizes {
+		if c.codeSizes[i], ok = size(); !ok {
+			return nil, errEOFInvalidHeader
+		}
+		if c.codeSizes[i] == 0 {
+			return nil, errEOFInvalidSectionSize
+		}
+	}
+	if !kind(eofKindData) {
+		return nil, errEOFInvalidHeader
+	}
+	dataSize, ok := size()
+	if !ok {
+		return nil, errEOFInvalidHeader
+	}
+	if !kind(eofKindTerminator) {
+		return nil, errEOFInvalidHeader
+	}
+	if typesSize != 4*numCode {
+		return nil, errEOFInvalidSectionSize
+	}
+
+	expected := pos + typesSize + dataSize
+	for _, n := range c.codeSizes {
+		expected += n
+	}
+	if len(code) != expected {
+		return nil, errEOFInvalidContainerSize
+	}
+
+	c.types = make([]eofType, numCode)
+	for i := range c.types {
+		t := eofType{
+			inputs:         code[pos],
+			outputs:        code[pos+1],
+			maxStackHeight: binary.BigEndian.Uint16(code[pos+2:]),
+		}
+		if t.inputs > eofMaxIO || (t.outputs > eofMaxIO && t.outputs != eofNonReturning) || t.maxStackHeight > eofMaxStackHeight {
+			return nil, errEOFInvalidTypes
+		}
+		if i == 0 && (t.inputs != 0 || t.outputs != eofNonReturning) {
+			return nil, errEOFInvalidTypes
+		}
+		c.types[i] = t
+		pos += 4
+	}
+	for i, n := range c.codeSizes {
+		c.codeOffsets[i] = pos
+		pos += n
+	}
+	c.data = code[pos:]
+	return c, nil
+}
+
+// validateEOF parses code as an EOF container and validates all of its code
+// sections against the given instruction set.
+func validateEOF(code []byte, jt *JumpTable) (*eofContainer, error) {
+	c, err := parseEOF(code)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.types {
+		if err := c.validateSection(code, i, jt); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// validateSection checks a code section only contains defined instructions
+// with complete immediates, and that the stack height is the same on every
+// path reaching an instruction, never underflows and peaks at the height
+// declared in the type section.
+func (c *eofContainer) validateSection(container []byte, section int, jt *JumpTable) error {
+	var (
+		start = c.codeOffsets[section]
+		code  = container[start : start+c.codeSizes[section]]
+		typ   = c.types[section]
+	)
+	fail := func(err error, pc int) error {
+		return &eofValidationError{err: err, section: section, pc: pc}
+	}
+
+	// Mark the immediates and check the instructions refer to existing
+	// code sections and data.
+	immediates := make(bitvec, len(code)/8+1)
+	returns := false
+	for pc := 0; pc < len(code); {
+		op := OpCode(code[pc])
+		if !jt[op].valid {
+			return fail(errEOFUndefinedInstruction, pc)
+		}
+		n := eofImmediateSize(code, pc)
+		if (n > 0 && pc+n >= len(code)) || (op == RJUMPV && pc+1 >= len(code)) {
+			return fail(errEOFTruncatedImmediate, pc)
+		}
+		for i := 1; i <= n; i++ {
+			immediates.set(uint64(pc + i))
+		}
+		switch op {
+		case CALLF, JUMPF:
+			idx := int(binary.BigEndian.Uint16(code[pc+1:]))
+			if idx >= len(c.types) {
+				return fail(errEOFInvalidSectionIndex, pc)
+			}
+			target := c.types[idx]
+			if op == CALLF && target.outputs == eofNonReturning {
+				return fail(errEOFInvalidReturn, pc)
+			}
+			if op == JUMPF && target.outputs != eofNonReturning {
+				if typ.outputs == eofNonReturning || target.outputs > typ.outputs {
+					return fail(errEOFInvalidReturn, pc)
+				}
+				returns = true
+			}
+		case RETF:
+			if typ.outputs == eofNonReturning {
+				return fail(errEOFInvalidReturn, pc)
+			}
+			returns = true
+		case DATALOADN:
+			if int(binary.BigEndian.Uint16(code[pc+1:]))+32 > len(c.data) {
+				return fail(errEOFInvalidDataOffset, pc)
+			}
+		}
+		pc += 1 + n
+	}
+	if typ.outputs != eofNonReturning && !returns {
+		return fail(errEOFInvalidReturn, 0)
+	}
+
+	// Follow every path through the section, recording the stack height
+	// before each instruction.
+	heights := make([]int, len(code))
+	for i := range heights {
+		heights[i] = -1
+	}
+	heights[0] = int(typ.inputs)
+	maxHeight := int(typ.inputs)
+	worklist := []int{0}
+	for len(worklist) > 0 {
+		pc := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		var (
+			op     = OpCode(code[pc])
+			height = heights[pc]
+			pops   = jt[op].minStack
+			pushes = int(params.StackLimit) + pops - jt[op].maxStack
+		)
+		switch op {
+		case CALLF, JUMPF:
+			target := c.types[binary.BigEndian.Uint16(code[pc+1:])]
+			if height+int(target.maxStackHeight)-int(target.inputs) > eofMaxStackHeight {
+				return fail(errEOFStackOverflow, pc)
+			}
+			pops, pushes = int(target.inputs), int(target.outputs)
+			if op == JUMPF && target.outputs != eofNonReturning &&
+				height != int(typ.outputs)+int(target.inputs)-int(target.outputs) {
+				return fail(errEOFStackHeightMismatch, pc)
+			}
+			if op == JUMPF {
+				pushes = 0
+			}
+		case RETF:
+			if height != int(typ.outputs) {
+				return fail(errEOFStackHeightMismatch, pc)
+			}
+		}
+		if height < pops {
+			return fail(errEOFStackUnderflow, pc)
+		}
+		next := height - pops + pushes
+		if next > maxHeight {
+			maxHeight = next
+		}
+
+		n := eofImmediateSize(code, pc)
+		var successors []int
+		switch {
+		case op == RJUMP:
+			successors = []int{pc + 3 + int(eofInt16(code, pc+1))}
+		case op == RJUMPI:
+			successors = []int{pc + 3, pc + 3 + int(eofInt16(code, pc+1))}
+		case op == RJUMPV:
+			successors = []int{pc + 1 + n}
+			for i := 0; i <= int(code[pc+1]); i++ {
+				successors = append(successors, pc+1+n+int(eofInt16(code, pc+2+2*i)))
+			}
+		case op == RETF || op == JUMPF || jt[op].halts || jt[op].reverts:
+		default:
+			successors = []int{pc + 1 + n}
+		}
+		for i, succ := range successors {
+			// The first successor of a conditional jump is the next
+			// instruction, all others are jump targets.
+			if i == 0 && op != RJUMP && succ >= len(code) {
+				return fail(errEOFNoTerminator, pc)
+			}
+			if (i > 0 || op == RJUMP) && (succ < 0 || succ >= len(code) || !immediates.codeSegment(uint64(succ))) {
+				return fail(errEOFInvalidJumpTarget, pc)
+			}
+			switch heights[succ] {
+			case -1:
+				heights[succ] = next
+				worklist = append(worklist, succ)
+			case next:
+			default:
+				return fail(errEOFStackHeightMismatch, succ)
+			}
+		}
+	}
+	for pc := 0; pc < len(code); pc += 1 + eofImmediateSize(code, pc) {
+		if heights[pc] == -1 {
+			return fail(errEOFUnreachableCode, pc)
+		}
+	}
+	if maxHeight > eofMaxStackHeight {
+		return fail(errEOFStackOverflow, 0)
+	}
+	if maxHeight != int(typ.maxStackHeight) {
+		return fail(errEOFMaxStackHeightMismatch, 0)
+	}
+	return nil
+}
+
+// eofImmediateSize returns the number of immediate bytes following the
+// instruction at pc.
+func eofImmediateSize(code []byte, pc int) int {
+	op := OpCode(code[pc])
+	switch {
+	case op.IsPush():
+		return int(op-PUSH1) + 1
+	case op == RJUMP || op == RJUMPI || op == CALLF || op == JUMPF || op == DATALOADN:
+		return 2
+	case op == RJUMPV && pc+1 < len(code):
+		return 1 + 2*(int(code[pc+1])+1)
+	}
+	return 0
+}
+
+// eofInt16 reads the signed relative jump offset at pos.
+func eofInt16(code []byte, pos int) int16 {
+	return int16(binary.BigEndian.Uint16(code[pos:]))
+}
+
+// checkDeployedCode enforces the deployment rules after the EOF fork: code
+// deployed by EOF initcode must be a valid container itself, while legacy
+// initcode may not deploy code starting with the reserved 0xef byte.
+func checkDeployedCode(initcode, code []byte, jt *JumpTable) error {
+	if hasEOFMagic(initcode) {
+		_, err := validateEOF(code, jt)
+		return err
+	}
+	if len(code) > 0 && code[0] == eofFormatByte {
+		return errInvalidCode
+	}
+	return nil
+}
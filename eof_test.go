@@ -0,0 +1,236 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// eofTestSection is a code section of a test container.
+type eofTestSection struct {
+	inputs, outputs byte
+	maxStack        uint16
+	code            []byte
+}
+
+// eofCode assembles an EOF v1 container from code sections and data.
+func eofCode(data []byte, sections ...eofTestSection) []byte {
+	u16 := func(out []byte, n int) []byte {
+		return append(out, byte(n>>8), byte(n))
+	}
+	out := []byte{eofFormatByte, eofMagicByte, eof1Version, eofKindTypes}
+	out = u16(out, 4*len(sections))
+	out = append(out, eofKindCode)
+	out = u16(out, len(sections))
+	for _, s := range sections {
+		out = u16(out, len(s.code))
+	}
+	out = append(out, eofKindData)
+	out = u16(out, len(data))
+	out = append(out, eofKindTerminator)
+	for _, s := range sections {
+		out = append(out, s.inputs, s.outputs)
+		out = u16(out, int(s.maxStack))
+	}
+	for _, s := range sections {
+		out = append(out, s.code...)
+	}
+	return append(out, data...)
+}
+
+// eofCause strips the position from a validation error.
+func eofCause(err error) error {
+	if v, ok := err.(*eofValidationError); ok {
+		return v.err
+	}
+	return err
+}
+
+// eofOps assembles opcodes and immediate bytes.
+func eofOps(code ...interface{}) []byte {
+	var out []byte
+	for _, c := range code {
+		switch c := c.(type) {
+		case OpCode:
+			out = append(out, byte(c))
+		case int:
+			out = append(out, byte(c))
+		}
+	}
+	return out
+}
+
+var eofStop = eofTestSection{0, eofNonReturning, 0, eofOps(STOP)}
+
+func TestParseEOF(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte{1, 2, 3}
+	code := eofCode(data, eofStop, eofTestSection{1, 2, 3, eofOps(DUP1, RETF)})
+	c, err := parseEOF(code)
+	assert.Nil(err)
+	assert.Equal([]eofType{{0, eofNonReturning, 0}, {1, 2, 3}}, c.types)
+	assert.Equal([]int{1, 2}, c.codeSizes)
+	assert.Equal(byte(STOP), code[c.codeOffsets[0]])
+	assert.Equal(byte(DUP1), code[c.codeOffsets[1]])
+	assert.Equal(data, c.data)
+
+	bad := func(mutate func([]byte) []byte) error {
+		_, err := parseEOF(mutate(append([]byte{}, code...)))
+		return err
+	}
+	assert.Equal(errEOFInvalidMagic, bad(func(b []byte) []byte { b[1] = 0x01; return b }))
+	assert.Equal(errEOFInvalidVersion, bad(func(b []byte) []byte { b[2] = 0x02; return b }))
+	assert.Equal(errEOFInvalidHeader, bad(func(b []byte) []byte { b[3] = eofKindCode; return b }))
+	assert.Equal(errEOFInvalidHeader, bad(func(b []byte) []byte { return b[:10] }))
+	assert.Equal(errEOFInvalidContainerSize, bad(func(b []byte) []byte { return append(b, 0) }))
+	assert.Equal(errEOFInvalidContainerSize, bad(func(b []byte) []byte { return b[:len(b)-1] }))
+	assert.Equal(errEOFInvalidSectionSize, bad(func(b []byte) []byte { b[5] = 4; return b }))
+
+	_, err = parseEOF(eofCode(nil, eofTestSection{0, 0, 0, eofOps(STOP)}))
+	assert.Equal(errEOFInvalidTypes, err)
+	_, err = parseEOF(eofCode(nil, eofTestSection{0, eofNonReturning, 0, nil}))
+	assert.Equal(errEOFInvalidSectionSize, err)
+}
+
+func TestValidateEOF(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		sections []eofTestSection
+		err      error
+	}{
+		{"valid", nil, []eofTestSection{eofStop}, nil},
+		{"dynamic jump", nil, []eofTestSection{{0, eofNonReturning, 1, eofOps(PUSH1, 0, JUMP)}}, errEOFUndefinedInstruction},
+		{"truncated push", nil, []eofTestSection{{0, eofNonReturning, 1, eofOps(PUSH2, 0)}}, errEOFTruncatedImmediate},
+		{"jump into immediate", nil, []eofTestSection{{0, eofNonReturning, 1, eofOps(RJUMP, 0, 1, PUSH1, 0, STOP)}}, errEOFInvalidJumpTarget},
+		{"jump out of section", nil, []eofTestSection{{0, eofNonReturning, 0, eofOps(RJUMP, 0, 0x10, STOP)}}, errEOFInvalidJumpTarget},
+		{"missing section", nil, []eofTestSection{{0, eofNonReturning, 0, eofOps(CALLF, 0, 1, STOP)}}, errEOFInvalidSectionIndex},
+		{"call non-returning", nil, []eofTestSection{{0, eofNonReturning, 0, eofOps(CALLF, 0, 0, STOP)}}, errEOFInvalidReturn},
+		{"retf in non-returning", nil, []eofTestSection{{0, eofNonReturning, 0, eofOps(RETF)}}, errEOFInvalidReturn},
+		{"returning without retf", nil, []eofTestSection{
+			{0, eofNonReturning, 0, eofOps(CALLF, 0, 1, STOP)},
+			{0, 0, 0, eofOps(STOP)},
+		}, errEOFInvalidReturn},
+		{"unreachable", nil, []eofTestSection{{0, eofNonReturning, 0, eofOps(STOP, STOP)}}, errEOFUnreachableCode},
+		{"underflow", nil, []eofTestSection{{0, eofNonReturning, 0, eofOps(ADD, STOP)}}, errEOFStackUnderflow},
+		{"no terminator", nil, []eofTestSection{{0, eofNonReturning, 1, eofOps(PUSH1, 0)}}, errEOFNoTerminator},
+		{"max stack", nil, []eofTestSection{{0, eofNonReturning, 2, eofOps(PUSH1, 0, POP, STOP)}}, errEOFMaxStackHeightMismatch},
+		{"height mismatch", nil, []eofTestSection{{0, eofNonReturning, 1, eofOps(PUSH1, 1, RJUMPI, 0, 2, PUSH1, 0, STOP)}}, errEOFStackHeightMismatch},
+		{"retf height", nil, []eofTestSection{
+			{0, eofNonReturning, 1, eofOps(CALLF, 0, 1, STOP)},
+			{0, 1, 2, eofOps(PUSH1, 0, DUP1, RETF)},
+		}, errEOFStackHeightMismatch},
+		{"data offset", make([]byte, 16), []eofTestSection{{0, eofNonReturning, 1, eofOps(DATALOADN, 0, 0, STOP)}}, errEOFInvalidDataOffset},
+		{"functions", make([]byte, 32), []eofTestSection{
+			{0, eofNonReturning, 1, eofOps(DATALOADN, 0, 0, CALLF, 0, 1, POP, JUMPF, 0, 2)},
+			{1, 1, 2, eofOps(DUP1, ADD, RETF)},
+			{0, eofNonReturning, 0, eofOps(STOP)},
+		}, nil},
+	}
+	for _, test := range tests {
+		_, err := validateEOF(eofCode(test.data, test.sections...), &eofInstructionSet)
+		assert.Equal(t, test.err, eofCause(err), test.name)
+	}
+}
+
+func eofTestEVM(fork bool) *EVM {
+	config := *params.TestChainConfig
+	if fork {
+		config.EOFBlock = big.NewInt(0)
+	}
+	repo := mockPreBlockChain()
+	return NewEVMWithConfig(mockEVM(repo).Context, repo, &config, Config{})
+}
+
+func TestEOFExecution(t *testing.T) {
+	assert := assert.New(t)
+
+	// Double a value from the data section in a function.
+	double := eofCode(util.HashToBytes(util.BigToHash(big.NewInt(21))),
+		eofTestSection{0, eofNonReturning, 2, eofOps(DATALOADN, 0, 0, CALLF, 0, 1, PUSH1, 0, MSTORE, PUSH1, 32, PUSH1, 0, RETURN)},
+		eofTestSection{1, 1, 2, eofOps(DUP1, ADD, RETF)},
+	)
+	// Count down from three.
+	loop := eofCode(nil, eofTestSection{0, eofNonReturning, 2, eofOps(
+		PUSH1, 3, PUSH1, 1, SWAP1, SUB, DUP1, RJUMPI, 0xff, 0xf8,
+		PUSH1, 0, MSTORE, PUSH1, 32, PUSH1, 0, RETURN,
+	)})
+	// Select a value by the first word of the input.
+	jumpTable := eofCode(nil, eofTestSection{0, eofNonReturning, 2, eofOps(
+		PUSH1, 0, CALLDATALOAD, RJUMPV, 1, 0, 5, 0, 10,
+		PUSH1, 0xaa, RJUMP, 0, 7,
+		PUSH1, 0xbb, RJUMP, 0, 2,
+		PUSH1, 0xcc,
+		PUSH1, 0, MSTORE, PUSH1, 32, PUSH1, 0, RETURN,
+	)})
+
+	call := func(code []byte, input []byte) ([]byte, error) {
+		evm := eofTestEVM(true)
+		evm.StateDB.SetCode(contractAddress, code)
+		ret, _, err := evm.Call(AccountRef(callerAddress), contractAddress, input, 100000, big.NewInt(0))
+		return ret, err
+	}
+	ret, err := call(double, nil)
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(util.BigToHash(big.NewInt(42))), ret)
+
+	ret, err = call(loop, nil)
+	assert.Nil(err)
+	assert.Equal(make([]byte, 32), ret)
+
+	for input, want := range map[int64]int64{0: 0xbb, 1: 0xcc, 5: 0xaa} {
+		ret, err = call(jumpTable, util.HashToBytes(util.BigToHash(big.NewInt(input))))
+		assert.Nil(err)
+		assert.Equal(util.HashToBytes(util.BigToHash(big.NewInt(want))), ret)
+	}
+
+	// Invalid containers are not executed.
+	_, err = call(eofCode(nil, eofTestSection{0, eofNonReturning, 1, eofOps(PUSH1, 0, JUMP)}), nil)
+	assert.NotNil(err)
+
+	// Before the fork the magic is an undefined legacy instruction.
+	evm := eofTestEVM(false)
+	evm.StateDB.SetCode(contractAddress, double)
+	_, _, err = evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.NotNil(err)
+}
+
+func TestEOFCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	runtime := eofCode(nil, eofStop)
+	// Copy the data section to memory and deploy it.
+	initcode := eofCode(runtime, eofTestSection{0, eofNonReturning, 3, eofOps(
+		DATASIZE, PUSH1, 0, PUSH1, 0, DATACOPY, DATASIZE, PUSH1, 0, RETURN,
+	)})
+	evm := eofTestEVM(true)
+	_, addr, _, err := evm.Create(AccountRef(callerAddress), initcode, 1000000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(runtime, evm.StateDB.GetCode(addr))
+
+	// Invalid initcode consumes all gas.
+	invalid := eofCode(nil, eofTestSection{0, eofNonReturning, 1, eofOps(PUSH1, 0, JUMP)})
+	_, _, gas, err := eofTestEVM(true).Create(AccountRef(callerAddress), invalid, 1000000, big.NewInt(0))
+	assert.NotNil(err)
+	assert.Equal(uint64(0), gas)
+
+	// EOF initcode must deploy a valid container.
+	legacy := eofCode(eofOps(STOP), eofTestSection{0, eofNonReturning, 3, eofOps(
+		DATASIZE, PUSH1, 0, PUSH1, 0, DATACOPY, DATASIZE, PUSH1, 0, RETURN,
+	)})
+	_, _, _, err = eofTestEVM(true).Create(AccountRef(callerAddress), legacy, 1000000, big.NewInt(0))
+	assert.Equal(errEOFInvalidMagic, err)
+
+	// Legacy initcode may not deploy code starting with 0xef after the fork.
+	reserved := eofOps(PUSH1, eofFormatByte, PUSH1, 0, MSTORE8, PUSH1, 1, PUSH1, 0, RETURN)
+	_, _, _, err = eofTestEVM(true).Create(AccountRef(callerAddress), reserved, 1000000, big.NewInt(0))
+	assert.Equal(errInvalidCode, err)
+	evm = eofTestEVM(false)
+	_, addr, _, err = evm.Create(AccountRef(callerAddress), reserved, 1000000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal([]byte{eofFormatByte}, evm.StateDB.GetCode(addr))
+}
@@ -17,6 +17,7 @@
 package evm
 
 import (
+	"fmt"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/crypto-suite/crypto"
 	"github.com/DSiSc/evm-NG/params"
@@ -43,13 +44,18 @@ type (
 
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
+	if evm.interpreterErr != nil {
+		return nil, evm.interpreterErr
+	}
+	if readOnly && !evm.readOnly {
+		evm.readOnly = true
+		defer func() { evm.readOnly = false }()
+	}
+	readOnly = evm.readOnly
+
 	if contract.CodeAddr != nil {
-		precompiles := PrecompiledContractsHomestead
-		if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if p := precompiles[*contract.CodeAddr]; p != nil {
-			return RunPrecompiledContract(p, input, contract)
+		if p, ok := evm.Precompile(*contract.CodeAddr); ok {
+			return runPrecompiledContract(evm, p, input, contract, readOnly)
 		}
 	}
 	for _, interpreter := range evm.interpreters {
@@ -112,13 +118,27 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
 	chainRules params.Rules
+	// precompiles are the precompiled contracts active in the block,
+	// customPrecompiles those added outside the default set
+	precompiles       map[types.Address]PrecompiledContract
+	customPrecompiles map[types.Address]bool
+	// systemContracts are the system contracts active in the block
+	systemContracts map[types.Address]*SystemContract
+	// jumpTable and eofJumpTable are the instructions available to
+	// legacy and EOF code
+	jumpTable    *JumpTable
+	eofJumpTable *JumpTable
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
 	// global (to this context) ethereum virtual machine
 	// used throughout the execution of the tx.
-	interpreters []Interpreter
-	interpreter  Interpreter
+	interpreters   []Interpreter
+	interpreter    Interpreter
+	interpreterErr error // invalid interpreter configuration
+	// readOnly is set while executing a static call, which applies to all
+	// nested calls whatever interpreter executes them
+	readOnly bool
 	// abort is used to abort the EVM calling operations
 	// NOTE: must be set atomically
 	abort int32
@@ -131,40 +151,43 @@ type EVM struct {
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
 // only ever be used *once*.
 func NewEVM(ctx Context, statedb *repository.Repository) *EVM {
-	chainConfig := params.MainnetChainConfig
 	vmConfig := Config{
 		Debug:                   false,
 		NoRecursion:             false,
 		EnablePreimageRecording: false,
 	}
+	return NewEVMWithConfig(ctx, statedb, params.MainnetChainConfig, vmConfig)
+}
+
+// NewEVMWithConfig returns a new EVM running with the given chain and
+// interpreter configuration. The returned EVM is not thread safe and should
+// only ever be used *once*.
+func NewEVMWithConfig(ctx Context, statedb *repository.Repository, chainConfig *params.ChainConfig, vmConfig Config) *EVM {
 	evm := &EVM{
-		Context:      ctx,
-		StateDB:      statedb,
-		vmConfig:     vmConfig,
-		chainConfig:  chainConfig,
-		chainRules:   chainConfig.Rules(ctx.BlockNumber),
-		interpreters: make([]Interpreter, 0, 1),
-	}
-
-	if chainConfig.IsEWASM(ctx.BlockNumber) {
-		// to be implemented by EVM-C and Wagon PRs.
-		// if vmConfig.EWASMInterpreter != "" {
-		//  extIntOpts := strings.Split(vmConfig.EWASMInterpreter, ":")
-		//  path := extIntOpts[0]
-		//  options := []string{}
-		//  if len(extIntOpts) > 1 {
-		//    options = extIntOpts[1..]
-		//  }
-		//  evm.interpreters = append(evm.interpreters, NewEVMVCInterpreter(evm, vmConfig, options))
-		// } else {
-		// 	evm.interpreters = append(evm.interpreters, NewEWASMInterpreter(evm, vmConfig))
-		// }
-		panic("No supported ewasm interpreter yet.")
-	}
-
-	// vmConfig.EVMInterpreter will be used by EVM-C, it won't be checked here
-	// as we always want to have the built-in EVM as the failover option.
-	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
+		Context:     ctx,
+		StateDB:     statedb,
+		vmConfig:    vmConfig,
+		chainConfig: chainConfig,
+		chainRules:  chainConfig.Rules(ctx.BlockNumber),
+	}
+	evm.precompiles, evm.customPrecompiles = resolvePrecompiles(chainConfig, ctx.BlockNumber, vmConfig.Precompiles)
+	systemContracts := vmConfig.SystemContracts
+	if systemContracts == nil {
+		systemContracts = DefaultSystemContracts
+	}
+	evm.systemContracts = systemContracts.Active(chainConfig.ChainID, ctx.BlockNumber)
+	evm.jumpTable, evm.eofJumpTable = instructionSets(vmConfig.JumpTable)
+
+	// The interpreters are tried in order, see ParseInterpreterConfig for the
+	// format of vmConfig.EVMInterpreter and vmConfig.EWASMInterpreter.
+	interpreters, err := newInterpreters(evm, vmConfig)
+	if err != nil {
+		// An invalid configuration fails every execution, the built-in
+		// interpreter is only set for inspection.
+		evm.interpreterErr = fmt.Errorf("invalid interpreter configuration: %v", err)
+		interpreters = []Interpreter{NewEVMInterpreter(evm, vmConfig)}
+	}
+	evm.interpreters = interpreters
 	evm.interpreter = evm.interpreters[0]
 
 	return evm
@@ -181,6 +204,30 @@ func (evm *EVM) Interpreter() Interpreter {
 	return evm.interpreter
 }
 
+// InterpreterError returns the error of an invalid interpreter
+// configuration, e.g. an unknown interpreter name, which fails every
+// execution of the EVM.
+func (evm *EVM) InterpreterError() error {
+	return evm.interpreterErr
+}
+
+// captureBegin reports the start of a call frame to the tracer, which is the
+// transaction itself at the top level and a nested call otherwise. The
+// returned function reports the end of the frame.
+func (evm *EVM) captureBegin(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) func(output []byte, leftOverGas uint64, err error) {
+	tracer := evm.vmConfig.Tracer
+	if evm.depth == 0 {
+		tracer.CaptureTxStart(evm, gas)
+		return func(output []byte, leftOverGas uint64, err error) {
+			tracer.CaptureTxEnd(leftOverGas)
+		}
+	}
+	tracer.CaptureEnter(typ, from, to, input, gas, value)
+	return func(output []byte, leftOverGas uint64, err error) {
+		tracer.CaptureExit(output, gas-leftOverGas, err)
+	}
+}
+
 // Call executes the contract associated with the addr with the given input as
 // parameters. It also handles any necessary value transfer required and takes
 // the necessary steps to create accounts and reverses the state in case of an
@@ -189,6 +236,10 @@ func (evm *EVM) Call(caller ContractRef, addr types.Address, input []byte, gas u
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CallTypeCall, caller.Address(), addr, input, gas, value)
+		defer func() { captureEnd(ret, leftOverGas, err) }()
+	}
 
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
@@ -204,11 +255,7 @@ func (evm *EVM) Call(caller ContractRef, addr types.Address, input []byte, gas u
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsHomestead
-		if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
+		if _, ok := evm.Precompile(addr); !ok && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
 			// Calling a non existing account, don't do anything, but ping the tracer
 			if evm.vmConfig.Debug && evm.depth == 0 {
 				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
@@ -260,6 +307,10 @@ func (evm *EVM) CallCode(caller ContractRef, addr types.Address, input []byte, g
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CallTypeCallCode, caller.Address(), addr, input, gas, value)
+		defer func() { captureEnd(ret, leftOverGas, err) }()
+	}
 
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
@@ -298,6 +349,10 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr types.Address, input []byt
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CallTypeDelegateCall, caller.Address(), addr, input, gas, nil)
+		defer func() { captureEnd(ret, leftOverGas, err) }()
+	}
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
@@ -330,6 +385,10 @@ func (evm *EVM) StaticCall(caller ContractRef, addr types.Address, input []byte,
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CallTypeStaticCall, caller.Address(), addr, input, gas, nil)
+		defer func() { captureEnd(ret, leftOverGas, err) }()
+	}
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
@@ -376,7 +435,11 @@ func (c *codeAndHash) Hash() types.Hash {
 }
 
 // create creates a new contract using code as deployment code.
-func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address types.Address) ([]byte, types.Address, uint64, error) {
+func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address types.Address, typ CallType) (ret []byte, contractAddr types.Address, leftOverGas uint64, err error) {
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(typ, caller.Address(), address, codeAndHash.code, gas, value)
+		defer func() { captureEnd(ret, leftOverGas, err) }()
+	}
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
 	if evm.depth > int(params.CallCreateDepth) {
@@ -393,6 +456,12 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if evm.StateDB.GetNonce(address) != 0 || (contractHash != (types.Hash{}) && contractHash != emptyCodeHash) {
 		return nil, types.Address{}, 0, ErrContractAddressCollision
 	}
+	// EOF initcode is validated upfront, an invalid container consumes all gas.
+	if evm.ChainConfig().IsEOF(evm.BlockNumber) && hasEOFMagic(codeAndHash.code) {
+		if _, err := validateEOF(codeAndHash.code, evm.eofJumpTable); err != nil {
+			return nil, types.Address{}, 0, err
+		}
+	}
 	// Create a new account on the state
 	snapshot := evm.StateDB.Snapshot()
 	evm.StateDB.CreateAccount(address)
@@ -415,8 +484,12 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	}
 	start := time.Now()
 
-	ret, err := run(evm, contract, nil, false)
+	ret, err = run(evm, contract, nil, false)
 
+	// check the deployed code against the EOF rules
+	if err == nil && evm.ChainConfig().IsEOF(evm.BlockNumber) {
+		err = checkDeployedCode(codeAndHash.code, ret, evm.eofJumpTable)
+	}
 	// check whether the max code size has been exceeded
 	maxCodeSizeExceeded := evm.ChainConfig().IsEIP158(evm.BlockNumber) && len(ret) > params.MaxCodeSize
 	// if the contract creation ran successfully and no errors were returned
@@ -455,7 +528,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 // Create creates a new contract using code as deployment code.
 func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr types.Address, leftOverGas uint64, err error) {
 	contractAddr = crypto.CreateAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
-	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr)
+	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr, CallTypeCreate)
 }
 
 // Create2 creates a new contract using code as deployment code.
@@ -465,7 +538,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *big.Int, salt *big.Int) (ret []byte, contractAddr types.Address, leftOverGas uint64, err error) {
 	codeAndHash := &codeAndHash{code: code}
 	contractAddr = crypto.CreateAddress2(caller.Address(), util.BigToHash(salt), util.HashToBytes(codeAndHash.Hash()))
-	return evm.create(caller, codeAndHash, gas, endowment, contractAddr)
+	return evm.create(caller, codeAndHash, gas, endowment, contractAddr, CallTypeCreate2)
 }
 
 // ChainConfig returns the environment's chain configuration
@@ -0,0 +1,770 @@
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/evm-NG/common"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/DSiSc/evm-NG/wasm"
+)
+
+// eeiNamespace is the import module of the Ethereum Environment Interface.
+const eeiNamespace = "ethereum"
+
+// ewasmMemoryPageGas is charged per page of linear memory a contract grows,
+// it matches the linear cost of expanding EVM memory by the same amount.
+const ewasmMemoryPageGas = params.MemoryGas * wasm.PageSize / 32
+
+// ewasmMaxMemoryPages caps the linear memory of a contract to 64MiB.
+const ewasmMaxMemoryPages = 1024
+
+// ewasmCacheSize is the number of compiled modules kept in memory.
+const ewasmCacheSize = 256
+
+var (
+	errEEIFinish        = errors.New("ewasm: finish")
+	errEEIRevert        = errors.New("ewasm: revert")
+	errEEIInvalidModule = errors.New("ewasm: contract must export main and memory")
+	errEEIStartFunction = errors.New("ewasm: contract must not have a start function")
+	errEEIInvalidTopics = errors.New("ewasm: invalid number of log topics")
+)
+
+// ewasmModules caches compiled modules by code hash, so contracts are only
+// validated and translated once.
+var ewasmModules = struct {
+	sync.Mutex
+	modules map[types.Hash]*wasm.CompiledModule
+}{modules: make(map[types.Hash]*wasm.CompiledModule)}
+
+// EWASMInterpreter runs WebAssembly contracts. Contracts interact with the
+// state through the host functions of the Ethereum Environment Interface
+// and are metered by gas charges inserted at every basic block.
+type EWASMInterpreter struct {
+	evm      *EVM
+	cfg      Config
+	gasTable params.GasTable
+	vmConfig wasm.Config // Limits of the WebAssembly instances
+
+	readOnly   bool   // Whether to throw on stateful modifications
+	returnData []byte // Last call's return data for subsequent reuse
+}
+
+// NewEWASMInterpreter returns a new instance of the eWASM interpreter.
+func NewEWASMInterpreter(evm *EVM, cfg Config) *EWASMInterpreter {
+	return &EWASMInterpreter{
+		evm:      evm,
+		cfg:      cfg,
+		gasTable: evm.ChainConfig().GasTable(evm.BlockNumber),
+		vmConfig: wasm.Config{
+			MaxMemoryPages: ewasmMaxMemoryPages,
+			MaxCallDepth:   int(params.CallCreateDepth),
+			MemoryPageGas:  ewasmMemoryPageGas,
+		},
+	}
+}
+
+// CanRun tells whether the code is a WebAssembly module.
+func (in *EWASMInterpreter) CanRun(code []byte) bool {
+	return wasm.HasMagic(code)
+}
+
+// Run executes the main function of a WebAssembly contract. The return data
+// is set by the finish or revert host functions.
+func (in *EWASMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	in.evm.depth++
+	defer func() { in.evm.depth-- }()
+
+	if readOnly && !in.readOnly {
+		in.readOnly = true
+		defer func() { in.readOnly = false }()
+	}
+	in.returnData = nil
+
+	if len(contract.Code) == 0 {
+		return nil, nil
+	}
+	module, err := in.compile(contract)
+	if err != nil {
+		return nil, err
+	}
+	frame := &eeiFrame{in: in, contract: contract, input: input}
+	// The initial memory is charged by the meter before it is allocated
+	vmConfig := in.vmConfig
+	vmConfig.Meter = frame.meter
+	vm, err := wasm.NewVM(module, frame.resolve, vmConfig)
+	if err != nil {
+		return nil, err
+	}
+	main, err := vm.ExportedFunction("main")
+	if err != nil {
+		return nil, err
+	}
+	switch _, err = vm.Invoke(main); err {
+	case nil, errEEIFinish:
+		return frame.ret, nil
+	case errEEIRevert:
+		return frame.ret, errExecutionReverted
+	}
+	return nil, err
+}
+
+// compile validates and translates the contract code, or returns the cached
+// result of an earlier compilation.
+func (in *EWASMInterpreter) compile(contract *Contract) (*wasm.CompiledModule, error) {
+	hash := contract.CodeHash
+	if hash == (types.Hash{}) {
+		hash = crypto.Keccak256Hash(contract.Code)
+	}
+	ewasmModules.Lock()
+	module := ewasmModules.modules[hash]
+	ewasmModules.Unlock()
+	if module != nil {
+		return module, nil
+	}
+
+	m, err := wasm.DecodeModule(contract.Code)
+	if err != nil {
+		return nil, err
+	}
+	if m.Start != nil {
+		return nil, errEEIStartFunction
+	}
+	main, ok := m.Export("main")
+	if !ok || main.Kind != wasm.ExternalFunction {
+		return nil, errEEIInvalidModule
+	}
+	if mem, ok := m.Export("memory"); !ok || mem.Kind != wasm.ExternalMemory {
+		return nil, errEEIInvalidModule
+	}
+	for _, imp := range m.Imports {
+		if imp.Module != eeiNamespace {
+			return nil, fmt.Errorf("ewasm: import from unknown namespace %q", imp.Module)
+		}
+		if _, ok := eeiFunctions[imp.Field]; !ok {
+			return nil, fmt.Errorf("ewasm: unknown host function %q", imp.Field)
+		}
+	}
+	if module, err = wasm.Compile(m, nil); err != nil {
+		return nil, err
+	}
+	if sig, _ := module.Signature(main.Index); len(sig.Params) != 0 || len(sig.Results) != 0 {
+		return nil, errEEIInvalidModule
+	}
+
+	ewasmModules.Lock()
+	if len(ewasmModules.modules) >= ewasmCacheSize {
+		ewasmModules.modules = make(map[types.Hash]*wasm.CompiledModule)
+	}
+	ewasmModules.modules[hash] = module
+	ewasmModules.Unlock()
+	return module, nil
+}
+
+// eeiFrame is the host side state of a single contract execution.
+type eeiFrame struct {
+	in       *EWASMInterpreter
+	contract *Contract
+	input    []byte
+	ret      []byte // data passed to finish or revert
+}
+
+// eeiFunction is a host function of the Ethereum Environment Interface.
+type eeiFunction struct {
+	params  []wasm.ValueType
+	results []wasm.ValueType
+	call    func(f *eeiFrame, vm *wasm.VM, args []uint64) (uint64, error)
+}
+
+var (
+	wasmI32 = wasm.ValueTypeI32
+	wasmI64 = wasm.ValueTypeI64
+)
+
+// eeiFunctions lists the host functions by their import name.
+var eeiFunctions = map[string]eeiFunction{
+	"useGas":              {[]wasm.ValueType{wasmI64}, nil, (*eeiFrame).useGas},
+	"getGasLeft":          {nil, []wasm.ValueType{wasmI64}, (*eeiFrame).getGasLeft},
+	"getAddress":          {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getAddress},
+	"getExternalBalance":  {[]wasm.ValueType{wasmI32, wasmI32}, nil, (*eeiFrame).getExternalBalance},
+	"getBlockHash":        {[]wasm.ValueType{wasmI64, wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).getBlockHash},
+	"call":                {[]wasm.ValueType{wasmI64, wasmI32, wasmI32, wasmI32, wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).call},
+	"callCode":            {[]wasm.ValueType{wasmI64, wasmI32, wasmI32, wasmI32, wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).callCode},
+	"callDelegate":        {[]wasm.ValueType{wasmI64, wasmI32, wasmI32, wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).callDelegate},
+	"callStatic":          {[]wasm.ValueType{wasmI64, wasmI32, wasmI32, wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).callStatic},
+	"create":              {[]wasm.ValueType{wasmI32, wasmI32, wasmI32, wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).create},
+	"callDataCopy":        {[]wasm.ValueType{wasmI32, wasmI32, wasmI32}, nil, (*eeiFrame).callDataCopy},
+	"getCallDataSize":     {nil, []wasm.ValueType{wasmI32}, (*eeiFrame).getCallDataSize},
+	"getCaller":           {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getCaller},
+	"getCallValue":        {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getCallValue},
+	"codeCopy":            {[]wasm.ValueType{wasmI32, wasmI32, wasmI32}, nil, (*eeiFrame).codeCopy},
+	"getCodeSize":         {nil, []wasm.ValueType{wasmI32}, (*eeiFrame).getCodeSize},
+	"externalCodeCopy":    {[]wasm.ValueType{wasmI32, wasmI32, wasmI32, wasmI32}, nil, (*eeiFrame).externalCodeCopy},
+	"getExternalCodeSize": {[]wasm.ValueType{wasmI32}, []wasm.ValueType{wasmI32}, (*eeiFrame).getExternalCodeSize},
+	"getBlockCoinbase":    {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getBlockCoinbase},
+	"getBlockDifficulty":  {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getBlockDifficulty},
+	"getBlockGasLimit":    {nil, []wasm.ValueType{wasmI64}, (*eeiFrame).getBlockGasLimit},
+	"getBlockNumber":      {nil, []wasm.ValueType{wasmI64}, (*eeiFrame).getBlockNumber},
+	"getBlockTimestamp":   {nil, []wasm.ValueType{wasmI64}, (*eeiFrame).getBlockTimestamp},
+	"getTxGasPrice":       {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getTxGasPrice},
+	"getTxOrigin":         {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).getTxOrigin},
+	"log":                 {[]wasm.ValueType{wasmI32, wasmI32, wasmI32, wasmI32, wasmI32, wasmI32, wasmI32}, nil, (*eeiFrame).log},
+	"finish":              {[]wasm.ValueType{wasmI32, wasmI32}, nil, (*eeiFrame).finish},
+	"revert":              {[]wasm.ValueType{wasmI32, wasmI32}, nil, (*eeiFrame).revert},
+	"getReturnDataSize":   {nil, []wasm.ValueType{wasmI32}, (*eeiFrame).getReturnDataSize},
+	"returnDataCopy":      {[]wasm.ValueType{wasmI32, wasmI32, wasmI32}, nil, (*eeiFrame).returnDataCopy},
+	"selfDestruct":        {[]wasm.ValueType{wasmI32}, nil, (*eeiFrame).selfDestruct},
+	"storageStore":        {[]wasm.ValueType{wasmI32, wasmI32}, nil, (*eeiFrame).storageStore},
+	"storageLoad":         {[]wasm.ValueType{wasmI32, wasmI32}, nil, (*eeiFrame).storageLoad},
+}
+
+// resolve binds the imports of a module to the host functions of the frame.
+func (f *eeiFrame) resolve(module, field string) (*wasm.HostFunction, error) {
+	fn, ok := eeiFunctions[field]
+	if module != eeiNamespace || !ok {
+		return nil, fmt.Errorf("ewasm: unknown host function %s.%s", module, field)
+	}
+	return &wasm.HostFunction{
+		Sig: wasm.FunctionSig{Params: fn.params, Results: fn.results},
+		Call: func(vm *wasm.VM, args []uint64) (uint64, error) {
+			return fn.call(f, vm, args)
+		},
+	}, nil
+}
+
+// meter charges gas on behalf of the instrumented contract code.
+func (f *eeiFrame) meter(gas uint64) error {
+	if !f.contract.UseGas(gas) {
+		return ErrOutOfGas
+	}
+	return nil
+}
+
+// copyGas charges the cost of copying size bytes.
+func (f *eeiFrame) copyGas(size uint64) error {
+	return f.meter(GasFastestStep + toWordSize(size)*params.CopyGas)
+}
+
+func (f *eeiFrame) writeProtected() error {
+	if f.in.readOnly {
+		return errWriteProtection
+	}
+	return nil
+}
+
+// disabled fails if the instruction matching a host function is disabled in
+// the jump table of the EVM.
+func (f *eeiFrame) disabled(op OpCode) error {
+	if !f.in.evm.jumpTable[op].valid {
+		return fmt.Errorf("ewasm: %v is disabled", op)
+	}
+	return nil
+}
+
+func readAddress(vm *wasm.VM, offset uint64) (types.Address, error) {
+	b, err := vm.MemoryRead(uint32(offset), util.AddressLength)
+	if err != nil {
+		return types.Address{}, err
+	}
+	return util.BytesToAddress(b), nil
+}
+
+// readU128 reads a little endian 128 bit value.
+func readU128(vm *wasm.VM, offset uint64) (*big.Int, error) {
+	b, err := vm.MemoryRead(uint32(offset), 16)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(reverse(b)), nil
+}
+
+// writeLittleEndian stores v as a little endian integer of size bytes.
+func writeLittleEndian(vm *wasm.VM, offset uint64, v *big.Int, size int) error {
+	if v == nil {
+		v = new(big.Int)
+	}
+	b := common.LeftPadBytes(v.Bytes(), size)
+	return vm.MemoryWrite(uint32(offset), reverse(b[len(b)-size:]))
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func (f *eeiFrame) useGas(vm *wasm.VM, args []uint64) (uint64, error) {
+	return 0, f.meter(args[0])
+}
+
+func (f *eeiFrame) getGasLeft(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return f.contract.Gas, nil
+}
+
+func (f *eeiFrame) getAddress(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	addr := f.contract.Address()
+	return 0, vm.MemoryWrite(uint32(args[0]), addr[:])
+}
+
+func (f *eeiFrame) getExternalBalance(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(f.in.gasTable.Balance); err != nil {
+		return 0, err
+	}
+	addr, err := readAddress(vm, args[0])
+	if err != nil {
+		return 0, err
+	}
+	return 0, writeLittleEndian(vm, args[1], f.in.evm.StateDB.GetBalance(addr), 16)
+}
+
+func (f *eeiFrame) getBlockHash(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasExtStep); err != nil {
+		return 0, err
+	}
+	var (
+		num     = new(big.Int).SetUint64(args[0])
+		current = f.in.evm.BlockNumber
+	)
+	if num.Cmp(new(big.Int).Sub(current, common.Big257)) <= 0 || num.Cmp(current) >= 0 {
+		return 1, nil
+	}
+	hash := f.in.evm.GetHash(args[0])
+	return 0, vm.MemoryWrite(uint32(args[1]), hash[:])
+}
+
+// callKind selects the message call variant of eeiFrame.doCall.
+type callKind int
+
+const (
+	callKindCall callKind = iota
+	callKindCallCode
+	callKindDelegate
+	callKindStatic
+)
+
+func (f *eeiFrame) call(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.disabled(CALL); err != nil {
+		return 0, err
+	}
+	return f.doCall(vm, callKindCall, args[0], args[1], args[2], true, args[3], args[4])
+}
+
+func (f *eeiFrame) callCode(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.disabled(CALLCODE); err != nil {
+		return 0, err
+	}
+	return f.doCall(vm, callKindCallCode, args[0], args[1], args[2], true, args[3], args[4])
+}
+
+func (f *eeiFrame) callDelegate(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.disabled(DELEGATECALL); err != nil {
+		return 0, err
+	}
+	return f.doCall(vm, callKindDelegate, args[0], args[1], 0, false, args[2], args[3])
+}
+
+func (f *eeiFrame) callStatic(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.disabled(STATICCALL); err != nil {
+		return 0, err
+	}
+	return f.doCall(vm, callKindStatic, args[0], args[1], 0, false, args[2], args[3])
+}
+
+// doCall performs a message call and returns 0 on success, 1 on failure and
+// 2 if the callee reverted.
+func (f *eeiFrame) doCall(vm *wasm.VM, kind callKind, gas, addrOffset, valueOffset uint64, hasValue bool, dataOffset, dataLength uint64) (uint64, error) {
+	var (
+		evm   = f.in.evm
+		value = new(big.Int)
+		err   error
+	)
+	addr, err := readAddress(vm, addrOffset)
+	if err != nil {
+		return 0, err
+	}
+	if hasValue {
+		if value, err = readU128(vm, valueOffset); err != nil {
+			return 0, err
+		}
+	}
+	input, err := vm.MemoryRead(uint32(dataOffset), uint32(dataLength))
+	if err != nil {
+		return 0, err
+	}
+
+	cost := f.in.gasTable.Calls
+	transfersValue := value.Sign() != 0
+	if transfersValue {
+		if kind == callKindCall {
+			if err := f.writeProtected(); err != nil {
+				return 0, err
+			}
+		}
+		cost += params.CallValueTransferGas
+		if kind == callKindCall && evm.chainRules.IsEIP158 && evm.StateDB.Empty(addr) {
+			cost += params.CallNewAccountGas
+		}
+	}
+	if kind == callKindCall && !evm.chainRules.IsEIP158 && !evm.StateDB.Exist(addr) {
+		cost += params.CallNewAccountGas
+	}
+	if err := f.meter(cost); err != nil {
+		return 0, err
+	}
+	// All but one 64th of the remaining gas may be passed on.
+	if available := f.contract.Gas - f.contract.Gas/64; gas > available {
+		gas = available
+	}
+	f.contract.UseGas(gas)
+	if transfersValue {
+		gas += params.CallStipend
+	}
+
+	var (
+		ret       []byte
+		returnGas uint64
+	)
+	switch kind {
+	case callKindCall:
+		if evm.systemContracts[addr] != nil {
+			ret, returnGas, err = sysContractCall(evm, f.contract.self, addr, input, gas, value, f.in.readOnly)
+		} else {
+			ret, returnGas, err = evm.Call(f.contract, addr, input, gas, value)
+		}
+	case callKindCallCode:
+		ret, returnGas, err = evm.CallCode(f.contract, addr, input, gas, value)
+	case callKindDelegate:
+		ret, returnGas, err = evm.DelegateCall(f.contract, addr, input, gas)
+	case callKindStatic:
+		ret, returnGas, err = evm.StaticCall(f.contract, addr, input, gas)
+	}
+	f.contract.Gas += returnGas
+	f.in.returnData = ret
+
+	switch err {
+	case nil:
+		return 0, nil
+	case errExecutionReverted:
+		return 2, nil
+	}
+	return 1, nil
+}
+
+func (f *eeiFrame) create(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.disabled(CREATE); err != nil {
+		return 0, err
+	}
+	if err := f.writeProtected(); err != nil {
+		return 0, err
+	}
+	if err := f.meter(params.CreateGas); err != nil {
+		return 0, err
+	}
+	value, err := readU128(vm, args[0])
+	if err != nil {
+		return 0, err
+	}
+	code, err := vm.MemoryRead(uint32(args[1]), uint32(args[2]))
+	if err != nil {
+		return 0, err
+	}
+	gas := f.contract.Gas
+	if f.in.evm.chainRules.IsEIP150 {
+		gas -= gas / 64
+	}
+	f.contract.UseGas(gas)
+
+	ret, addr, returnGas, err := f.in.evm.Create(f.contract, code, gas, value)
+	f.contract.Gas += returnGas
+
+	switch err {
+	case nil:
+		f.in.returnData = nil
+		return 0, vm.MemoryWrite(uint32(args[3]), addr[:])
+	case errExecutionReverted:
+		f.in.returnData = ret
+		return 2, nil
+	}
+	f.in.returnData = nil
+	return 1, nil
+}
+
+func (f *eeiFrame) callDataCopy(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.copyGas(args[2]); err != nil {
+		return 0, err
+	}
+	return 0, vm.MemoryWrite(uint32(args[0]), getData(f.input, args[1], args[2]))
+}
+
+func (f *eeiFrame) getCallDataSize(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return uint64(len(f.input)), nil
+}
+
+func (f *eeiFrame) getCaller(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	caller := f.contract.Caller()
+	return 0, vm.MemoryWrite(uint32(args[0]), caller[:])
+}
+
+func (f *eeiFrame) getCallValue(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return 0, writeLittleEndian(vm, args[0], f.contract.Value(), 16)
+}
+
+func (f *eeiFrame) codeCopy(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.copyGas(args[2]); err != nil {
+		return 0, err
+	}
+	return 0, vm.MemoryWrite(uint32(args[0]), getData(f.contract.Code, args[1], args[2]))
+}
+
+func (f *eeiFrame) getCodeSize(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return uint64(len(f.contract.Code)), nil
+}
+
+func (f *eeiFrame) externalCodeCopy(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(f.in.gasTable.ExtcodeCopy); err != nil {
+		return 0, err
+	}
+	if err := f.copyGas(args[3]); err != nil {
+		return 0, err
+	}
+	addr, err := readAddress(vm, args[0])
+	if err != nil {
+		return 0, err
+	}
+	code := f.in.evm.StateDB.GetCode(addr)
+	return 0, vm.MemoryWrite(uint32(args[1]), getData(code, args[2], args[3]))
+}
+
+func (f *eeiFrame) getExternalCodeSize(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(f.in.gasTable.ExtcodeSize); err != nil {
+		return 0, err
+	}
+	addr, err := readAddress(vm, args[0])
+	if err != nil {
+		return 0, err
+	}
+	return uint64(f.in.evm.StateDB.GetCodeSize(addr)), nil
+}
+
+func (f *eeiFrame) getBlockCoinbase(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return 0, vm.MemoryWrite(uint32(args[0]), f.in.evm.Coinbase[:])
+}
+
+func (f *eeiFrame) getBlockDifficulty(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return 0, writeLittleEndian(vm, args[0], f.in.evm.Difficulty, 32)
+}
+
+func (f *eeiFrame) getBlockGasLimit(vm *wasm.VM, args []uint64) (uint64, error) {
+	return f.in.evm.GasLimit, f.meter(GasQuickStep)
+}
+
+func (f *eeiFrame) getBlockNumber(vm *wasm.VM, args []uint64) (uint64, error) {
+	return f.in.evm.BlockNumber.Uint64(), f.meter(GasQuickStep)
+}
+
+func (f *eeiFrame) getBlockTimestamp(vm *wasm.VM, args []uint64) (uint64, error) {
+	return f.in.evm.Time.Uint64(), f.meter(GasQuickStep)
+}
+
+func (f *eeiFrame) getTxGasPrice(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return 0, writeLittleEndian(vm, args[0], f.in.evm.GasPrice, 16)
+}
+
+func (f *eeiFrame) getTxOrigin(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return 0, vm.MemoryWrite(uint32(args[0]), f.in.evm.Origin[:])
+}
+
+func (f *eeiFrame) log(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.writeProtected(); err != nil {
+		return 0, err
+	}
+	n := uint32(args[2])
+	if n > 4 {
+		return 0, errEEIInvalidTopics
+	}
+	if err := f.disabled(LOG0 + OpCode(n)); err != nil {
+		return 0, err
+	}
+	if err := f.meter(params.LogGas + uint64(n)*params.LogTopicGas + uint64(uint32(args[1]))*params.LogDataGas); err != nil {
+		return 0, err
+	}
+	data, err := vm.MemoryRead(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return 0, err
+	}
+	topics := make([]types.Hash, n)
+	for i := range topics {
+		b, err := vm.MemoryRead(uint32(args[3+i]), 32)
+		if err != nil {
+			return 0, err
+		}
+		topics[i] = util.BytesToHash(b)
+	}
+	f.in.evm.StateDB.AddLog(&types.Log{
+		Address:     f.contract.Address(),
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: f.in.evm.BlockNumber.Uint64(),
+	})
+	return 0, nil
+}
+
+func (f *eeiFrame) finish(vm *wasm.VM, args []uint64) (uint64, error) {
+	ret, err := vm.MemoryRead(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return 0, err
+	}
+	f.ret = ret
+	return 0, errEEIFinish
+}
+
+func (f *eeiFrame) revert(vm *wasm.VM, args []uint64) (uint64, error) {
+	ret, err := vm.MemoryRead(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return 0, err
+	}
+	f.ret = ret
+	return 0, errEEIRevert
+}
+
+func (f *eeiFrame) getReturnDataSize(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(GasQuickStep); err != nil {
+		return 0, err
+	}
+	return uint64(len(f.in.returnData)), nil
+}
+
+func (f *eeiFrame) returnDataCopy(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.copyGas(args[2]); err != nil {
+		return 0, err
+	}
+	end := uint64(uint32(args[1])) + uint64(uint32(args[2]))
+	if end > uint64(len(f.in.returnData)) {
+		return 0, errReturnDataOutOfBounds
+	}
+	return 0, vm.MemoryWrite(uint32(args[0]), f.in.returnData[uint32(args[1]):end])
+}
+
+func (f *eeiFrame) selfDestruct(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.disabled(SELFDESTRUCT); err != nil {
+		return 0, err
+	}
+	if err := f.writeProtected(); err != nil {
+		return 0, err
+	}
+	beneficiary, err := readAddress(vm, args[0])
+	if err != nil {
+		return 0, err
+	}
+	var (
+		evm  = f.in.evm
+		self = f.contract.Address()
+		cost = f.in.gasTable.Suicide
+	)
+	if evm.chainRules.IsEIP158 {
+		if evm.StateDB.Empty(beneficiary) && evm.StateDB.GetBalance(self).Sign() != 0 {
+			cost += f.in.gasTable.CreateBySuicide
+		}
+	} else if !evm.StateDB.Exist(beneficiary) {
+		cost += f.in.gasTable.CreateBySuicide
+	}
+	if err := f.meter(cost); err != nil {
+		return 0, err
+	}
+	if !evm.StateDB.HasSuicided(self) {
+		evm.StateDB.AddRefund(params.SuicideRefundGas)
+	}
+	evm.StateDB.AddBalance(beneficiary, evm.StateDB.GetBalance(self))
+	evm.StateDB.Suicide(self)
+	return 0, errEEIFinish
+}
+
+func (f *eeiFrame) storageStore(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.writeProtected(); err != nil {
+		return 0, err
+	}
+	if err := f.disabled(SSTORE); err != nil {
+		return 0, err
+	}
+	key, err := vm.MemoryRead(uint32(args[0]), 32)
+	if err != nil {
+		return 0, err
+	}
+	val, err := vm.MemoryRead(uint32(args[1]), 32)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		evm     = f.in.evm
+		loc     = util.BytesToHash(key)
+		value   = util.BytesToHash(val)
+		current = evm.StateDB.GetHashTypeState(f.contract.Address(), loc)
+		cost    uint64
+	)
+	// Storage writes are priced by the legacy SSTORE rules.
+	switch {
+	case current == (types.Hash{}) && value != (types.Hash{}):
+		cost = params.SstoreSetGas
+	case current != (types.Hash{}) && value == (types.Hash{}):
+		cost = params.SstoreClearGas
+	default:
+		cost = params.SstoreResetGas
+	}
+	if err := f.meter(cost); err != nil {
+		return 0, err
+	}
+	if current != (types.Hash{}) && value == (types.Hash{}) {
+		evm.StateDB.AddRefund(params.SstoreRefundGas)
+	}
+	evm.StateDB.SetHashTypeState(f.contract.Address(), loc, value)
+	return 0, nil
+}
+
+func (f *eeiFrame) storageLoad(vm *wasm.VM, args []uint64) (uint64, error) {
+	if err := f.meter(f.in.gasTable.SLoad); err != nil {
+		return 0, err
+	}
+	key, err := vm.MemoryRead(uint32(args[0]), 32)
+	if err != nil {
+		return 0, err
+	}
+	val := f.in.evm.StateDB.GetHashTypeState(f.contract.Address(), util.BytesToHash(key))
+	return 0, vm.MemoryWrite(uint32(args[1]), val[:])
+}
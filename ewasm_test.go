@@ -0,0 +1,228 @@
+package evm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/DSiSc/evm-NG/wasm"
+	"github.com/stretchr/testify/assert"
+)
+
+// eeiImport describes a host function imported by a test contract.
+type eeiImport struct {
+	name    string
+	params  []byte
+	results []byte
+}
+
+// ewasmContract assembles a contract which imports the given host functions
+// and exports a main function with the given body and one page of memory.
+// Every section must be smaller than 128 bytes.
+func ewasmContract(imports []eeiImport, body ...byte) []byte {
+	section := func(id byte, payload []byte) []byte {
+		return append([]byte{id, byte(len(payload))}, payload...)
+	}
+	name := func(s string) []byte {
+		return append([]byte{byte(len(s))}, s...)
+	}
+	types := []byte{byte(len(imports) + 1)}
+	importSec := []byte{byte(len(imports))}
+	for i, imp := range imports {
+		types = append(types, 0x60, byte(len(imp.params)))
+		types = append(types, imp.params...)
+		types = append(types, byte(len(imp.results)))
+		types = append(types, imp.results...)
+		importSec = append(importSec, name(eeiNamespace)...)
+		importSec = append(importSec, name(imp.name)...)
+		importSec = append(importSec, 0x00, byte(i))
+	}
+	types = append(types, 0x60, 0, 0)
+	main := byte(len(imports))
+
+	exports := []byte{2}
+	exports = append(exports, name("main")...)
+	exports = append(exports, 0x00, main)
+	exports = append(exports, name("memory")...)
+	exports = append(exports, 0x02, 0)
+
+	fn := append([]byte{0}, body...)
+	fn = append(fn, 0x0b)
+	code := append([]byte{1, byte(len(fn))}, fn...)
+
+	out := append([]byte{}, wasm.Magic...)
+	out = append(out, 1, 0, 0, 0)
+	out = append(out, section(1, types)...)
+	out = append(out, section(2, importSec)...)
+	out = append(out, section(3, []byte{1, main})...)
+	out = append(out, section(5, []byte{1, 0, 1})...)
+	out = append(out, section(7, exports)...)
+	return append(out, section(10, code)...)
+}
+
+const (
+	wi32 = byte(wasm.ValueTypeI32)
+	wi64 = byte(wasm.ValueTypeI64)
+)
+
+var (
+	eeiCallDataCopy    = eeiImport{"callDataCopy", []byte{wi32, wi32, wi32}, nil}
+	eeiGetCallDataSize = eeiImport{"getCallDataSize", nil, []byte{wi32}}
+	eeiFinish          = eeiImport{"finish", []byte{wi32, wi32}, nil}
+	eeiRevert          = eeiImport{"revert", []byte{wi32, wi32}, nil}
+	eeiUseGas          = eeiImport{"useGas", []byte{wi64}, nil}
+)
+
+func mockEWASMInterpreter() *EWASMInterpreter {
+	config := *params.TestChainConfig
+	config.EWASMBlock = big.NewInt(0)
+	ctx := Context{BlockNumber: big.NewInt(1), Time: big.NewInt(1), Difficulty: big.NewInt(1), GasPrice: big.NewInt(1)}
+	evm := NewEVMWithConfig(ctx, nil, &config, Config{})
+	return evm.interpreters[0].(*EWASMInterpreter)
+}
+
+func runEWASM(in *EWASMInterpreter, code, input []byte, gas uint64) ([]byte, *Contract, error) {
+	contract := NewContract(AccountRef(callerAddress), AccountRef(contractAddress), new(big.Int), gas)
+	contract.Code = code
+	ret, err := in.Run(contract, input, false)
+	return ret, contract, err
+}
+
+func TestEWASMInterpreterSelection(t *testing.T) {
+	assert := assert.New(t)
+	in := mockEWASMInterpreter()
+	assert.True(in.CanRun(ewasmContract(nil)))
+	assert.False(in.CanRun(code))
+	assert.Equal(2, len(in.evm.interpreters))
+	assert.True(in.evm.interpreters[1].CanRun(code))
+
+	// An unknown interpreter is a configuration error.
+	config := *params.TestChainConfig
+	config.EWASMBlock = big.NewInt(0)
+	evm := NewEVMWithConfig(Context{BlockNumber: big.NewInt(1)}, nil, &config, Config{EWASMInterpreter: "libhera.so"})
+	assert.NotNil(evm.InterpreterError())
+}
+
+func TestEWASMFinish(t *testing.T) {
+	assert := assert.New(t)
+	// callDataCopy(0, 0, getCallDataSize()); finish(0, getCallDataSize())
+	echo := ewasmContract([]eeiImport{eeiCallDataCopy, eeiGetCallDataSize, eeiFinish},
+		0x41, 0, 0x41, 0, 0x10, 1, 0x10, 0,
+		0x41, 0, 0x10, 1, 0x10, 2,
+	)
+	input := []byte("hello ewasm")
+	ret, contract, err := runEWASM(mockEWASMInterpreter(), echo, input, 100000)
+	assert.Nil(err)
+	assert.Equal(input, ret)
+	assert.True(contract.Gas < 100000)
+
+	// A second run uses the cached module and costs the same gas.
+	_, again, err := runEWASM(mockEWASMInterpreter(), echo, input, 100000)
+	assert.Nil(err)
+	assert.Equal(contract.Gas, again.Gas)
+}
+
+func TestEWASMRevert(t *testing.T) {
+	assert := assert.New(t)
+	// Store 0x2a at memory 0 and revert with it.
+	revert := ewasmContract([]eeiImport{eeiRevert},
+		0x41, 0, 0x41, 0x2a, 0x3a, 0, 0,
+		0x41, 0, 0x41, 1, 0x10, 0,
+	)
+	ret, contract, err := runEWASM(mockEWASMInterpreter(), revert, nil, 100000)
+	assert.Equal(errExecutionReverted, err)
+	assert.Equal([]byte{0x2a}, ret)
+	assert.True(contract.Gas > 0)
+}
+
+func TestEWASMOutOfGas(t *testing.T) {
+	assert := assert.New(t)
+	// useGas(1000000)
+	burn := ewasmContract([]eeiImport{eeiUseGas}, 0x42, 0xc0, 0x84, 0x3d, 0x10, 0)
+	_, _, err := runEWASM(mockEWASMInterpreter(), burn, nil, 100000)
+	assert.Equal(ErrOutOfGas, err)
+
+	// An infinite loop is stopped by the instrumented gas charges.
+	loop := ewasmContract(nil, 0x03, 0x40, 0x0c, 0, 0x0b)
+	_, _, err = runEWASM(mockEWASMInterpreter(), loop, nil, 100000)
+	assert.Equal(ErrOutOfGas, err)
+}
+
+func TestEWASMInvalidContract(t *testing.T) {
+	assert := assert.New(t)
+	in := mockEWASMInterpreter()
+
+	unknown := ewasmContract([]eeiImport{{"getSecret", nil, nil}})
+	_, _, err := runEWASM(in, unknown, nil, 100000)
+	assert.NotNil(err)
+
+	float := ewasmContract(nil, 0x43, 0, 0, 0, 0, 0x1a)
+	_, _, err = runEWASM(in, float, nil, 100000)
+	assert.NotNil(err)
+
+	_, _, err = runEWASM(in, append(append([]byte{}, wasm.Magic...), 1, 0, 0, 0), nil, 100000)
+	assert.Equal(errEEIInvalidModule, err)
+
+	// The memory of a contract is limited to ewasmMaxMemoryPages pages.
+	large := ewasmContract(nil)
+	memory := bytes.Index(large, []byte{5, 3, 1, 0, 1})
+	large = append(append(append([]byte{}, large[:memory]...), 5, 4, 1, 0, 0x81, 0x08), large[memory+5:]...)
+	_, _, err = runEWASM(in, large, nil, 100000000)
+	assert.NotNil(err)
+}
+
+func TestEWASMStorage(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	config := *params.TestChainConfig
+	config.EWASMBlock = big.NewInt(0)
+	evm := NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{})
+
+	// storageStore(0, 32) with key 0 and value 0x..2a, then storageLoad(0, 64)
+	// and finish(64, 32).
+	store := ewasmContract([]eeiImport{
+		{"storageStore", []byte{wi32, wi32}, nil},
+		{"storageLoad", []byte{wi32, wi32}, nil},
+		eeiFinish,
+	},
+		0x41, 63, 0x41, 0x2a, 0x3a, 0, 0,
+		0x41, 0, 0x41, 32, 0x10, 0,
+		0x41, 0, 0x41, 0xc0, 0, 0x10, 1,
+		0x41, 0xc0, 0, 0x41, 32, 0x10, 2,
+	)
+	bc.SetCode(contractAddress, store)
+	ret, _, err := evm.Call(AccountRef(callerAddress), contractAddress, nil, 100000, big.NewInt(0))
+	assert.Nil(err)
+	assert.Equal(util.BigToHash(big.NewInt(0x2a)), util.BytesToHash(ret))
+	assert.Equal(util.BigToHash(big.NewInt(0x2a)), bc.GetHashTypeState(contractAddress, util.BytesToHash(nil)))
+
+	// Static calls must not write to the storage.
+	_, _, err = evm.StaticCall(AccountRef(callerAddress), contractAddress, nil, 100000)
+	assert.Equal(errWriteProtection, err)
+}
+
+func TestEWASMStorageRefund(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	config := *params.TestChainConfig
+	config.EWASMBlock = big.NewInt(0)
+	in := NewEVMWithConfig(mockEVM(bc).Context, bc, &config, Config{}).interpreters[0].(*EWASMInterpreter)
+
+	// storageStore(0, 32) clears the slot 0.
+	clear := ewasmContract([]eeiImport{{"storageStore", []byte{wi32, wi32}, nil}},
+		0x41, 0, 0x41, 32, 0x10, 0,
+	)
+	bc.SetHashTypeState(contractAddress, util.BytesToHash(nil), util.BigToHash(big.NewInt(0x2a)))
+	refund := bc.GetRefund()
+
+	// The refund is only granted once the clearing is paid for.
+	_, _, err := runEWASM(in, clear, nil, ewasmMemoryPageGas+params.SstoreClearGas-1)
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(refund, bc.GetRefund())
+
+	_, _, err = runEWASM(in, clear, nil, 100000)
+	assert.Nil(err)
+	assert.Equal(refund+params.SstoreRefundGas, bc.GetRefund())
+}
@@ -0,0 +1,114 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+)
+
+// FourByteTracer is a Tracer counting the function selectors of the message
+// calls per callee, including calls to system contracts. Each selector is
+// keyed together with the size of the call data following it, like
+// "0x27dc297e-128", so that overloaded or malformed calls stand out.
+//
+// Creations, calls to precompiled contracts and inputs shorter than a
+// selector are not counted.
+type FourByteTracer struct {
+	env    *EVM
+	counts map[types.Address]map[string]int
+}
+
+// NewFourByteTracer returns a new 4byte tracer.
+func NewFourByteTracer() *FourByteTracer {
+	return &FourByteTracer{counts: make(map[types.Address]map[string]int)}
+}
+
+// record counts the selector of a call input.
+func (t *FourByteTracer) record(typ CallType, to types.Address, input []byte) {
+	if typ == CallTypeCreate || typ == CallTypeCreate2 || len(input) < 4 || t.isPrecompile(to) {
+		return
+	}
+	counts := t.counts[to]
+	if counts == nil {
+		counts = make(map[string]int)
+		t.counts[to] = counts
+	}
+	counts[fmt.Sprintf("%s-%d", hexutil.Encode(input[:4]), len(input)-4)]++
+}
+
+// isPrecompile tells whether a precompiled contract is called at addr.
+func (t *FourByteTracer) isPrecompile(addr types.Address) bool {
+	if t.env == nil {
+		return false
+	}
+	_, ok := t.env.Precompile(addr)
+	return ok
+}
+
+// CaptureTxStart implements the Tracer interface.
+func (t *FourByteTracer) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	t.env = env
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (t *FourByteTracer) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureStart implements the Tracer interface to count the top level call.
+func (t *FourByteTracer) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CallTypeCall
+	if create {
+		typ = CallTypeCreate
+	}
+	t.record(typ, to, input)
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface to count a nested call.
+func (t *FourByteTracer) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	t.record(typ, to, input)
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (t *FourByteTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface, instructions aren't traced.
+func (t *FourByteTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *FourByteTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (t *FourByteTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// Counts returns the number of calls per callee and selector-size key.
+func (t *FourByteTracer) Counts() map[types.Address]map[string]int { return t.counts }
+
+// Reset discards the counted calls.
+func (t *FourByteTracer) Reset() {
+	t.counts = make(map[types.Address]map[string]int)
+}
+
+// GetResult returns the counts as JSON, keyed by the hex callee addresses.
+func (t *FourByteTracer) GetResult() (json.RawMessage, error) {
+	enc := make(map[string]map[string]int, len(t.counts))
+	for addr, counts := range t.counts {
+		enc[hexutil.Encode(addr[:])] = counts
+	}
+	return json.Marshal(enc)
+}
@@ -0,0 +1,69 @@
+package evm
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// callCode returns the code calling addr with size bytes of zeroed input.
+func callCode(addr [20]byte, size byte) []byte {
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), size, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, addr[:]...)
+	return append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(POP))
+}
+
+func TestFourByteTracer(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc        = mockPreBlockChain()
+		tracer    = NewFourByteTracer()
+		sysAddr   = util.HexToAddress("0x000000000000000000000000000000000000000d")
+		identity  = util.HexToAddress("0x0000000000000000000000000000000000000004")
+		sysCalled int
+		registry  = NewSystemContractRegistry()
+	)
+	registry.Register(SystemContract{
+		Name:    "counter",
+		Address: sysAddr,
+		Exec: func(*EVM, ContractRef, []byte) ([]byte, error) {
+			sysCalled++
+			return nil, nil
+		},
+		RequiredGas: func([]byte) uint64 { return 100 },
+	})
+	env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer, SystemContracts: registry})
+
+	// Call the system contract, the callee twice, a precompile and the
+	// callee with a too short input.
+	var code []byte
+	code = append(code, callCode(sysAddr, 36)...)
+	code = append(code, callCode(debugCallee, 4)...)
+	code = append(code, callCode(debugCallee, 4)...)
+	code = append(code, callCode(identity, 4)...)
+	code = append(code, callCode(debugCallee, 3)...)
+	bc.SetCode(contractAddress, append(code, byte(STOP)))
+	bc.CreateAccount(debugCallee)
+
+	_, _, err := env.Call(AccountRef(callerAddress), contractAddress, []byte{0xaa, 0xbb, 0xcc, 0xdd, 1}, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(1, sysCalled)
+	counts := tracer.Counts()
+	assert.Len(counts, 3)
+	assert.Equal(map[string]int{"0xaabbccdd-1": 1}, counts[contractAddress])
+	assert.Equal(map[string]int{"0x00000000-32": 1}, counts[sysAddr])
+	assert.Equal(map[string]int{"0x00000000-0": 2}, counts[debugCallee])
+
+	res, err := tracer.GetResult()
+	assert.Nil(err)
+	var decoded map[string]map[string]int
+	assert.Nil(json.Unmarshal(res, &decoded))
+	assert.Equal(2, decoded["0x000000000000000000000000000000000000000b"]["0x00000000-0"])
+
+	tracer.Reset()
+	assert.Empty(tracer.Counts())
+}
@@ -0,0 +1,370 @@
+package evm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+)
+
+// defaultProfileTop is the number of items listed per category in the
+// summary of the GasProfiler.
+const defaultProfileTop = 10
+
+// ProfileKey identifies an instruction of a contract, as executed for a
+// function selector. The selector is empty for creations and calls with
+// less than four bytes of input.
+type ProfileKey struct {
+	Address  types.Address
+	Selector string
+	Pc       uint64
+	Op       OpCode
+}
+
+// ProfileEntry is the gas and time spent on an instruction.
+type ProfileEntry struct {
+	ProfileKey
+	Gas   uint64
+	Time  time.Duration
+	Count uint64
+}
+
+// ProfileItem is the gas and time spent on a contract, selector or opcode
+// in the summary of the GasProfiler.
+type ProfileItem struct {
+	Name  string        `json:"name"`
+	Gas   uint64        `json:"gas"`
+	Time  time.Duration `json:"time"`
+	Count uint64        `json:"count"`
+}
+
+// ProfileSummary lists the contracts, selectors and opcodes most gas has
+// been spent on.
+type ProfileSummary struct {
+	Gas       uint64         `json:"gas"`
+	Time      time.Duration  `json:"time"`
+	Contracts []*ProfileItem `json:"contracts"`
+	Selectors []*ProfileItem `json:"selectors"`
+	Opcodes   []*ProfileItem `json:"opcodes"`
+}
+
+// GasProfilerConfig are the configuration options for the GasProfiler.
+type GasProfilerConfig struct {
+	Top int // number of items per category in the summary, 10 if zero
+}
+
+// profileStep is an instruction whose cost is known once the next one is
+// reached.
+type profileStep struct {
+	key       ProfileKey
+	gas       uint64
+	start     time.Time
+	childGas  uint64 // gas attributed to the callees of the instruction
+	childTime time.Duration
+}
+
+// profileFrame is a call being profiled.
+type profileFrame struct {
+	address  types.Address
+	selector string
+	path     string        // folded stack of the call
+	gas      uint64        // gas available to the call
+	usedGas  uint64        // gas attributed to the call and its callees
+	usedTime time.Duration // time attributed to the call and its callees
+	step     *profileStep
+}
+
+// foldedEntry is the cost of an instruction at a folded stack.
+type foldedEntry struct {
+	gas  uint64
+	time time.Duration
+}
+
+// GasProfiler is a Tracer attributing the gas and the time spent to the
+// executed instructions, aggregated over all traced transactions.
+//
+// The cost of an instruction is what the calling frame spent on it, except
+// the cost of the instructions of its callees. The cost of calls to
+// precompiled contracts and accounts without code remains with the calling
+// instruction.
+type GasProfiler struct {
+	cfg GasProfilerConfig
+
+	frames  []*profileFrame
+	entries map[ProfileKey]*ProfileEntry
+	folded  map[string]*foldedEntry
+}
+
+// NewGasProfiler returns a new gas profiler.
+func NewGasProfiler(cfg *GasProfilerConfig) *GasProfiler {
+	profiler := &GasProfiler{
+		entries: make(map[ProfileKey]*ProfileEntry),
+		folded:  make(map[string]*foldedEntry),
+	}
+	if cfg != nil {
+		profiler.cfg = *cfg
+	}
+	if profiler.cfg.Top <= 0 {
+		profiler.cfg.Top = defaultProfileTop
+	}
+	return profiler
+}
+
+// Reset discards the profile.
+func (p *GasProfiler) Reset() {
+	p.frames = nil
+	p.entries = make(map[ProfileKey]*ProfileEntry)
+	p.folded = make(map[string]*foldedEntry)
+}
+
+// CaptureTxStart implements the Tracer interface.
+func (p *GasProfiler) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	p.frames = p.frames[:0]
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (p *GasProfiler) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureStart implements the Tracer interface to profile the top level call.
+func (p *GasProfiler) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	p.frames = p.frames[:0]
+	p.enter(to, create, input, gas)
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface to profile a nested call.
+func (p *GasProfiler) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	if len(p.frames) > 0 {
+		p.enter(to, typ == CallTypeCreate || typ == CallTypeCreate2, input, gas)
+	}
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (p *GasProfiler) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if len(p.frames) > 1 {
+		p.exit(gasUsed)
+	}
+	return nil
+}
+
+// CaptureState implements the Tracer interface to charge the previous
+// instruction of the call and start timing the next one.
+func (p *GasProfiler) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if len(p.frames) == 0 {
+		return nil
+	}
+	frame := p.frames[len(p.frames)-1]
+	now := time.Now()
+	if frame.step != nil {
+		p.charge(frame, gas, now)
+	}
+	frame.step = &profileStep{
+		key:   ProfileKey{Address: frame.address, Selector: frame.selector, Pc: pc, Op: op},
+		gas:   gas,
+		start: now,
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (p *GasProfiler) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (p *GasProfiler) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if len(p.frames) == 1 {
+		p.exit(gasUsed)
+	}
+	return nil
+}
+
+// enter starts profiling a call.
+func (p *GasProfiler) enter(address types.Address, create bool, input []byte, gas uint64) {
+	frame := &profileFrame{address: address, gas: gas}
+	label := hexutil.Encode(address[:])
+	if !create && len(input) >= 4 {
+		frame.selector = hexutil.Encode(input[:4])
+		label += ":" + frame.selector
+	}
+	frame.path = label
+	if len(p.frames) > 0 {
+		frame.path = p.frames[len(p.frames)-1].path + ";" + label
+	}
+	p.frames = append(p.frames, frame)
+}
+
+// exit charges the last instruction of the call and attributes the cost of
+// the call to the calling instruction.
+func (p *GasProfiler) exit(gasUsed uint64) {
+	frame := p.frames[len(p.frames)-1]
+	p.frames = p.frames[:len(p.frames)-1]
+	if frame.step != nil {
+		var left uint64
+		if gasUsed < frame.gas {
+			left = frame.gas - gasUsed
+		}
+		p.charge(frame, left, time.Now())
+	}
+	if len(p.frames) > 0 {
+		if step := p.frames[len(p.frames)-1].step; step != nil {
+			step.childGas += frame.usedGas
+			step.childTime += frame.usedTime
+		}
+	}
+}
+
+// charge records the cost of the pending instruction of a call, given the
+// gas left after it.
+func (p *GasProfiler) charge(frame *profileFrame, left uint64, now time.Time) {
+	step := frame.step
+	frame.step = nil
+
+	var gas uint64
+	if step.gas > left+step.childGas {
+		gas = step.gas - left - step.childGas
+	}
+	elapsed := now.Sub(step.start) - step.childTime
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	frame.usedGas += gas + step.childGas
+	frame.usedTime += elapsed + step.childTime
+
+	entry := p.entries[step.key]
+	if entry == nil {
+		entry = &ProfileEntry{ProfileKey: step.key}
+		p.entries[step.key] = entry
+	}
+	entry.Gas += gas
+	entry.Time += elapsed
+	entry.Count++
+
+	path := fmt.Sprintf("%s;%v@%d", frame.path, step.key.Op, step.key.Pc)
+	folded := p.folded[path]
+	if folded == nil {
+		folded = new(foldedEntry)
+		p.folded[path] = folded
+	}
+	folded.gas += gas
+	folded.time += elapsed
+}
+
+// Entries returns the cost of every executed instruction, most gas first.
+func (p *GasProfiler) Entries() []*ProfileEntry {
+	entries := make([]*ProfileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Gas != b.Gas {
+			return a.Gas > b.Gas
+		}
+		if a.Address != b.Address {
+			return bytes.Compare(a.Address[:], b.Address[:]) < 0
+		}
+		if a.Selector != b.Selector {
+			return a.Selector < b.Selector
+		}
+		return a.Pc < b.Pc
+	})
+	return entries
+}
+
+// WriteFolded writes the profile in the folded stack format of flamegraph
+// tools: one line per instruction and call stack, with the frames separated
+// by semicolons and followed by the gas spent. The time spent in
+// nanoseconds is written instead if byTime is set.
+func (p *GasProfiler) WriteFolded(writer io.Writer, byTime bool) error {
+	paths := make([]string, 0, len(p.folded))
+	for path := range p.folded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	w := bufio.NewWriter(writer)
+	for _, path := range paths {
+		value := p.folded[path].gas
+		if byTime {
+			value = uint64(p.folded[path].time)
+		}
+		if value == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", path, value); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Summary returns the contracts, selectors and opcodes most gas has been
+// spent on.
+func (p *GasProfiler) Summary() *ProfileSummary {
+	var (
+		summary   = new(ProfileSummary)
+		contracts = make(map[string]*ProfileItem)
+		selectors = make(map[string]*ProfileItem)
+		opcodes   = make(map[string]*ProfileItem)
+	)
+	add := func(items map[string]*ProfileItem, name string, entry *ProfileEntry) {
+		item := items[name]
+		if item == nil {
+			item = &ProfileItem{Name: name}
+			items[name] = item
+		}
+		item.Gas += entry.Gas
+		item.Time += entry.Time
+		item.Count += entry.Count
+	}
+	for _, entry := range p.entries {
+		summary.Gas += entry.Gas
+		summary.Time += entry.Time
+
+		contract := hexutil.Encode(entry.Address[:])
+		add(contracts, contract, entry)
+		if entry.Selector != "" {
+			add(selectors, contract+":"+entry.Selector, entry)
+		}
+		add(opcodes, entry.Op.String(), entry)
+	}
+	summary.Contracts = topProfileItems(contracts, p.cfg.Top)
+	summary.Selectors = topProfileItems(selectors, p.cfg.Top)
+	summary.Opcodes = topProfileItems(opcodes, p.cfg.Top)
+	return summary
+}
+
+// GetResult returns the summary of the profile as JSON.
+func (p *GasProfiler) GetResult() (json.RawMessage, error) {
+	return json.Marshal(p.Summary())
+}
+
+// topProfileItems returns the n items most gas has been spent on.
+func topProfileItems(items map[string]*ProfileItem, n int) []*ProfileItem {
+	list := make([]*ProfileItem, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Gas != list[j].Gas {
+			return list[i].Gas > list[j].Gas
+		}
+		return list[i].Name < list[j].Name
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
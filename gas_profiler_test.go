@@ -0,0 +1,73 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGasProfiler(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc       = mockPreBlockChain()
+		profiler = NewGasProfiler(&GasProfilerConfig{Top: 2})
+		env      = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: profiler})
+		callee   = util.HexToAddress("0x000000000000000000000000000000000000000b")
+	)
+	// Call the callee with the selector 0x12345678, then stop.
+	code := []byte{byte(PUSH4), 0x12, 0x34, 0x56, 0x78, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 4, byte(PUSH1), 28, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, callee[:]...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(STOP))
+	bc.SetCode(contractAddress, code)
+	bc.CreateAccount(callee)
+	bc.SetCode(callee, []byte{byte(PUSH1), 2, byte(PUSH1), 3, byte(ADD), byte(STOP)})
+
+	_, left, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+
+	// The gas of all instructions adds up to the gas used by the call.
+	var total uint64
+	for _, entry := range profiler.Entries() {
+		total += entry.Gas
+		assert.Equal(uint64(1), entry.Count)
+	}
+	assert.Equal(1000000-left, total)
+
+	entries := profiler.Entries()
+	assert.Equal(contractAddress, entries[0].Address)
+	assert.Equal(CALL, entries[0].Op)
+	assert.Equal(params.GasTableEIP158.Calls, entries[0].Gas)
+
+	var folded bytes.Buffer
+	assert.Nil(profiler.WriteFolded(&folded, false))
+	assert.Contains(folded.String(), "0xf74cc8824a00bcb96e8546bf3b4dc47ace9cab2c;0x000000000000000000000000000000000000000b:0x12345678;ADD@4 3\n")
+	assert.Equal(14, strings.Count(folded.String(), "\n")) // instructions costing gas
+
+	summary := profiler.Summary()
+	assert.Equal(total, summary.Gas)
+	assert.Equal(2, len(summary.Contracts))
+	assert.Equal("0x000000000000000000000000000000000000000b:0x12345678", summary.Selectors[0].Name)
+	assert.Equal(uint64(9), summary.Selectors[0].Gas)
+	assert.Equal(2, len(summary.Opcodes))
+	assert.Equal("CALL", summary.Opcodes[0].Name)
+
+	res, err := profiler.GetResult()
+	assert.Nil(err)
+	var decoded map[string]interface{}
+	assert.Nil(json.Unmarshal(res, &decoded))
+	assert.Equal(float64(total), decoded["gas"])
+
+	// The profile is aggregated over transactions until reset.
+	_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(2*total, profiler.Summary().Gas)
+	profiler.Reset()
+	assert.Equal(0, len(profiler.Entries()))
+}
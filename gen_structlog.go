@@ -20,13 +20,17 @@ func (s StructLog) MarshalJSON() ([]byte, error) {
 		Gas           math.HexOrDecimal64       `json:"gas"`
 		GasCost       math.HexOrDecimal64       `json:"gasCost"`
 		Memory        hexutil.Bytes             `json:"memory"`
+		MemoryOffset  int                       `json:"memOffset,omitempty"`
 		MemorySize    int                       `json:"memSize"`
 		Stack         []*math.HexOrDecimal256   `json:"stack"`
+		ReturnData    hexutil.Bytes             `json:"returnData,omitempty"`
 		Storage       map[types.Hash]types.Hash `json:"-"`
 		Depth         int                       `json:"depth"`
+		Address       types.Address             `json:"-"`
 		RefundCounter uint64                    `json:"refund"`
 		Err           error                     `json:"-"`
 		OpName        string                    `json:"opName"`
+		AddressString string                    `json:"address"`
 		ErrorString   string                    `json:"error"`
 	}
 	var enc StructLog
@@ -35,6 +39,7 @@ func (s StructLog) MarshalJSON() ([]byte, error) {
 	enc.Gas = math.HexOrDecimal64(s.Gas)
 	enc.GasCost = math.HexOrDecimal64(s.GasCost)
 	enc.Memory = s.Memory
+	enc.MemoryOffset = s.MemoryOffset
 	enc.MemorySize = s.MemorySize
 	if s.Stack != nil {
 		enc.Stack = make([]*math.HexOrDecimal256, len(s.Stack))
@@ -42,11 +47,14 @@ func (s StructLog) MarshalJSON() ([]byte, error) {
 			enc.Stack[k] = (*math.HexOrDecimal256)(v)
 		}
 	}
+	enc.ReturnData = s.ReturnData
 	enc.Storage = s.Storage
 	enc.Depth = s.Depth
+	enc.Address = s.Address
 	enc.RefundCounter = s.RefundCounter
 	enc.Err = s.Err
 	enc.OpName = s.OpName()
+	enc.AddressString = s.AddressString()
 	enc.ErrorString = s.ErrorString()
 	return json.Marshal(&enc)
 }
@@ -59,10 +67,13 @@ func (s *StructLog) UnmarshalJSON(input []byte) error {
 		Gas           *math.HexOrDecimal64      `json:"gas"`
 		GasCost       *math.HexOrDecimal64      `json:"gasCost"`
 		Memory        *hexutil.Bytes            `json:"memory"`
+		MemoryOffset  *int                      `json:"memOffset,omitempty"`
 		MemorySize    *int                      `json:"memSize"`
 		Stack         []*math.HexOrDecimal256   `json:"stack"`
+		ReturnData    *hexutil.Bytes            `json:"returnData,omitempty"`
 		Storage       map[types.Hash]types.Hash `json:"-"`
 		Depth         *int                      `json:"depth"`
+		Address       *types.Address            `json:"-"`
 		RefundCounter *uint64                   `json:"refund"`
 		Err           error                     `json:"-"`
 	}
@@ -85,6 +96,9 @@ func (s *StructLog) UnmarshalJSON(input []byte) error {
 	if dec.Memory != nil {
 		s.Memory = *dec.Memory
 	}
+	if dec.MemoryOffset != nil {
+		s.MemoryOffset = *dec.MemoryOffset
+	}
 	if dec.MemorySize != nil {
 		s.MemorySize = *dec.MemorySize
 	}
@@ -94,12 +108,18 @@ func (s *StructLog) UnmarshalJSON(input []byte) error {
 			s.Stack[k] = (*big.Int)(v)
 		}
 	}
+	if dec.ReturnData != nil {
+		s.ReturnData = *dec.ReturnData
+	}
 	if dec.Storage != nil {
 		s.Storage = dec.Storage
 	}
 	if dec.Depth != nil {
 		s.Depth = *dec.Depth
 	}
+	if dec.Address != nil {
+		s.Address = *dec.Address
+	}
 	if dec.RefundCounter != nil {
 		s.RefundCounter = *dec.RefundCounter
 	}
@@ -17,7 +17,9 @@
 package evm
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/DSiSc/craft/types"
@@ -36,6 +38,9 @@ var (
 	errExecutionReverted     = errors.New("evm: execution reverted")
 	errMaxCodeSizeExceeded   = errors.New("evm: max code size exceeded")
 	errInvalidJump           = errors.New("evm: invalid jump destination")
+	errInvalidCode           = errors.New("evm: invalid code: must not begin with 0xef")
+	errReturnStackExceeded   = errors.New("evm: return stack limit reached")
+	errExecutionAborted      = errors.New("evm: execution aborted")
 )
 
 func opAdd(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
@@ -479,7 +484,7 @@ func opReturnDataCopy(pc *uint64, interpreter *EVMInterpreter, contract *Contrac
 func opExtCodeSize(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	slot := stack.peek()
 	addr := util.BigToAddress(slot)
-	if IsSystemContract(addr) {
+	if interpreter.evm.systemContracts[addr] != nil || interpreter.evm.customPrecompiles[addr] {
 		slot.SetUint64(uint64(1))
 	} else {
 		slot.SetUint64(uint64(interpreter.evm.StateDB.GetCodeSize(util.BigToAddress(slot))))
@@ -771,8 +776,8 @@ func opCall(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory
 	var ret []byte
 	var returnGas uint64
 	var err error
-	if IsSystemContract(toAddr) {
-		ret, returnGas, err = sysContractCall(interpreter.evm, contract.self, toAddr, args, gas, value)
+	if interpreter.evm.systemContracts[toAddr] != nil {
+		ret, returnGas, err = sysContractCall(interpreter.evm, contract.self, toAddr, args, gas, value, interpreter.readOnly)
 	} else {
 		ret, returnGas, err = interpreter.evm.Call(contract, toAddr, args, gas, value)
 	}
@@ -898,10 +903,111 @@ func opSuicide(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memo
 	return nil, nil
 }
 
+func opRjump(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	*pc = uint64(int64(*pc) + 3 + int64(eofInt16(contract.Code, int(*pc+1))))
+	return nil, nil
+}
+
+func opRjumpi(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	cond := stack.pop()
+	if cond.Sign() != 0 {
+		*pc = uint64(int64(*pc) + 3 + int64(eofInt16(contract.Code, int(*pc+1))))
+	} else {
+		*pc += 3
+	}
+
+	interpreter.intPool.put(cond)
+	return nil, nil
+}
+
+func opRjumpv(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	var (
+		index = stack.pop()
+		count = uint64(contract.Code[*pc+1]) + 1
+		next  = *pc + 2 + 2*count
+	)
+	if index.BitLen() <= 64 && index.Uint64() < count {
+		*pc = uint64(int64(next) + int64(eofInt16(contract.Code, int(*pc+2+2*index.Uint64()))))
+	} else {
+		*pc = next
+	}
+
+	interpreter.intPool.put(index)
+	return nil, nil
+}
+
+func opCallf(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	var (
+		idx    = int(binary.BigEndian.Uint16(contract.Code[*pc+1:]))
+		target = contract.eof.types[idx]
+	)
+	if len(contract.eofReturns) >= eofReturnStackLimit {
+		return nil, errReturnStackExceeded
+	}
+	if height := stack.len() + int(target.maxStackHeight) - int(target.inputs); height > int(params.StackLimit) {
+		return nil, fmt.Errorf("stack limit reached %d (%d)", height, params.StackLimit)
+	}
+	contract.eofReturns = append(contract.eofReturns, eofReturn{section: contract.eofSection, pc: *pc + 3})
+	contract.eofSection = idx
+	*pc = uint64(contract.eof.codeOffsets[idx])
+	return nil, nil
+}
+
+func opRetf(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	ret := contract.eofReturns[len(contract.eofReturns)-1]
+	contract.eofReturns = contract.eofReturns[:len(contract.eofReturns)-1]
+	contract.eofSection = ret.section
+	*pc = ret.pc
+	return nil, nil
+}
+
+func opJumpf(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	var (
+		idx    = int(binary.BigEndian.Uint16(contract.Code[*pc+1:]))
+		target = contract.eof.types[idx]
+	)
+	if height := stack.len() + int(target.maxStackHeight) - int(target.inputs); height > int(params.StackLimit) {
+		return nil, fmt.Errorf("stack limit reached %d (%d)", height, params.StackLimit)
+	}
+	contract.eofSection = idx
+	*pc = uint64(contract.eof.codeOffsets[idx])
+	return nil, nil
+}
+
+func opDataLoad(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	stack.push(interpreter.intPool.get().SetBytes(getDataBig(contract.eof.data, stack.pop(), big32)))
+	return nil, nil
+}
+
+func opDataLoadN(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	offset := int(binary.BigEndian.Uint16(contract.Code[*pc+1:]))
+	stack.push(interpreter.intPool.get().SetBytes(contract.eof.data[offset : offset+32]))
+
+	*pc += 2
+	return nil, nil
+}
+
+func opDataSize(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	stack.push(interpreter.intPool.get().SetInt64(int64(len(contract.eof.data))))
+	return nil, nil
+}
+
+func opDataCopy(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	var (
+		memOffset  = stack.pop()
+		dataOffset = stack.pop()
+		length     = stack.pop()
+	)
+	memory.Set(memOffset.Uint64(), length.Uint64(), getDataBig(contract.eof.data, dataOffset, length))
+
+	interpreter.intPool.put(memOffset, dataOffset, length)
+	return nil, nil
+}
+
 // following functions are used by the instruction jump  table
 
 // make log instruction function
-func makeLog(size int) executionFunc {
+func makeLog(size int) ExecutionFunc {
 	return func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 		topics := make([]types.Hash, size)
 		mStart, mSize := stack.pop(), stack.pop()
@@ -940,7 +1046,7 @@ func opPush1(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory
 }
 
 // make push instruction function
-func makePush(size uint64, pushByteSize int) executionFunc {
+func makePush(size uint64, pushByteSize int) ExecutionFunc {
 	return func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 		codeLen := len(contract.Code)
 
@@ -963,7 +1069,7 @@ func makePush(size uint64, pushByteSize int) executionFunc {
 }
 
 // make dup instruction function
-func makeDup(size int64) executionFunc {
+func makeDup(size int64) ExecutionFunc {
 	return func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 		stack.dup(interpreter.intPool, int(size))
 		return nil, nil
@@ -971,7 +1077,7 @@ func makeDup(size int64) executionFunc {
 }
 
 // make swap instruction function
-func makeSwap(size int64) executionFunc {
+func makeSwap(size int64) ExecutionFunc {
 	// switch n + 1 otherwise n would be swapped with n
 	size++
 	return func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
@@ -981,8 +1087,59 @@ func makeSwap(size int64) executionFunc {
 }
 
 // execute system contract
-func sysContractCall(evm *EVM, caller ContractRef, addr types.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
-	sysContractExecutionFunc := GetSystemContractExecFunc(addr)
-	ret, err = sysContractExecutionFunc(evm, caller, input)
+func sysContractCall(evm *EVM, caller ContractRef, addr types.Address, input []byte, gas uint64, value *big.Int, readOnly bool) (ret []byte, leftOverGas uint64, err error) {
+	if evm.vmConfig.NoRecursion && evm.depth > 0 {
+		return nil, gas, nil
+	}
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CallTypeSystem, caller.Address(), addr, input, gas, value)
+		defer func() { captureEnd(ret, leftOverGas, err) }()
+	}
+	// Fail if we're trying to execute above the call depth limit
+	if evm.depth > int(params.CallCreateDepth) {
+		return nil, gas, ErrDepth
+	}
+	// System contracts may modify the state, they can't be called statically
+	if readOnly {
+		return nil, 0, errWriteProtection
+	}
+	contract := evm.systemContracts[addr]
+	if value.Sign() != 0 {
+		if !contract.Payable {
+			return nil, gas, ErrSystemContractValueTransfer
+		}
+		if !evm.CanTransfer(evm.StateDB, caller.Address(), value) {
+			return nil, gas, ErrInsufficientBalance
+		}
+	}
+	requiredGas := contract.requiredGas(input)
+	if gas < requiredGas {
+		return nil, 0, ErrOutOfGas
+	}
+	gas -= requiredGas
+
+	// Failures revert the state changes and consume the gas left, like the
+	// ones of precompiled contracts
+	snapshot := evm.StateDB.Snapshot()
+	if value.Sign() != 0 {
+		if !evm.StateDB.Exist(addr) {
+			evm.StateDB.CreateAccount(addr)
+		}
+		evm.Transfer(evm.StateDB, caller.Address(), addr, value)
+	}
+	ret, err = contract.Exec(evm, caller, input)
+	if err == nil || err == errExecutionReverted {
+		if outputGas := outputGas(ret); gas < outputGas {
+			ret, err = nil, ErrOutOfGas
+		} else {
+			gas -= outputGas
+		}
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != errExecutionReverted {
+			gas = 0
+		}
+	}
 	return ret, gas, err
 }
@@ -37,15 +37,23 @@ type Config struct {
 	NoRecursion bool
 	// Enable recording of SHA3/keccak preimages
 	EnablePreimageRecording bool
-	// JumpTable contains the EVM instruction table. This
-	// may be left uninitialised and will be set to the default
-	// table.
-	JumpTable [256]operation
+	// JumpTable contains the EVM instruction table, the default
+	// table if nil, see NewJumpTable for customising it.
+	JumpTable *JumpTable
 
-	// Type of the EWASM interpreter
+	// Type of the EWASM interpreter, defaults to the built-in one
+	// after the eWASM fork
 	EWASMInterpreter string
-	// Type of the EVM interpreter
+	// Type of the EVM interpreter, the built-in one is always used
+	// as a fallback
 	EVMInterpreter string
+
+	// SystemContracts is the registry of the system contracts,
+	// DefaultSystemContracts if nil
+	SystemContracts *SystemContractRegistry
+	// Precompiles holds the changes to the default precompiled
+	// contracts, none if nil
+	Precompiles *PrecompileRegistry
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -95,7 +103,6 @@ type EVMInterpreter struct {
 
 // NewEVMInterpreter returns a new instance of the Interpreter.
 func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
-	cfg.JumpTable = byzantiumInstructionSet
 	return &EVMInterpreter{
 		evm:      evm,
 		cfg:      cfg,
@@ -103,6 +110,11 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 	}
 }
 
+// EVM returns the EVM the interpreter belongs to.
+func (in *EVMInterpreter) EVM() *EVM {
+	return in.evm
+}
+
 // Run loops and evaluates the contract's code with the given input data and returns
 // the return byte-slice and an error if one occurred.
 //
@@ -155,6 +167,19 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	)
 	contract.Input = input
 
+	// EOF code is validated before execution and starts at its first code
+	// section.
+	jumpTable := in.evm.jumpTable
+	if in.evm.chainRules.IsEOF && hasEOFMagic(contract.Code) {
+		container, err := contract.eofContainer(in.evm.eofJumpTable)
+		if err != nil {
+			return nil, err
+		}
+		contract.eof, contract.eofSection, contract.eofReturns = container, 0, nil
+		jumpTable = in.evm.eofJumpTable
+		pc = uint64(container.codeOffsets[0])
+	}
+
 	// Reclaim the stack as an int pool when the execution stops
 	defer func() { in.intPool.put(stack.data...) }()
 
@@ -182,7 +207,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// Get the operation from the jump table and validate the stack to ensure there are
 		// enough stack items available to perform the operation.
 		op = contract.GetOp(pc)
-		operation := in.cfg.JumpTable[op]
+		operation := jumpTable[op]
 		if !operation.valid {
 			return nil, fmt.Errorf("invalid opcode 0x%x", int(op))
 		}
@@ -204,6 +229,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			}
 		}
 		// Static portion of gas
+		cost = operation.constantGas
 		if !contract.UseGas(operation.constantGas) {
 			return nil, ErrOutOfGas
 		}
@@ -228,8 +254,10 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// consume the gas and return an error if not enough gas is available.
 		// cost is explicitly set so that the capture state defer method can get the proper cost
 		if operation.dynamicGas != nil {
-			cost, err = operation.dynamicGas(in.gasTable, in.evm, contract, stack, mem, memorySize)
-			if err != nil || !contract.UseGas(cost) {
+			var dynamicCost uint64
+			dynamicCost, err = operation.dynamicGas(in.gasTable, in.evm, contract, stack, mem, memorySize)
+			cost += dynamicCost // total cost, for tracing
+			if err != nil || !contract.UseGas(dynamicCost) {
 				return nil, ErrOutOfGas
 			}
 		}
@@ -240,6 +268,11 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		if in.cfg.Debug {
 			in.cfg.Tracer.CaptureState(in.evm, pc, op, gasCopy, cost, mem, stack, contract, in.evm.depth, err)
 			logged = true
+			// A tracer, e.g. a debugger, may abort the execution before
+			// the instruction, which fails with the state reverted.
+			if atomic.LoadInt32(&in.evm.abort) != 0 {
+				return nil, errExecutionAborted
+			}
 		}
 
 		// execute the operation
@@ -266,6 +299,9 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			pc++
 		}
 	}
+	if in.cfg.Debug {
+		return nil, errExecutionAborted
+	}
 	return nil, nil
 }
 
@@ -0,0 +1,163 @@
+package evm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Names of the built-in interpreters.
+const (
+	EVMInterpreterName   = "evm"
+	EWASMInterpreterName = "ewasm"
+)
+
+// InterpreterFactory creates an interpreter for an EVM instance. The options
+// are taken from the configuration string the interpreter was selected by.
+type InterpreterFactory func(evm *EVM, cfg Config, options []string) (Interpreter, error)
+
+var interpreterRegistry = struct {
+	sync.RWMutex
+	factories map[string]InterpreterFactory
+}{factories: make(map[string]InterpreterFactory)}
+
+func init() {
+	RegisterInterpreter(EVMInterpreterName, func(evm *EVM, cfg Config, options []string) (Interpreter, error) {
+		if len(options) != 0 {
+			return nil, fmt.Errorf("interpreter %q takes no options", EVMInterpreterName)
+		}
+		return NewEVMInterpreter(evm, cfg), nil
+	})
+	RegisterInterpreter(EWASMInterpreterName, func(evm *EVM, cfg Config, options []string) (Interpreter, error) {
+		if len(options) != 0 {
+			return nil, fmt.Errorf("interpreter %q takes no options", EWASMInterpreterName)
+		}
+		return NewEWASMInterpreter(evm, cfg), nil
+	})
+}
+
+// RegisterInterpreter makes an interpreter available under the given name,
+// so that it can be selected by Config.EVMInterpreter and
+// Config.EWASMInterpreter. It panics if the name is taken or invalid.
+func RegisterInterpreter(name string, factory InterpreterFactory) {
+	if name == "" || strings.ContainsAny(name, ",: ") {
+		panic(fmt.Sprintf("invalid interpreter name %q", name))
+	}
+	if factory == nil {
+		panic(fmt.Sprintf("nil factory for interpreter %q", name))
+	}
+	interpreterRegistry.Lock()
+	defer interpreterRegistry.Unlock()
+
+	if _, ok := interpreterRegistry.factories[name]; ok {
+		panic(fmt.Sprintf("interpreter %q already registered", name))
+	}
+	interpreterRegistry.factories[name] = factory
+}
+
+// RegisteredInterpreters returns the sorted names of all registered
+// interpreters.
+func RegisteredInterpreters() []string {
+	interpreterRegistry.RLock()
+	defer interpreterRegistry.RUnlock()
+
+	names := make([]string, 0, len(interpreterRegistry.factories))
+	for name := range interpreterRegistry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InterpreterSpec is a single entry of an interpreter configuration string.
+type InterpreterSpec struct {
+	Name    string
+	Options []string
+}
+
+// ParseInterpreterConfig parses an interpreter configuration string. It is a
+// comma separated list of interpreters in the order they are tried, each
+// entry being a registered name optionally followed by colon separated
+// options, e.g. "sandbox:memlimit=32M,evm".
+func ParseInterpreterConfig(config string) ([]InterpreterSpec, error) {
+	var specs []InterpreterSpec
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if parts[0] == "" {
+			return nil, fmt.Errorf("empty interpreter name in %q", config)
+		}
+		interpreterRegistry.RLock()
+		_, ok := interpreterRegistry.factories[parts[0]]
+		interpreterRegistry.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown interpreter %q", parts[0])
+		}
+		specs = append(specs, InterpreterSpec{Name: parts[0], Options: parts[1:]})
+	}
+	return specs, nil
+}
+
+// instantiateInterpreters creates the interpreters of specs.
+func instantiateInterpreters(evm *EVM, cfg Config, specs []InterpreterSpec) ([]Interpreter, error) {
+	var interpreters []Interpreter
+	for _, spec := range specs {
+		interpreterRegistry.RLock()
+		factory := interpreterRegistry.factories[spec.Name]
+		interpreterRegistry.RUnlock()
+
+		interpreter, err := factory(evm, cfg, spec.Options)
+		if err != nil {
+			return nil, fmt.Errorf("interpreter %q: %v", spec.Name, err)
+		}
+		interpreters = append(interpreters, interpreter)
+	}
+	return interpreters, nil
+}
+
+// newInterpreters instantiates the interpreters selected by the
+// configuration in order of precedence. Before the eWASM fork
+// Config.EWASMInterpreter is ignored and the built-in eWASM interpreter
+// can't be selected, afterwards Config.EWASMInterpreter defaults to it. The
+// built-in EVM interpreter is always appended as the final fallback unless
+// it has been selected explicitly.
+func newInterpreters(evm *EVM, cfg Config) ([]Interpreter, error) {
+	var interpreters []Interpreter
+	ewasmFork := evm.chainConfig.IsEWASM(evm.BlockNumber)
+	if ewasmFork {
+		specs, err := ParseInterpreterConfig(cfg.EWASMInterpreter)
+		if err != nil {
+			return nil, err
+		}
+		if len(specs) == 0 {
+			specs = []InterpreterSpec{{Name: EWASMInterpreterName}}
+		}
+		if interpreters, err = instantiateInterpreters(evm, cfg, specs); err != nil {
+			return nil, err
+		}
+	}
+	specs, err := ParseInterpreterConfig(cfg.EVMInterpreter)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range specs {
+		if spec.Name == EWASMInterpreterName && !ewasmFork {
+			return nil, fmt.Errorf("interpreter %q selected before the eWASM fork", EWASMInterpreterName)
+		}
+	}
+	evmInterpreters, err := instantiateInterpreters(evm, cfg, specs)
+	if err != nil {
+		return nil, err
+	}
+	interpreters = append(interpreters, evmInterpreters...)
+
+	for _, interpreter := range interpreters {
+		if _, ok := interpreter.(*EVMInterpreter); ok {
+			return interpreters, nil
+		}
+	}
+	return append(interpreters, NewEVMInterpreter(evm, cfg)), nil
+}
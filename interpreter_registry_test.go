@@ -0,0 +1,128 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingInterpreter runs every contract and remembers its options.
+type recordingInterpreter struct {
+	options []string
+	runs    int
+}
+
+func (in *recordingInterpreter) Run(contract *Contract, input []byte, static bool) ([]byte, error) {
+	in.runs++
+	return []byte("recorded"), nil
+}
+
+func (in *recordingInterpreter) CanRun(code []byte) bool {
+	return len(code) > 0 && code[0] == 0xfe
+}
+
+func init() {
+	RegisterInterpreter("recording", func(evm *EVM, cfg Config, options []string) (Interpreter, error) {
+		return &recordingInterpreter{options: options}, nil
+	})
+	RegisterInterpreter("broken", func(evm *EVM, cfg Config, options []string) (Interpreter, error) {
+		return nil, errors.New("broken")
+	})
+}
+
+func TestParseInterpreterConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	specs, err := ParseInterpreterConfig("")
+	assert.Nil(err)
+	assert.Nil(specs)
+
+	specs, err = ParseInterpreterConfig("recording:a:b=c, evm")
+	assert.Nil(err)
+	assert.Equal([]InterpreterSpec{
+		{Name: "recording", Options: []string{"a", "b=c"}},
+		{Name: "evm", Options: []string{}},
+	}, specs)
+
+	_, err = ParseInterpreterConfig("unknown")
+	assert.NotNil(err)
+	_, err = ParseInterpreterConfig("evm,,recording")
+	assert.NotNil(err)
+}
+
+func TestRegisterInterpreter(t *testing.T) {
+	assert := assert.New(t)
+	assert.Contains(RegisteredInterpreters(), EVMInterpreterName)
+	assert.Contains(RegisteredInterpreters(), EWASMInterpreterName)
+
+	factory := func(evm *EVM, cfg Config, options []string) (Interpreter, error) { return nil, nil }
+	assert.Panics(func() { RegisterInterpreter(EVMInterpreterName, factory) })
+	assert.Panics(func() { RegisterInterpreter("with:colon", factory) })
+	assert.Panics(func() { RegisterInterpreter("nil", nil) })
+}
+
+func TestInterpreterSelection(t *testing.T) {
+	assert := assert.New(t)
+	ctx := Context{BlockNumber: big.NewInt(1)}
+
+	// The built-in interpreter is always the fallback.
+	evm := NewEVMWithConfig(ctx, nil, params.TestChainConfig, Config{EVMInterpreter: "recording:x"})
+	assert.Equal(2, len(evm.interpreters))
+	assert.Equal([]string{"x"}, evm.interpreters[0].(*recordingInterpreter).options)
+	assert.IsType(&EVMInterpreter{}, evm.interpreters[1])
+	assert.Equal(evm.interpreters[0], evm.Interpreter())
+
+	// An explicitly listed built-in interpreter keeps its position.
+	evm = NewEVMWithConfig(ctx, nil, params.TestChainConfig, Config{EVMInterpreter: "evm,recording"})
+	assert.Equal(2, len(evm.interpreters))
+	assert.IsType(&EVMInterpreter{}, evm.interpreters[0])
+
+	// The eWASM interpreters are only selected after the fork.
+	config := *params.TestChainConfig
+	config.EWASMBlock = big.NewInt(2)
+	evm = NewEVMWithConfig(ctx, nil, &config, Config{EWASMInterpreter: "recording"})
+	assert.Equal(1, len(evm.interpreters))
+	evm = NewEVMWithConfig(Context{BlockNumber: big.NewInt(2)}, nil, &config, Config{})
+	assert.Equal(2, len(evm.interpreters))
+	assert.IsType(&EWASMInterpreter{}, evm.interpreters[0])
+
+	// An invalid configuration fails every execution.
+	for _, cfg := range []string{"missing", "broken", "evm:opt", "missing,,broken", "broken,recording:y", "ewasm"} {
+		evm = NewEVMWithConfig(ctx, nil, params.TestChainConfig, Config{EVMInterpreter: cfg})
+		assert.NotNil(evm.InterpreterError(), cfg)
+		assert.IsType(&EVMInterpreter{}, evm.Interpreter(), cfg)
+		contract := NewContract(AccountRef(callerAddress), AccountRef(contractAddress), new(big.Int), 100000)
+		contract.Code = []byte{byte(STOP)}
+		_, err := run(evm, contract, nil, false)
+		assert.Equal(evm.InterpreterError(), err, cfg)
+	}
+	evm = NewEVMWithConfig(Context{BlockNumber: big.NewInt(2)}, nil, &config, Config{EWASMInterpreter: "broken"})
+	assert.NotNil(evm.InterpreterError())
+
+	// The eWASM interpreter can be selected for all code after the fork.
+	evm = NewEVMWithConfig(Context{BlockNumber: big.NewInt(2)}, nil, &config, Config{EVMInterpreter: "ewasm"})
+	assert.Nil(evm.InterpreterError())
+	assert.Equal(3, len(evm.interpreters))
+}
+
+func TestInterpreterDispatch(t *testing.T) {
+	assert := assert.New(t)
+	evm := NewEVMWithConfig(Context{BlockNumber: big.NewInt(1)}, nil, params.TestChainConfig, Config{EVMInterpreter: "recording"})
+	recording := evm.interpreters[0].(*recordingInterpreter)
+
+	contract := NewContract(AccountRef(callerAddress), AccountRef(contractAddress), new(big.Int), 100000)
+	contract.Code = []byte{0xfe, 0x00}
+	ret, err := run(evm, contract, nil, false)
+	assert.Nil(err)
+	assert.Equal([]byte("recorded"), ret)
+	assert.Equal(1, recording.runs)
+
+	// Code the custom interpreter rejects falls through to the built-in one.
+	contract.Code = []byte{byte(STOP)}
+	_, err = run(evm, contract, nil, false)
+	assert.Nil(err)
+	assert.Equal(1, recording.runs)
+}
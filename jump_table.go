@@ -23,19 +23,21 @@ import (
 )
 
 type (
-	executionFunc func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error)
-	gasFunc       func(params.GasTable, *EVM, *Contract, *Stack, *Memory, uint64) (uint64, error) // last parameter is the requested memory size as a uint64
-	// memorySizeFunc returns the required size, and whether the operation overflowed a uint64
-	memorySizeFunc func(*Stack) (size uint64, overflow bool)
+	// ExecutionFunc executes an instruction
+	ExecutionFunc func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error)
+	// GasFunc returns the dynamic gas of an instruction
+	GasFunc func(params.GasTable, *EVM, *Contract, *Stack, *Memory, uint64) (uint64, error) // last parameter is the requested memory size as a uint64
+	// MemorySizeFunc returns the required size, and whether the operation overflowed a uint64
+	MemorySizeFunc func(*Stack) (size uint64, overflow bool)
 )
 
 var errGasUintOverflow = errors.New("gas uint64 overflow")
 
 type operation struct {
 	// execute is the operation function
-	execute     executionFunc
+	execute     ExecutionFunc
 	constantGas uint64
-	dynamicGas  gasFunc
+	dynamicGas  GasFunc
 	// minStack tells how many stack items are required
 	minStack int
 	// maxStack specifies the max length the stack can have for this operation
@@ -43,7 +45,7 @@ type operation struct {
 	maxStack int
 
 	// memorySize returns the memory size required for the operation
-	memorySize memorySizeFunc
+	memorySize MemorySizeFunc
 
 	halts   bool // indicates whether the operation should halt further execution
 	jumps   bool // indicates whether the program counter should not increment
@@ -51,18 +53,119 @@ type operation struct {
 	valid   bool // indication whether the retrieved operation is valid and known
 	reverts bool // determines whether the operation reverts state (implicitly halts)
 	returns bool // determines whether the operations sets the return data content
+
+	disabled bool // removed from the jump table by JumpTable.Disable
 }
 
+// JumpTable maps every opcode to the operation executing it.
+type JumpTable [256]operation
+
 var (
 	frontierInstructionSet       = newFrontierInstructionSet()
 	homesteadInstructionSet      = newHomesteadInstructionSet()
 	byzantiumInstructionSet      = newByzantiumInstructionSet()
 	constantinopleInstructionSet = newConstantinopleInstructionSet()
+
+	// eofInstructionSet is set up in init, as contract creation validates
+	// EOF code against it, which would otherwise be an initialization cycle.
+	eofInstructionSet JumpTable
 )
 
+func init() {
+	eofInstructionSet = newEOFInstructionSet()
+}
+
+// newEOFInstructionSet returns the instructions available to EOF code: the
+// constantinople instructions without dynamic jumps and code introspection,
+// extended by relative jumps, functions and data section access.
+func newEOFInstructionSet() JumpTable {
+	instructionSet := newConstantinopleInstructionSet()
+	for _, op := range []OpCode{JUMP, JUMPI, PC, CODESIZE, CODECOPY, CALLCODE, SELFDESTRUCT} {
+		instructionSet[op] = operation{}
+	}
+	instructionSet[RJUMP] = operation{
+		execute:     opRjump,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+		valid:       true,
+	}
+	instructionSet[RJUMPI] = operation{
+		execute:     opRjumpi,
+		constantGas: params.RjumpiGas,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+		jumps:       true,
+		valid:       true,
+	}
+	instructionSet[RJUMPV] = operation{
+		execute:     opRjumpv,
+		constantGas: params.RjumpiGas,
+		minStack:    minStack(1, 0),
+		maxStack:    maxStack(1, 0),
+		jumps:       true,
+		valid:       true,
+	}
+	instructionSet[CALLF] = operation{
+		execute:     opCallf,
+		constantGas: GasFastStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+		valid:       true,
+	}
+	instructionSet[RETF] = operation{
+		execute:     opRetf,
+		constantGas: GasFastestStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+		valid:       true,
+	}
+	instructionSet[JUMPF] = operation{
+		execute:     opJumpf,
+		constantGas: GasFastStep,
+		minStack:    minStack(0, 0),
+		maxStack:    maxStack(0, 0),
+		jumps:       true,
+		valid:       true,
+	}
+	instructionSet[DATALOAD] = operation{
+		execute:     opDataLoad,
+		constantGas: params.DataLoadGas,
+		minStack:    minStack(1, 1),
+		maxStack:    maxStack(1, 1),
+		valid:       true,
+	}
+	instructionSet[DATALOADN] = operation{
+		execute:     opDataLoadN,
+		constantGas: GasFastestStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+		valid:       true,
+	}
+	instructionSet[DATASIZE] = operation{
+		execute:     opDataSize,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+		valid:       true,
+	}
+	instructionSet[DATACOPY] = operation{
+		execute:    opDataCopy,
+		dynamicGas: gasCallDataCopy,
+		minStack:   minStack(3, 0),
+		maxStack:   maxStack(3, 0),
+		memorySize: memoryCallDataCopy,
+		valid:      true,
+	}
+	return instructionSet
+}
+
 // NewConstantinopleInstructionSet returns the frontier, homestead
 // byzantium and contantinople instructions.
-func newConstantinopleInstructionSet() [256]operation {
+func newConstantinopleInstructionSet() JumpTable {
 	// instructions that can be executed during the byzantium phase.
 	instructionSet := newByzantiumInstructionSet()
 	instructionSet[SHL] = operation{
@@ -108,7 +211,7 @@ func newConstantinopleInstructionSet() [256]operation {
 
 // NewByzantiumInstructionSet returns the frontier, homestead and
 // byzantium instructions.
-func newByzantiumInstructionSet() [256]operation {
+func newByzantiumInstructionSet() JumpTable {
 	// instructions that can be executed during the homestead phase.
 	instructionSet := newHomesteadInstructionSet()
 	instructionSet[STATICCALL] = operation{
@@ -150,7 +253,7 @@ func newByzantiumInstructionSet() [256]operation {
 
 // NewHomesteadInstructionSet returns the frontier and homestead
 // instructions that can be executed during the homestead phase.
-func newHomesteadInstructionSet() [256]operation {
+func newHomesteadInstructionSet() JumpTable {
 	instructionSet := newFrontierInstructionSet()
 	instructionSet[DELEGATECALL] = operation{
 		execute:    opDelegateCall,
@@ -166,8 +269,8 @@ func newHomesteadInstructionSet() [256]operation {
 
 // NewFrontierInstructionSet returns the frontier instructions
 // that can be executed during the frontier phase.
-func newFrontierInstructionSet() [256]operation {
-	return [256]operation{
+func newFrontierInstructionSet() JumpTable {
+	return JumpTable{
 		STOP: {
 			execute:     opStop,
 			constantGas: 0,
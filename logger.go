@@ -20,6 +20,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common"
 	"github.com/DSiSc/evm-NG/common/hexutil"
 	"github.com/DSiSc/evm-NG/common/math"
 	"github.com/DSiSc/evm-NG/util"
@@ -48,34 +49,45 @@ type LogConfig struct {
 	DisableStorage bool // disable storage capture
 	Debug          bool // print output during capture end
 	Limit          int  // maximum length of output, but zero means unlimited
+
+	EnableReturnData bool // capture the return data of the last call
+	MemoryDiff       bool // capture only the changed part of the memory, see RestoreMemory
 }
 
 //go:generate gencodec -type StructLog -field-override structLogMarshaling -out gen_structlog.go
 
 // StructLog is emitted to the EVM each cycle and lists information about the current internal state
 // prior to the execution of the statement.
+//
+// With LogConfig.MemoryDiff the Memory only holds the bytes starting at
+// MemoryOffset which have changed since the previous log of the call.
 type StructLog struct {
 	Pc            uint64                    `json:"pc"`
 	Op            OpCode                    `json:"op"`
 	Gas           uint64                    `json:"gas"`
 	GasCost       uint64                    `json:"gasCost"`
 	Memory        []byte                    `json:"memory"`
+	MemoryOffset  int                       `json:"memOffset,omitempty"`
 	MemorySize    int                       `json:"memSize"`
 	Stack         []*big.Int                `json:"stack"`
+	ReturnData    []byte                    `json:"returnData,omitempty"`
 	Storage       map[types.Hash]types.Hash `json:"-"`
 	Depth         int                       `json:"depth"`
+	Address       types.Address             `json:"-"`
 	RefundCounter uint64                    `json:"refund"`
 	Err           error                     `json:"-"`
 }
 
 // overrides for gencodec
 type structLogMarshaling struct {
-	Stack       []*math.HexOrDecimal256
-	Gas         math.HexOrDecimal64
-	GasCost     math.HexOrDecimal64
-	Memory      hexutil.Bytes
-	OpName      string `json:"opName"` // adds call to OpName() in MarshalJSON
-	ErrorString string `json:"error"`  // adds call to ErrorString() in MarshalJSON
+	Stack         []*math.HexOrDecimal256
+	Gas           math.HexOrDecimal64
+	GasCost       math.HexOrDecimal64
+	Memory        hexutil.Bytes
+	ReturnData    hexutil.Bytes
+	OpName        string `json:"opName"`  // adds call to OpName() in MarshalJSON
+	AddressString string `json:"address"` // adds call to AddressString() in MarshalJSON
+	ErrorString   string `json:"error"`   // adds call to ErrorString() in MarshalJSON
 }
 
 // OpName formats the operand name in a human-readable format.
@@ -83,6 +95,11 @@ func (s *StructLog) OpName() string {
 	return s.Op.String()
 }
 
+// AddressString formats the address of the executing contract.
+func (s *StructLog) AddressString() string {
+	return hexutil.Encode(s.Address[:])
+}
+
 // ErrorString formats the log's error as a string.
 func (s *StructLog) ErrorString() string {
 	if s.Err != nil {
@@ -91,13 +108,53 @@ func (s *StructLog) ErrorString() string {
 	return ""
 }
 
+// CallType is the kind of a call frame reported to CaptureEnter.
+type CallType int
+
+// Kinds of call frames.
+const (
+	CallTypeCall CallType = iota
+	CallTypeCallCode
+	CallTypeDelegateCall
+	CallTypeStaticCall
+	CallTypeCreate
+	CallTypeCreate2
+	CallTypeSystem
+)
+
+var callTypeToString = map[CallType]string{
+	CallTypeCall:         "CALL",
+	CallTypeCallCode:     "CALLCODE",
+	CallTypeDelegateCall: "DELEGATECALL",
+	CallTypeStaticCall:   "STATICCALL",
+	CallTypeCreate:       "CREATE",
+	CallTypeCreate2:      "CREATE2",
+	CallTypeSystem:       "SYSTEM",
+}
+
+func (t CallType) String() string {
+	if str, ok := callTypeToString[t]; ok {
+		return str
+	}
+	return fmt.Sprintf("CallType(%d)", int(t))
+}
+
 // Tracer is used to collect execution traces from an EVM transaction
 // execution. CaptureState is called for each step of the VM with the
 // current VM state.
+//
+// CaptureTxStart and CaptureTxEnd enclose the top level call or creation,
+// which is reported by CaptureStart and CaptureEnd. Nested calls, including
+// those to system contracts, are reported by CaptureEnter and CaptureExit.
+// The value of delegate and static calls is nil.
 // Note that reference types are actual VM data structures; make copies
 // if you need to retain them beyond the current call.
 type Tracer interface {
+	CaptureTxStart(env *EVM, gasLimit uint64) error
+	CaptureTxEnd(restGas uint64) error
 	CaptureStart(from types.Address, to types.Address, call bool, input []byte, gas uint64, value *big.Int) error
+	CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error
+	CaptureExit(output []byte, gasUsed uint64, err error) error
 	CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error
 	CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
@@ -106,13 +163,14 @@ type Tracer interface {
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
-// a track record of modified storage which is used in reporting snapshots of the
+// a track record of read and modified storage which is used in reporting snapshots of the
 // contract their storage.
 type StructLogger struct {
 	cfg LogConfig
 
 	logs          []StructLog
 	changedValues map[types.Address]Storage
+	memories      [][]byte // memory of the last log per call depth, for memory diffs
 	output        []byte
 	err           error
 }
@@ -129,7 +187,34 @@ func NewStructLogger(cfg *LogConfig) *StructLogger {
 }
 
 // CaptureStart implements the Tracer interface to initialize the tracing operation.
+// The storage and memory tracked for previous calls are discarded, the logs are kept
+// until Reset.
 func (l *StructLogger) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	l.changedValues = make(map[types.Address]Storage)
+	l.memories = nil
+	l.output, l.err = nil, nil
+	return nil
+}
+
+// CaptureTxStart implements the Tracer interface. The structured logger
+// does not track transactions.
+func (l *StructLogger) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (l *StructLogger) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface. Nested calls are logged by
+// the steps of their code only.
+func (l *StructLogger) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) error {
 	return nil
 }
 
@@ -157,11 +242,23 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 		)
 		l.changedValues[contract.Address()][address] = value
 	}
+	// capture SLOAD opcodes and record the value read.
+	if op == SLOAD && stack.len() >= 1 {
+		address := util.BigToHash(stack.data[stack.len()-1])
+		l.changedValues[contract.Address()][address] = env.StateDB.GetHashTypeState(contract.Address(), address)
+	}
 	// Copy a snapstot of the current memory state to a new buffer
-	var mem []byte
+	var (
+		mem       []byte
+		memOffset int
+	)
 	if !l.cfg.DisableMemory {
-		mem = make([]byte, len(memory.Data()))
-		copy(mem, memory.Data())
+		if l.cfg.MemoryDiff {
+			memOffset, mem = l.diffMemory(memory.Data(), depth)
+		} else {
+			mem = make([]byte, len(memory.Data()))
+			copy(mem, memory.Data())
+		}
 	}
 	// Copy a snapshot of the current stack state to a new buffer
 	var stck []*big.Int
@@ -176,17 +273,82 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 	if !l.cfg.DisableStorage {
 		storage = l.changedValues[contract.Address()].Copy()
 	}
+	// Copy the return data of the last call
+	var rdata []byte
+	if l.cfg.EnableReturnData {
+		if in, ok := env.Interpreter().(*EVMInterpreter); ok {
+			rdata = common.CopyBytes(in.returnData)
+		}
+	}
 	// create a new snaptshot of the EVM.
-	log := StructLog{pc, op, gas, cost, mem, memory.Len(), stck, storage, depth, env.StateDB.GetRefund(), err}
+	log := StructLog{
+		Pc:            pc,
+		Op:            op,
+		Gas:           gas,
+		GasCost:       cost,
+		Memory:        mem,
+		MemoryOffset:  memOffset,
+		MemorySize:    memory.Len(),
+		Stack:         stck,
+		ReturnData:    rdata,
+		Storage:       storage,
+		Depth:         depth,
+		Address:       contract.Address(),
+		RefundCounter: env.StateDB.GetRefund(),
+		Err:           err,
+	}
 
 	l.logs = append(l.logs, log)
 	return nil
 }
 
 // CaptureFault implements the Tracer interface to trace an execution fault
-// while running an opcode.
+// while running an opcode. The error is recorded in the log of the failing
+// opcode, which is added if it isn't the last one, e.g. after a call.
 func (l *StructLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
-	return nil
+	if n := len(l.logs); n > 0 {
+		if last := &l.logs[n-1]; last.Pc == pc && last.Op == op && last.Depth == depth && last.Err == nil {
+			last.Err = err
+			return nil
+		}
+	}
+	return l.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// diffMemory returns the part of the memory which has changed since the
+// previous log at the call depth, and its offset.
+func (l *StructLogger) diffMemory(data []byte, depth int) (int, []byte) {
+	// Drop the memories of returned calls, which are deeper
+	if len(l.memories) > depth+1 {
+		l.memories = l.memories[:depth+1]
+	}
+	for len(l.memories) <= depth {
+		l.memories = append(l.memories, nil)
+	}
+	prev := l.memories[depth]
+
+	// Memory only grows, with zeroes
+	prevAt := func(i int) byte {
+		if i < len(prev) {
+			return prev[i]
+		}
+		return 0
+	}
+	start, end := 0, len(data)
+	for start < end && data[start] == prevAt(start) {
+		start++
+	}
+	for end > start && data[end-1] == prevAt(end-1) {
+		end--
+	}
+	var diff []byte
+	if start < end {
+		diff = common.CopyBytes(data[start:end])
+	} else {
+		start = 0
+	}
+	l.memories[depth] = append(prev[:0], data...)
+	return start, diff
 }
 
 // CaptureEnd is called after the call finishes to finalize the tracing.
@@ -205,6 +367,37 @@ func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration
 // StructLogs returns the captured log entries.
 func (l *StructLogger) StructLogs() []StructLog { return l.logs }
 
+// Reset discards the captured log entries.
+func (l *StructLogger) Reset() {
+	l.logs = nil
+	l.changedValues = make(map[types.Address]Storage)
+	l.memories = nil
+	l.output, l.err = nil, nil
+}
+
+// RestoreMemory replaces the memory diffs of logs captured with
+// LogConfig.MemoryDiff by the full memory.
+func RestoreMemory(logs []StructLog) {
+	var memories [][]byte // memory per call depth
+	for i := range logs {
+		log := &logs[i]
+		if len(memories) > log.Depth+1 {
+			memories = memories[:log.Depth+1]
+		}
+		for len(memories) <= log.Depth {
+			memories = append(memories, nil)
+		}
+		mem := make([]byte, log.MemorySize)
+		copy(mem, memories[log.Depth])
+		if log.MemoryOffset < len(mem) {
+			copy(mem[log.MemoryOffset:], log.Memory)
+		}
+
+		memories[log.Depth] = mem
+		log.Memory, log.MemoryOffset = common.CopyBytes(mem), 0
+	}
+}
+
 // Error returns the VM error captured by the trace.
 func (l *StructLogger) Error() error { return l.err }
 
@@ -230,6 +423,10 @@ func WriteTrace(writer io.Writer, logs []StructLog) {
 			fmt.Fprintln(writer, "Memory:")
 			fmt.Fprint(writer, hex.Dump(log.Memory))
 		}
+		if len(log.ReturnData) > 0 {
+			fmt.Fprintln(writer, "ReturnData:")
+			fmt.Fprint(writer, hex.Dump(log.ReturnData))
+		}
 		if len(log.Storage) > 0 {
 			fmt.Fprintln(writer, "Storage:")
 			for h, item := range log.Storage {
@@ -0,0 +1,136 @@
+package evm
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/common/math"
+)
+
+// jsonStep is a single step of an EIP-3155 trace.
+type jsonStep struct {
+	Pc         uint64              `json:"pc"`
+	Op         OpCode              `json:"op"`
+	Gas        math.HexOrDecimal64 `json:"gas"`
+	GasCost    math.HexOrDecimal64 `json:"gasCost"`
+	Memory     *hexutil.Bytes      `json:"memory,omitempty"`
+	MemorySize int                 `json:"memSize"`
+	Stack      []*hexutil.Big      `json:"stack"`
+	Depth      int                 `json:"depth"`
+	Refund     uint64              `json:"refund"`
+	OpName     string              `json:"opName"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// jsonSummary is the line closing an EIP-3155 trace.
+type jsonSummary struct {
+	Output  hexutil.Bytes       `json:"output"`
+	GasUsed math.HexOrDecimal64 `json:"gasUsed"`
+	Pass    bool                `json:"pass"`
+	Time    time.Duration       `json:"time"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// JSONLogger is a Tracer streaming an EIP-3155 trace to a writer, one JSON
+// object per line for every step followed by a summary of the top level
+// call. Unlike the StructLogger it keeps no steps in memory, so traces of
+// any length can be written. The storage and debug options of the LogConfig
+// don't apply.
+type JSONLogger struct {
+	cfg     LogConfig
+	encoder *json.Encoder
+	steps   int
+
+	step jsonStep // reused for every step
+}
+
+// NewJSONLogger returns a new logger writing to writer.
+func NewJSONLogger(cfg *LogConfig, writer io.Writer) *JSONLogger {
+	logger := &JSONLogger{
+		encoder: json.NewEncoder(writer),
+		step:    jsonStep{Stack: []*hexutil.Big{}},
+	}
+	if cfg != nil {
+		logger.cfg = *cfg
+	}
+	return logger
+}
+
+// CaptureTxStart implements the Tracer interface.
+func (l *JSONLogger) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (l *JSONLogger) CaptureTxEnd(restGas uint64) error {
+	return nil
+}
+
+// CaptureStart implements the Tracer interface.
+func (l *JSONLogger) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface. Nested calls are traced by
+// the steps of their code only.
+func (l *JSONLogger) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (l *JSONLogger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureState writes the step to the writer.
+func (l *JSONLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if l.cfg.Limit != 0 && l.cfg.Limit <= l.steps {
+		return ErrTraceLimitReached
+	}
+	l.steps++
+
+	step := &l.step
+	step.Pc, step.Op, step.Gas, step.GasCost = pc, op, math.HexOrDecimal64(gas), math.HexOrDecimal64(cost)
+	step.MemorySize, step.Depth, step.Refund, step.OpName = memory.Len(), depth, env.StateDB.GetRefund(), op.String()
+
+	step.Memory = nil
+	if !l.cfg.DisableMemory {
+		data := hexutil.Bytes(memory.Data())
+		step.Memory = &data
+	}
+	step.Stack = step.Stack[:0]
+	if !l.cfg.DisableStack {
+		for _, item := range stack.Data() {
+			step.Stack = append(step.Stack, (*hexutil.Big)(item))
+		}
+	}
+	step.Error = ""
+	if err != nil {
+		step.Error = err.Error()
+	}
+	return l.encoder.Encode(step)
+}
+
+// CaptureFault writes the step failing during its execution again, with
+// the error, after the step written by CaptureState before the execution.
+func (l *JSONLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return l.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// CaptureEnd writes the summary of the top level call to the writer.
+func (l *JSONLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	summary := jsonSummary{
+		Output:  output,
+		GasUsed: math.HexOrDecimal64(gasUsed),
+		Pass:    err == nil,
+		Time:    t,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	return l.encoder.Encode(&summary)
+}
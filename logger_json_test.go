@@ -0,0 +1,91 @@
+package evm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc     = mockPreBlockChain()
+		buf    = new(bytes.Buffer)
+		logger = NewJSONLogger(&LogConfig{DisableMemory: true}, buf)
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: logger})
+	)
+	bc.SetCode(contractAddress, []byte{byte(PUSH1), 2, byte(PUSH1), 3, byte(ADD), byte(STOP)})
+	_, left, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 100000, new(big.Int))
+	assert.Nil(err)
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.Nil(json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	assert.Equal(5, len(lines))
+
+	add := lines[2]
+	assert.Equal(float64(4), add["pc"])
+	assert.Equal(float64(ADD), add["op"])
+	assert.Equal("ADD", add["opName"])
+	assert.Equal("0x3", add["gasCost"])
+	assert.Equal(float64(1), add["depth"])
+	assert.Equal([]interface{}{"0x2", "0x3"}, add["stack"])
+	assert.NotContains(add, "memory")
+	assert.NotContains(add, "error")
+	assert.Equal([]interface{}{"0x5"}, lines[3]["stack"])
+
+	summary := lines[4]
+	assert.Equal("0x", summary["output"])
+	assert.Equal(true, summary["pass"])
+	assert.Equal("0x9", summary["gasUsed"])
+	assert.Equal(uint64(100000-9), left)
+
+	// Stop writing steps once the limit is reached.
+	buf.Reset()
+	logger = NewJSONLogger(&LogConfig{Limit: 1}, buf)
+	env = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: logger})
+	_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 100000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(2, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.Contains(buf.String(), `"memory":"0x"`)
+}
+
+func TestJSONLoggerFault(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc     = mockPreBlockChain()
+		buf    = new(bytes.Buffer)
+		logger = NewJSONLogger(nil, buf)
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: logger})
+	)
+	bc.SetCode(contractAddress, []byte{byte(PUSH1), 3, byte(JUMP), byte(STOP)})
+	_, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 100000, new(big.Int))
+	assert.Equal(errInvalidJump, err)
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.Nil(json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	assert.Equal(4, len(lines))
+
+	// The JUMP is written before its execution and again with its error.
+	assert.Equal("JUMP", lines[1]["opName"])
+	assert.NotContains(lines[1], "error")
+	assert.Equal("JUMP", lines[2]["opName"])
+	assert.Equal(float64(2), lines[2]["pc"])
+	assert.Equal(errInvalidJump.Error(), lines[2]["error"])
+	assert.Equal(false, lines[3]["pass"])
+	assert.Equal(errInvalidJump.Error(), lines[3]["error"])
+}
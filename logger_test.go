@@ -17,11 +17,18 @@
 package evm
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/util"
 	"github.com/DSiSc/repository"
 	"math/big"
+	"reflect"
 	"testing"
+	"time"
 )
 
 type dummyContractRef struct {
@@ -67,3 +74,224 @@ func TestStoreCapture(t *testing.T) {
 		t.Errorf("expected %x, got %x", exp, logger.changedValues[contract.Address()][index])
 	}
 }
+
+// hookTracer records the call frame events.
+type hookTracer struct {
+	StructLogger
+	events []string
+}
+
+func (t *hookTracer) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	t.events = append(t.events, fmt.Sprintf("txstart %d", gasLimit))
+	return nil
+}
+
+func (t *hookTracer) CaptureTxEnd(restGas uint64) error {
+	t.events = append(t.events, "txend")
+	return nil
+}
+
+func (t *hookTracer) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.events = append(t.events, "start")
+	return nil
+}
+
+func (t *hookTracer) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	t.events = append(t.events, fmt.Sprintf("enter %v %x", typ, to[19]))
+	return nil
+}
+
+func (t *hookTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	t.events = append(t.events, fmt.Sprintf("exit %x %v", output, err))
+	return nil
+}
+
+func (t *hookTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	t.events = append(t.events, "end")
+	return nil
+}
+
+func TestCaptureEnterExit(t *testing.T) {
+	var (
+		bc     = mockPreBlockChain()
+		tracer = &hookTracer{StructLogger: *NewStructLogger(nil)}
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+		callee = util.HexToAddress("0x000000000000000000000000000000000000000b")
+	)
+	// Call, delegate call and static call the callee, then create a contract
+	// with empty code.
+	var code []byte
+	for _, op := range []OpCode{CALL, DELEGATECALL, STATICCALL} {
+		code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0)
+		if op == CALL {
+			code = append(code, byte(PUSH1), 0)
+		}
+		code = append(code, byte(PUSH20))
+		code = append(code, callee[:]...)
+		code = append(code, byte(PUSH2), 0xff, 0xff, byte(op), byte(POP))
+	}
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(CREATE), byte(POP), byte(STOP))
+	bc.SetCode(contractAddress, code)
+	// Return one zero byte.
+	bc.CreateAccount(callee)
+	bc.SetCode(callee, []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(RETURN)})
+
+	_, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := crypto.CreateAddress(contractAddress, 0)
+	want := []string{
+		"txstart 1000000", "start",
+		"enter CALL b", "exit 00 <nil>",
+		"enter DELEGATECALL b", "exit 00 <nil>",
+		"enter STATICCALL b", "exit 00 <nil>",
+		fmt.Sprintf("enter CREATE %x", created[19]), "exit  <nil>",
+		"end", "txend",
+	}
+	if !reflect.DeepEqual(tracer.events, want) {
+		t.Errorf("events mismatch:\nhave %q\nwant %q", tracer.events, want)
+	}
+}
+
+// traceStructLogs runs code calling a callee with calleeCode and returns the
+// logger tracing it.
+func traceStructLogs(cfg *LogConfig, code, calleeCode []byte) *StructLogger {
+	var (
+		bc     = mockPreBlockChain()
+		logger = NewStructLogger(cfg)
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: logger})
+	)
+	bc.SetCode(contractAddress, code)
+	bc.SetHashTypeState(contractAddress, util.BigToHash(big.NewInt(1)), util.BigToHash(big.NewInt(5)))
+	bc.CreateAccount(debugCallee)
+	bc.SetCode(debugCallee, calleeCode)
+	env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	return logger
+}
+
+func TestStructLoggerSload(t *testing.T) {
+	logger := traceStructLogs(nil, []byte{byte(PUSH1), 1, byte(SLOAD), byte(POP), byte(STOP)}, nil)
+	logs := logger.StructLogs()
+	if len(logs) != 4 {
+		t.Fatalf("expected 4 logs, got %d", len(logs))
+	}
+	var (
+		slot = util.BigToHash(big.NewInt(1))
+		exp  = util.BigToHash(big.NewInt(5))
+	)
+	if logs[1].Storage[slot] != exp {
+		t.Errorf("expected slot value %x, got %x", exp, logs[1].Storage[slot])
+	}
+	if logs[1].Address != contractAddress {
+		t.Errorf("expected address %x, got %x", contractAddress, logs[1].Address)
+	}
+}
+
+func TestStructLoggerFault(t *testing.T) {
+	logger := traceStructLogs(nil, []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT)}, nil)
+	logs := logger.StructLogs()
+	if len(logs) != 3 {
+		t.Fatalf("expected 3 logs, got %d", len(logs))
+	}
+	if logs[2].Op != REVERT || logs[2].Err != errExecutionReverted {
+		t.Errorf("expected REVERT to fail with %v, got %v failing with %v", errExecutionReverted, logs[2].Op, logs[2].Err)
+	}
+	if logger.Error() != errExecutionReverted {
+		t.Errorf("expected error %v, got %v", errExecutionReverted, logger.Error())
+	}
+}
+
+func TestStructLoggerReturnData(t *testing.T) {
+	// Call the callee returning 0x2a as a word, then pop the result.
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, debugCallee[:]...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(POP), byte(STOP))
+	calleeCode := []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)}
+
+	logs := traceStructLogs(&LogConfig{EnableReturnData: true}, code, calleeCode).StructLogs()
+	last := logs[len(logs)-2]
+	if last.Op != POP || !bytes.Equal(last.ReturnData, util.HashToBytes(util.BigToHash(big.NewInt(0x2a)))) {
+		t.Errorf("expected return data of the call at POP, got %x at %v", last.ReturnData, last.Op)
+	}
+	if logs[len(logs)-3].Address != debugCallee || logs[len(logs)-3].Depth != 2 {
+		t.Errorf("expected callee at depth 2, got %x at %d", logs[len(logs)-3].Address, logs[len(logs)-3].Depth)
+	}
+	enc, err := json.Marshal(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec StructLog
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec.ReturnData, last.ReturnData) {
+		t.Errorf("return data mismatch after JSON round trip: %x", dec.ReturnData)
+	}
+}
+
+func TestStructLoggerMemoryDiff(t *testing.T) {
+	// Store two words in the callee and one in the caller after the call.
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, debugCallee[:]...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(PUSH1), 0x2c, byte(PUSH1), 0, byte(MSTORE), byte(STOP))
+	calleeCode := []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 0x2b, byte(PUSH1), 32, byte(MSTORE), byte(STOP)}
+
+	full := traceStructLogs(nil, code, calleeCode).StructLogs()
+	diff := traceStructLogs(&LogConfig{MemoryDiff: true}, code, calleeCode).StructLogs()
+	if len(full) != len(diff) {
+		t.Fatalf("expected %d logs, got %d", len(full), len(diff))
+	}
+	var size int
+	for i := range diff {
+		size += len(diff[i].Memory)
+	}
+	if size != 3 {
+		t.Errorf("expected 3 changed bytes, got %d", size)
+	}
+	RestoreMemory(diff)
+	for i := range full {
+		if !bytes.Equal(full[i].Memory, diff[i].Memory) {
+			t.Errorf("log %d: memory mismatch: have %x, want %x", i, diff[i].Memory, full[i].Memory)
+		}
+	}
+}
+
+func TestStructLoggerGasCost(t *testing.T) {
+	// A custom instruction charging both constant and dynamic gas.
+	jt := NewJumpTable()
+	min, max := StackBounds(0, 0)
+	err := jt.Register(opDouble, OperationSpec{
+		Execute: func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+			return nil, nil
+		},
+		ConstantGas: 100,
+		DynamicGas: func(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+			return 7, nil
+		},
+		MinStack: min,
+		MaxStack: max,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		bc     = mockPreBlockChain()
+		logger = NewStructLogger(nil)
+		env    = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: logger, JumpTable: &jt})
+	)
+	bc.SetCode(contractAddress, []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE), byte(opDouble), byte(STOP)})
+	env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+
+	// The cost of an instruction is its constant plus its dynamic gas.
+	logs := logger.StructLogs()
+	want := []uint64{GasFastestStep, GasFastestStep, GasFastestStep + 3, 100 + 7, 0}
+	if len(logs) != len(want) {
+		t.Fatalf("expected %d logs, got %d", len(want), len(logs))
+	}
+	for i, log := range logs {
+		if log.GasCost != want[i] {
+			t.Errorf("%v: expected cost %d, got %d", log.Op, want[i], log.GasCost)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package evm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+)
+
+// MuxTracer is a Tracer passing every callback on to several tracers, so a
+// transaction can be traced in different ways in a single execution.
+//
+// A tracer returning an error, e.g. ErrTraceLimitReached, is stopped: it
+// receives no further CaptureState and CaptureFault callbacks until the next
+// transaction starts, while the other tracers carry on. It still receives
+// the callbacks of the call frames and of the end of the transaction, so
+// it can complete its result. The error is available from Errors.
+type MuxTracer struct {
+	tracers []Tracer
+	errs    []error // first error returned by each tracer
+}
+
+// NewMuxTracer returns a tracer passing the callbacks to tracers, in order.
+func NewMuxTracer(tracers ...Tracer) *MuxTracer {
+	return &MuxTracer{
+		tracers: tracers,
+		errs:    make([]error, len(tracers)),
+	}
+}
+
+// Tracers returns the tracers the callbacks are passed to.
+func (t *MuxTracer) Tracers() []Tracer { return t.tracers }
+
+// Errors returns the error which stopped each of the tracers, or nil for
+// those still running.
+func (t *MuxTracer) Errors() []error { return t.errs }
+
+// each calls fn for all the tracers and stops those returning an error.
+func (t *MuxTracer) each(fn func(tracer Tracer) error) error {
+	for i, tracer := range t.tracers {
+		if err := fn(tracer); err != nil && t.errs[i] == nil {
+			t.errs[i] = err
+		}
+	}
+	return nil
+}
+
+// eachRunning calls fn for the running tracers and stops those returning an
+// error.
+func (t *MuxTracer) eachRunning(fn func(tracer Tracer) error) error {
+	for i, tracer := range t.tracers {
+		if t.errs[i] != nil {
+			continue
+		}
+		t.errs[i] = fn(tracer)
+	}
+	return nil
+}
+
+// CaptureTxStart implements the Tracer interface, restarting stopped tracers.
+func (t *MuxTracer) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	for i := range t.errs {
+		t.errs[i] = nil
+	}
+	return t.each(func(tracer Tracer) error {
+		return tracer.CaptureTxStart(env, gasLimit)
+	})
+}
+
+// CaptureTxEnd implements the Tracer interface.
+func (t *MuxTracer) CaptureTxEnd(restGas uint64) error {
+	return t.each(func(tracer Tracer) error {
+		return tracer.CaptureTxEnd(restGas)
+	})
+}
+
+// CaptureStart implements the Tracer interface.
+func (t *MuxTracer) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return t.each(func(tracer Tracer) error {
+		return tracer.CaptureStart(from, to, create, input, gas, value)
+	})
+}
+
+// CaptureEnter implements the Tracer interface.
+func (t *MuxTracer) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	return t.each(func(tracer Tracer) error {
+		return tracer.CaptureEnter(typ, from, to, input, gas, value)
+	})
+}
+
+// CaptureExit implements the Tracer interface.
+func (t *MuxTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return t.each(func(tracer Tracer) error {
+		return tracer.CaptureExit(output, gasUsed, err)
+	})
+}
+
+// CaptureState implements the Tracer interface.
+func (t *MuxTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return t.eachRunning(func(tracer Tracer) error {
+		return tracer.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+	})
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *MuxTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return t.eachRunning(func(tracer Tracer) error {
+		return tracer.CaptureFault(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+	})
+}
+
+// CaptureEnd implements the Tracer interface.
+func (t *MuxTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return t.each(func(tracer Tracer) error {
+		return tracer.CaptureEnd(output, gasUsed, d, err)
+	})
+}
@@ -0,0 +1,45 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxTracer(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc      = mockPreBlockChain()
+		logger  = NewStructLogger(&LogConfig{Limit: 2})
+		calls   = NewCallTracer(nil)
+		counter = NewStructLogger(nil)
+		tracer  = NewMuxTracer(logger, calls, counter)
+		env     = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	)
+	bc.SetCode(contractAddress, []byte{byte(PUSH1), 2, byte(PUSH1), 3, byte(ADD), byte(STOP)})
+	_, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 100000, new(big.Int))
+	assert.Nil(err)
+
+	// The limited logger is stopped, the others trace the whole call.
+	assert.Equal(2, len(logger.StructLogs()))
+	assert.Equal(4, len(counter.StructLogs()))
+	assert.Equal(uint64(9), calls.Result().GasUsed)
+	assert.Equal([]error{ErrTraceLimitReached, nil, nil}, tracer.Errors())
+
+	// Stopped tracers are restarted by the next transaction.
+	tracer.CaptureTxStart(env, 100000)
+	assert.Equal([]error{nil, nil, nil}, tracer.Errors())
+
+	// Stopped tracers still receive the end of the call frames.
+	limited := &hookTracer{StructLogger: *NewStructLogger(&LogConfig{Limit: 1})}
+	tracer = NewMuxTracer(limited)
+	env = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 100000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(1, len(limited.StructLogs()))
+	assert.Equal([]error{ErrTraceLimitReached}, tracer.Errors())
+	assert.Equal("txend", limited.events[len(limited.events)-1])
+	assert.Contains(limited.events, "end")
+}
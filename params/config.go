@@ -142,16 +142,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), types.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), types.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), types.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), types.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, &CliqueConfig{Period: 0, Epoch: 30000}}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), types.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), types.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), nil, nil, nil, nil, nil, nil, new(EthashConfig), nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -191,6 +191,14 @@ type ChainConfig struct {
 	ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
 	PetersburgBlock     *big.Int `json:"petersburgBlock,omitempty"`     // Petersburg switch block (nil = same as Constantinople)
 	EWASMBlock          *big.Int `json:"ewasmBlock,omitempty"`          // EWASM switch block (nil = no fork, 0 = already activated)
+	EOFBlock            *big.Int `json:"eofBlock,omitempty"`            // EVM Object Format switch block (nil = no fork, 0 = already activated)
+	EIP152Block         *big.Int `json:"eip152Block,omitempty"`         // EIP152 (BLAKE2b F precompile) switch block (nil = no fork, 0 = already activated)
+	EIP2537Block        *big.Int `json:"eip2537Block,omitempty"`        // EIP2537 (BLS12-381 precompiles) switch block (nil = no fork, 0 = already activated)
+	RIP7212Block        *big.Int `json:"rip7212Block,omitempty"`        // RIP7212 (secp256r1 precompile) switch block (nil = no fork, 0 = already activated)
+	SMCryptoBlock       *big.Int `json:"smCryptoBlock,omitempty"`       // SM2/SM3 precompiles switch block (nil = no fork, 0 = already activated)
+	EIP2565Block        *big.Int `json:"eip2565Block,omitempty"`        // EIP2565 (ModExp repricing) switch block (nil = no fork, 0 = already activated)
+	PoseidonBlock       *big.Int `json:"poseidonBlock,omitempty"`       // Poseidon hash precompile switch block (nil = no fork, 0 = already activated)
+	EIP7823Block        *big.Int `json:"eip7823Block,omitempty"`        // EIP7823 (ModExp input bounds, with the EIP2565 pricing) switch block (nil = no fork, 0 = already activated)
 
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
@@ -289,6 +297,51 @@ func (c *ChainConfig) IsEWASM(num *big.Int) bool {
 	return isForked(c.EWASMBlock, num)
 }
 
+// IsEOF returns whether num represents a block number after the EVM Object
+// Format fork
+func (c *ChainConfig) IsEOF(num *big.Int) bool {
+	return isForked(c.EOFBlock, num)
+}
+
+// IsEIP152 returns whether num is either equal to the EIP152 fork block or greater.
+func (c *ChainConfig) IsEIP152(num *big.Int) bool {
+	return isForked(c.EIP152Block, num)
+}
+
+// IsEIP2537 returns whether num is either equal to the EIP2537 fork block or greater.
+func (c *ChainConfig) IsEIP2537(num *big.Int) bool {
+	return isForked(c.EIP2537Block, num)
+}
+
+// IsRIP7212 returns whether num is either equal to the RIP7212 fork block or greater.
+func (c *ChainConfig) IsRIP7212(num *big.Int) bool {
+	return isForked(c.RIP7212Block, num)
+}
+
+// IsSMCrypto returns whether num is either equal to the SM2/SM3 precompiles
+// fork block or greater.
+func (c *ChainConfig) IsSMCrypto(num *big.Int) bool {
+	return isForked(c.SMCryptoBlock, num)
+}
+
+// IsEIP2565 returns whether num is either equal to the EIP2565 fork block or
+// greater.
+func (c *ChainConfig) IsEIP2565(num *big.Int) bool {
+	return isForked(c.EIP2565Block, num)
+}
+
+// IsPoseidon returns whether num is either equal to the Poseidon precompile
+// fork block or greater.
+func (c *ChainConfig) IsPoseidon(num *big.Int) bool {
+	return isForked(c.PoseidonBlock, num)
+}
+
+// IsEIP7823 returns whether num is either equal to the EIP7823 fork block or
+// greater.
+func (c *ChainConfig) IsEIP7823(num *big.Int) bool {
+	return isForked(c.EIP7823Block, num)
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -348,6 +401,30 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EWASMBlock, newcfg.EWASMBlock, head) {
 		return newCompatError("ewasm fork block", c.EWASMBlock, newcfg.EWASMBlock)
 	}
+	if isForkIncompatible(c.EOFBlock, newcfg.EOFBlock, head) {
+		return newCompatError("EOF fork block", c.EOFBlock, newcfg.EOFBlock)
+	}
+	if isForkIncompatible(c.EIP152Block, newcfg.EIP152Block, head) {
+		return newCompatError("EIP152 fork block", c.EIP152Block, newcfg.EIP152Block)
+	}
+	if isForkIncompatible(c.EIP2537Block, newcfg.EIP2537Block, head) {
+		return newCompatError("EIP2537 fork block", c.EIP2537Block, newcfg.EIP2537Block)
+	}
+	if isForkIncompatible(c.RIP7212Block, newcfg.RIP7212Block, head) {
+		return newCompatError("RIP7212 fork block", c.RIP7212Block, newcfg.RIP7212Block)
+	}
+	if isForkIncompatible(c.SMCryptoBlock, newcfg.SMCryptoBlock, head) {
+		return newCompatError("SMCrypto fork block", c.SMCryptoBlock, newcfg.SMCryptoBlock)
+	}
+	if isForkIncompatible(c.EIP2565Block, newcfg.EIP2565Block, head) {
+		return newCompatError("EIP2565 fork block", c.EIP2565Block, newcfg.EIP2565Block)
+	}
+	if isForkIncompatible(c.PoseidonBlock, newcfg.PoseidonBlock, head) {
+		return newCompatError("Poseidon fork block", c.PoseidonBlock, newcfg.PoseidonBlock)
+	}
+	if isForkIncompatible(c.EIP7823Block, newcfg.EIP7823Block, head) {
+		return newCompatError("EIP7823 fork block", c.EIP7823Block, newcfg.EIP7823Block)
+	}
 	return nil
 }
 
@@ -415,6 +492,7 @@ type Rules struct {
 	ChainID                                     *big.Int
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158   bool
 	IsByzantium, IsConstantinople, IsPetersburg bool
+	IsEOF                                       bool
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -432,5 +510,6 @@ func (c *ChainConfig) Rules(num *big.Int) Rules {
 		IsByzantium:      c.IsByzantium(num),
 		IsConstantinople: c.IsConstantinople(num),
 		IsPetersburg:     c.IsPetersburg(num),
+		IsEOF:            c.IsEOF(num),
 	}
 }
@@ -53,6 +53,8 @@ const (
 	NetSstoreResetClearRefund uint64 = 19800 // Once per SSTORE operation for resetting to the original zero value
 
 	JumpdestGas      uint64 = 1     // Once per JUMPDEST operation.
+	RjumpiGas        uint64 = 4     // Once per RJUMPI and RJUMPV operation.
+	DataLoadGas      uint64 = 4     // Once per DATALOAD operation.
 	EpochDuration    uint64 = 30000 // Duration between proof-of-work epochs.
 	CallGas          uint64 = 40    // Once per CALL operation & message call transaction.
 	CreateDataGas    uint64 = 200   //
@@ -73,18 +75,51 @@ const (
 
 	// Precompiled contract gas prices
 
-	EcrecoverGas            uint64 = 3000   // Elliptic curve sender recovery gas price
-	Sha256BaseGas           uint64 = 60     // Base price for a SHA256 operation
-	Sha256PerWordGas        uint64 = 12     // Per-word price for a SHA256 operation
-	Ripemd160BaseGas        uint64 = 600    // Base price for a RIPEMD160 operation
-	Ripemd160PerWordGas     uint64 = 120    // Per-word price for a RIPEMD160 operation
-	IdentityBaseGas         uint64 = 15     // Base price for a data copy operation
-	IdentityPerWordGas      uint64 = 3      // Per-work price for a data copy operation
-	ModExpQuadCoeffDiv      uint64 = 20     // Divisor for the quadratic particle of the big int modular exponentiation
-	Bn256AddGas             uint64 = 500    // Gas needed for an elliptic curve addition
-	Bn256ScalarMulGas       uint64 = 40000  // Gas needed for an elliptic curve scalar multiplication
-	Bn256PairingBaseGas     uint64 = 100000 // Base price for an elliptic curve pairing check
-	Bn256PairingPerPointGas uint64 = 80000  // Per-point price for an elliptic curve pairing check
+	EcrecoverGas              uint64 = 3000   // Elliptic curve sender recovery gas price
+	Sha256BaseGas             uint64 = 60     // Base price for a SHA256 operation
+	Sha256PerWordGas          uint64 = 12     // Per-word price for a SHA256 operation
+	Ripemd160BaseGas          uint64 = 600    // Base price for a RIPEMD160 operation
+	Ripemd160PerWordGas       uint64 = 120    // Per-word price for a RIPEMD160 operation
+	IdentityBaseGas           uint64 = 15     // Base price for a data copy operation
+	IdentityPerWordGas        uint64 = 3      // Per-work price for a data copy operation
+	ModExpQuadCoeffDiv        uint64 = 20     // Divisor for the quadratic particle of the big int modular exponentiation
+	ModExpQuadCoeffDivEIP2565 uint64 = 3      // Divisor for the quadratic particle of the big int modular exponentiation after EIP-2565
+	ModExpMinGasEIP2565       uint64 = 200    // Minimum price of a big int modular exponentiation after EIP-2565
+	ModExpMaxInputLength      uint64 = 1024   // Maximum byte length of a modular exponentiation operand after EIP-7823
+	Bn256AddGas               uint64 = 500    // Gas needed for an elliptic curve addition
+	Bn256ScalarMulGas         uint64 = 40000  // Gas needed for an elliptic curve scalar multiplication
+	Bn256PairingBaseGas       uint64 = 100000 // Base price for an elliptic curve pairing check
+	Bn256PairingPerPointGas   uint64 = 80000  // Per-point price for an elliptic curve pairing check
+	Blake2FPerRoundGas        uint64 = 1      // Per-round price for a BLAKE2b F compression
+	P256VerifyGas             uint64 = 3450   // Price for a secp256r1 signature verification
+	Sm3BaseGas                uint64 = 60     // Base price for an SM3 operation
+	Sm3PerWordGas             uint64 = 12     // Per-word price for an SM3 operation
+	Sm2VerifyGas              uint64 = 3450   // Price for an SM2 signature verification
+	Sm2RecoverGas             uint64 = 3450   // Price for an SM2 public key recovery
+	PoseidonT3Gas             uint64 = 800    // Price for a Poseidon permutation of width 3, hashing 2 field elements
+	PoseidonT4Gas             uint64 = 1000   // Price for a Poseidon permutation of width 4, hashing 3 field elements
+	PoseidonT5Gas             uint64 = 1400   // Price for a Poseidon permutation of width 5, hashing 4 field elements
+	PoseidonT6Gas             uint64 = 1550   // Price for a Poseidon permutation of width 6, hashing 5 field elements
+
+	// BLS12-381 precompiled contract gas prices, see EIP-2537
+
+	Bls12381G1AddGas          uint64 = 375   // Price for a BLS12-381 G1 point addition
+	Bls12381G1MulGas          uint64 = 12000 // Price for a BLS12-381 G1 scalar multiplication, before the MSM discount
+	Bls12381G2AddGas          uint64 = 600   // Price for a BLS12-381 G2 point addition
+	Bls12381G2MulGas          uint64 = 22500 // Price for a BLS12-381 G2 scalar multiplication, before the MSM discount
+	Bls12381PairingBaseGas    uint64 = 37700 // Base price for a BLS12-381 pairing check
+	Bls12381PairingPerPairGas uint64 = 32600 // Per-pair price for a BLS12-381 pairing check
+	Bls12381MapG1Gas          uint64 = 5500  // Price for mapping a field element to a BLS12-381 G1 point
+	Bls12381MapG2Gas          uint64 = 23800 // Price for mapping an Fp2 element to a BLS12-381 G2 point
+
+	// System contract gas prices
+
+	SystemContractInputByteGas  uint64 = 16     // Per-byte price of the input of a system contract call
+	SystemContractOutputWordGas uint64 = 3      // Per-word price of the output of a system contract call, charged after its execution
+	SystemBufferBaseGas         uint64 = 800    // Base price for a system buffer operation
+	SystemBufferPerWordGas      uint64 = 5000   // Per-word price for the input of a system buffer operation, stored by writes
+	TencentCosGas               uint64 = 100000 // Price for a Tencent COS object transfer, doing network I/O
+	RpcContractGas              uint64 = 100000 // Price for a cross chain RPC, doing network I/O
 )
 
 var (
@@ -93,3 +128,33 @@ var (
 	MinimumDifficulty      = big.NewInt(131072) // The minimum that the difficulty may ever be.
 	DurationLimit          = big.NewInt(13)     // The decision boundary on the blocktime duration used to determine whether difficulty should go up or not.
 )
+
+// bls12381MultiExpDiscountTable is the gas discount of a BLS12-381 multi
+// scalar multiplication (MSM), in thousandths, by the number of pairs of
+// points and scalars. The last entry applies to larger MSMs.
+var (
+	bls12381G1MultiExpDiscountTable = [128]uint64{1000, 949, 848, 797, 764, 750, 738, 728, 719, 712, 705, 698, 692, 687, 682, 677, 673, 669, 665, 661, 658, 654, 651, 648, 645, 642, 640, 637, 635, 632, 630, 627, 625, 623, 621, 619, 617, 615, 613, 611, 609, 608, 606, 604, 603, 601, 599, 598, 596, 595, 593, 592, 591, 589, 588, 586, 585, 584, 582, 581, 580, 579, 577, 576, 575, 574, 573, 572, 570, 569, 568, 567, 566, 565, 564, 563, 562, 561, 560, 559, 558, 557, 556, 555, 554, 553, 552, 551, 550, 549, 548, 547, 547, 546, 545, 544, 543, 542, 541, 540, 540, 539, 538, 537, 536, 536, 535, 534, 533, 532, 532, 531, 530, 529, 528, 528, 527, 526, 525, 525, 524, 523, 522, 522, 521, 520, 520, 519}
+	bls12381G2MultiExpDiscountTable = [128]uint64{1000, 1000, 923, 884, 855, 832, 812, 796, 782, 770, 759, 749, 740, 732, 724, 717, 711, 704, 699, 693, 688, 683, 679, 674, 670, 666, 663, 659, 655, 652, 649, 646, 643, 640, 637, 634, 632, 629, 627, 624, 622, 620, 618, 615, 613, 611, 609, 607, 606, 604, 602, 600, 598, 597, 595, 593, 592, 590, 589, 587, 586, 584, 583, 582, 580, 579, 578, 576, 575, 574, 573, 571, 570, 569, 568, 567, 566, 565, 563, 562, 561, 560, 559, 558, 557, 556, 555, 554, 553, 552, 552, 551, 550, 549, 548, 547, 546, 545, 545, 544, 543, 542, 541, 541, 540, 539, 538, 537, 537, 536, 535, 535, 534, 533, 532, 532, 531, 530, 530, 529, 528, 528, 527, 526, 526, 525, 524, 524}
+)
+
+// Bls12381G1MultiExpDiscount returns the gas discount of a BLS12-381 G1 MSM
+// of k pairs, in thousandths.
+func Bls12381G1MultiExpDiscount(k int) uint64 {
+	return bls12381MultiExpDiscount(&bls12381G1MultiExpDiscountTable, k)
+}
+
+// Bls12381G2MultiExpDiscount returns the gas discount of a BLS12-381 G2 MSM
+// of k pairs, in thousandths.
+func Bls12381G2MultiExpDiscount(k int) uint64 {
+	return bls12381MultiExpDiscount(&bls12381G2MultiExpDiscountTable, k)
+}
+
+func bls12381MultiExpDiscount(table *[128]uint64, k int) uint64 {
+	switch {
+	case k < 1:
+		return table[0]
+	case k > len(table):
+		return table[len(table)-1]
+	}
+	return table[k-1]
+}
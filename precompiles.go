@@ -0,0 +1,156 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+)
+
+// precompileOverride changes the precompiled contract at an address from
+// an activation height on. A nil contract removes it.
+type precompileOverride struct {
+	addr       types.Address
+	contract   PrecompiledContract
+	activation uint64
+}
+
+// PrecompileRegistry holds the changes of a chain to the default precompiled
+// contracts of its fork rules. It is passed to the EVMs in Config and is safe
+// for concurrent use.
+type PrecompileRegistry struct {
+	lock      sync.RWMutex
+	overrides []precompileOverride
+}
+
+// NewPrecompileRegistry returns an empty registry.
+func NewPrecompileRegistry() *PrecompileRegistry {
+	return new(PrecompileRegistry)
+}
+
+// Register adds a precompiled contract at an address from the block at
+// height activation on. A contract already registered at the address,
+// including the default ones, is replaced. It panics if the contract is nil.
+//
+// Registrations are taken into account by the EVMs created afterwards.
+func (r *PrecompileRegistry) Register(addr types.Address, contract PrecompiledContract, activation uint64) {
+	if contract == nil {
+		panic(fmt.Sprintf("nil precompiled contract at %x", addr))
+	}
+	r.add(precompileOverride{addr: addr, contract: contract, activation: activation})
+}
+
+// Remove removes the precompiled contract at an address from the block at
+// height activation on.
+func (r *PrecompileRegistry) Remove(addr types.Address, activation uint64) {
+	r.add(precompileOverride{addr: addr, activation: activation})
+}
+
+func (r *PrecompileRegistry) add(override precompileOverride) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Copy the overrides, the EVMs resolving them concurrently
+	overrides := append(append([]precompileOverride(nil), r.overrides...), override)
+	// Apply the overrides by activation, the later registration last.
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return overrides[i].activation < overrides[j].activation
+	})
+	r.overrides = overrides
+}
+
+// Active returns the precompiled contracts of a chain at a block height: the
+// default ones of its fork rules with the registered changes applied. The
+// returned map must not be modified.
+func (r *PrecompileRegistry) Active(config *params.ChainConfig, number *big.Int) map[types.Address]PrecompiledContract {
+	contracts, _ := resolvePrecompiles(config, number, r)
+	return contracts
+}
+
+// ActivePrecompiles returns the default precompiled contracts of a chain at
+// a block height, following its fork rules. The returned map must not be
+// modified.
+func ActivePrecompiles(config *params.ChainConfig, number *big.Int) map[types.Address]PrecompiledContract {
+	contracts, _ := resolvePrecompiles(config, number, nil)
+	return contracts
+}
+
+// resolvePrecompiles returns the active precompiled contracts, with the
+// changes of the registry if not nil, and those of them added at addresses
+// outside the default set.
+func resolvePrecompiles(config *params.ChainConfig, number *big.Int, registry *PrecompileRegistry) (contracts map[types.Address]PrecompiledContract, custom map[types.Address]bool) {
+	base := PrecompiledContractsHomestead
+	if config.IsByzantium(number) {
+		base = PrecompiledContractsByzantium
+	}
+	if config.IsEIP152(number) {
+		base = mergePrecompiles(base, PrecompiledContractsEIP152)
+	}
+	if config.IsEIP2537(number) {
+		base = mergePrecompiles(base, PrecompiledContractsEIP2537)
+	}
+	if config.IsEIP2565(number) {
+		base = mergePrecompiles(base, PrecompiledContractsEIP2565)
+	}
+	if config.IsRIP7212(number) {
+		base = mergePrecompiles(base, PrecompiledContractsRIP7212)
+	}
+	if config.IsSMCrypto(number) {
+		base = mergePrecompiles(base, PrecompiledContractsSMCrypto)
+	}
+	if config.IsPoseidon(number) {
+		base = mergePrecompiles(base, PrecompiledContractsPoseidon)
+	}
+	if config.IsEIP7823(number) {
+		base = mergePrecompiles(base, PrecompiledContractsEIP7823)
+	}
+	if registry == nil {
+		return base, nil
+	}
+	registry.lock.RLock()
+	overrides := registry.overrides
+	registry.lock.RUnlock()
+	if len(overrides) == 0 {
+		return base, nil
+	}
+
+	contracts = mergePrecompiles(base, nil)
+	custom = make(map[types.Address]bool)
+	for _, override := range overrides {
+		if number == nil || number.Cmp(new(big.Int).SetUint64(override.activation)) < 0 {
+			break
+		}
+		if override.contract == nil {
+			delete(contracts, override.addr)
+			delete(custom, override.addr)
+			continue
+		}
+		contracts[override.addr] = override.contract
+		if base[override.addr] == nil {
+			custom[override.addr] = true
+		}
+	}
+	return contracts, custom
+}
+
+// mergePrecompiles returns the union of two sets of precompiled contracts,
+// those of extra taking precedence.
+func mergePrecompiles(base, extra map[types.Address]PrecompiledContract) map[types.Address]PrecompiledContract {
+	merged := make(map[types.Address]PrecompiledContract, len(base)+len(extra))
+	for addr, contract := range base {
+		merged[addr] = contract
+	}
+	for addr, contract := range extra {
+		merged[addr] = contract
+	}
+	return merged
+}
+
+// Precompile returns the precompiled contract active at an address.
+func (evm *EVM) Precompile(addr types.Address) (PrecompiledContract, bool) {
+	contract, ok := evm.precompiles[addr]
+	return contract, ok
+}
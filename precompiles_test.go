@@ -0,0 +1,126 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// doublePrecompile returns its input twice.
+type doublePrecompile struct{}
+
+func (c *doublePrecompile) RequiredGas(input []byte) uint64 { return 10 }
+
+func (c *doublePrecompile) Run(input []byte) ([]byte, error) {
+	return append(append([]byte{}, input...), input...), nil
+}
+
+func TestActivePrecompiles(t *testing.T) {
+	assert := assert.New(t)
+	config := *params.TestChainConfig
+	var (
+		sha256Addr = util.BytesToAddress([]byte{2})
+		customAddr = util.BytesToAddress([]byte{1, 0})
+		double     = &doublePrecompile{}
+		eip152     = mergePrecompiles(PrecompiledContractsByzantium, PrecompiledContractsEIP152)
+	)
+	assert.Equal(eip152, ActivePrecompiles(&config, big.NewInt(1)))
+	byzantium := config
+	byzantium.EIP152Block = nil
+	assert.Equal(PrecompiledContractsByzantium, ActivePrecompiles(&byzantium, big.NewInt(1)))
+	eip2537 := config
+	eip2537.EIP2537Block = big.NewInt(2)
+	assert.Equal(eip152, ActivePrecompiles(&eip2537, big.NewInt(1)))
+	assert.Equal(mergePrecompiles(eip152, PrecompiledContractsEIP2537), ActivePrecompiles(&eip2537, big.NewInt(2)))
+	// The forks are independent of each other.
+	eip2537.EIP152Block = nil
+	assert.Equal(mergePrecompiles(PrecompiledContractsByzantium, PrecompiledContractsEIP2537), ActivePrecompiles(&eip2537, big.NewInt(2)))
+	eip2565 := config
+	eip2565.EIP2565Block = big.NewInt(2)
+	assert.Equal(eip152, ActivePrecompiles(&eip2565, big.NewInt(1)))
+	active := ActivePrecompiles(&eip2565, big.NewInt(2))
+	assert.Len(active, len(eip152))
+	assert.Equal(&bigModExp{eip2565: true}, active[util.BytesToAddress([]byte{5})])
+	eip7823 := config
+	eip7823.EIP7823Block = big.NewInt(2)
+	active = ActivePrecompiles(&eip7823, big.NewInt(2))
+	assert.Len(active, len(eip152))
+	assert.Equal(&bigModExp{eip2565: true, eip7823: true}, active[util.BytesToAddress([]byte{5})])
+	rip7212 := config
+	rip7212.RIP7212Block = big.NewInt(3)
+	assert.Equal(eip152, ActivePrecompiles(&rip7212, big.NewInt(2)))
+	active = ActivePrecompiles(&rip7212, big.NewInt(3))
+	assert.Len(active, len(eip152)+1)
+	assert.Equal(&p256Verify{}, active[customAddr])
+	smCrypto := config
+	smCrypto.SMCryptoBlock = big.NewInt(4)
+	assert.Equal(eip152, ActivePrecompiles(&smCrypto, big.NewInt(3)))
+	assert.Len(ActivePrecompiles(&smCrypto, big.NewInt(4)), len(eip152)+len(PrecompiledContractsSMCrypto))
+	poseidon := config
+	poseidon.PoseidonBlock = big.NewInt(4)
+	assert.Equal(eip152, ActivePrecompiles(&poseidon, big.NewInt(3)))
+	active = ActivePrecompiles(&poseidon, big.NewInt(4))
+	assert.Len(active, len(eip152)+1)
+	assert.Equal(&poseidonHash{}, active[util.BytesToAddress([]byte{3, 0})])
+
+	registry := NewPrecompileRegistry()
+	assert.Equal(eip152, registry.Active(&config, big.NewInt(10)))
+	registry.Register(customAddr, double, 10)
+	registry.Remove(sha256Addr, 5)
+
+	active = registry.Active(&config, big.NewInt(5))
+	assert.NotContains(active, sha256Addr)
+	assert.NotContains(active, customAddr)
+	active = registry.Active(&config, big.NewInt(10))
+	assert.Equal(double, active[customAddr])
+	assert.Len(active, len(eip152))
+	assert.Contains(eip152, sha256Addr)
+
+	// The changes apply on top of the fork rules.
+	active = registry.Active(&byzantium, big.NewInt(10))
+	assert.Len(active, len(PrecompiledContractsByzantium))
+	assert.Equal(double, active[customAddr])
+
+	// A later registration replaces the contract again.
+	registry.Register(sha256Addr, double, 20)
+	assert.Equal(double, registry.Active(&config, big.NewInt(20))[sha256Addr])
+
+	// The default set is not affected.
+	assert.Equal(eip152, ActivePrecompiles(&config, big.NewInt(20)))
+	var none *PrecompileRegistry
+	assert.Equal(eip152, none.Active(&config, big.NewInt(20)))
+	assert.Panics(func() { registry.Register(customAddr, nil, 0) })
+}
+
+func TestCustomPrecompile(t *testing.T) {
+	assert := assert.New(t)
+	registry := NewPrecompileRegistry()
+	customAddr := util.BytesToAddress([]byte{1, 0})
+	registry.Register(customAddr, &doublePrecompile{}, 0)
+
+	// Return the code size of the precompile and the result of calling it
+	// with the two bytes 0xabcd.
+	code := []byte{byte(PUSH2), 0xab, 0xcd, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 4, byte(PUSH1), 32, byte(PUSH1), 2, byte(PUSH1), 30, byte(PUSH1), 0, byte(PUSH2), 1, 0, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(POP),
+		byte(PUSH2), 1, 0, byte(EXTCODESIZE), byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 36, byte(PUSH1), 0, byte(RETURN)}
+	bc := mockPreBlockChain()
+	bc.SetCode(contractAddress, code)
+	env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Precompiles: registry})
+	_, ok := env.Precompile(customAddr)
+	assert.True(ok)
+
+	ret, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(util.BigToHash(big.NewInt(1))), ret[:32])
+	assert.Equal([]byte{0xab, 0xcd, 0xab, 0xcd}, ret[32:])
+
+	// Built-in precompiles have no code.
+	env = NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{})
+	ret, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(util.BigToHash(new(big.Int))), ret[:32])
+}
@@ -0,0 +1,284 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/evm-NG/util"
+)
+
+// AccountState is the state of an account recorded by the PrestateTracer.
+// Only the storage slots accessed during the transaction are included.
+type AccountState struct {
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[types.Hash]types.Hash
+}
+
+type accountStateJSON struct {
+	Balance *hexutil.Big      `json:"balance,omitempty"`
+	Nonce   uint64            `json:"nonce,omitempty"`
+	Code    hexutil.Bytes     `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// MarshalJSON encodes the account in the format of the common
+// prestateTracer.
+func (a *AccountState) MarshalJSON() ([]byte, error) {
+	enc := accountStateJSON{
+		Balance: (*hexutil.Big)(a.Balance),
+		Nonce:   a.Nonce,
+		Code:    a.Code,
+	}
+	if len(a.Storage) > 0 {
+		enc.Storage = make(map[string]string, len(a.Storage))
+		for key, value := range a.Storage {
+			enc.Storage[hexutil.Encode(key[:])] = hexutil.Encode(value[:])
+		}
+	}
+	return json.Marshal(&enc)
+}
+
+// AccountStates maps addresses to the state of their accounts.
+type AccountStates map[types.Address]*AccountState
+
+// MarshalJSON encodes the accounts keyed by their hex addresses.
+func (s AccountStates) MarshalJSON() ([]byte, error) {
+	enc := make(map[string]*AccountState, len(s))
+	for addr, account := range s {
+		enc[hexutil.Encode(addr[:])] = account
+	}
+	return json.Marshal(enc)
+}
+
+// PrestateTracerConfig are the configuration options for the PrestateTracer.
+type PrestateTracerConfig struct {
+	DiffMode bool // report the changed state before and after the transaction
+}
+
+// PrestateTracer is a Tracer recording the state of every account and
+// storage slot touched by a transaction, as read when first accessed. In
+// diff mode it also reads the state at the end of the transaction and
+// reports only what has changed.
+//
+// The state is read from the EVM, so changes made before the top level call,
+// e.g. buying the gas of the transaction, are already included. The value
+// transfer and nonce increment of the top level call are accounted for.
+type PrestateTracer struct {
+	cfg PrestateTracerConfig
+	env *EVM
+
+	pre     AccountStates
+	existed map[types.Address]bool // whether the accounts existed when first accessed
+
+	diffPre  AccountStates
+	diffPost AccountStates
+}
+
+// NewPrestateTracer returns a new prestate tracer.
+func NewPrestateTracer(cfg *PrestateTracerConfig) *PrestateTracer {
+	tracer := &PrestateTracer{
+		pre:     make(AccountStates),
+		existed: make(map[types.Address]bool),
+	}
+	if cfg != nil {
+		tracer.cfg = *cfg
+	}
+	return tracer
+}
+
+// CaptureTxStart implements the Tracer interface to reset the tracer for a
+// new transaction.
+func (t *PrestateTracer) CaptureTxStart(env *EVM, gasLimit uint64) error {
+	t.env = env
+	t.pre = make(AccountStates)
+	t.existed = make(map[types.Address]bool)
+	t.diffPre, t.diffPost = nil, nil
+	return nil
+}
+
+// CaptureTxEnd implements the Tracer interface to compute the state diff.
+func (t *PrestateTracer) CaptureTxEnd(restGas uint64) error {
+	if t.cfg.DiffMode && t.env != nil {
+		t.diffPre, t.diffPost = t.diff()
+	}
+	return nil
+}
+
+// CaptureStart implements the Tracer interface to record the sender, the
+// recipient and the coinbase. The EVM has already transferred the value
+// and, for creations, incremented the nonce of the sender, which is undone
+// in the recorded state. The coinbase is recorded last, so that a coinbase
+// sending or receiving the transaction is corrected too.
+func (t *PrestateTracer) CaptureStart(from types.Address, to types.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if t.env == nil {
+		return nil
+	}
+	if t.lookupAccount(from) {
+		if value != nil && from != to {
+			t.pre[from].Balance.Add(t.pre[from].Balance, value)
+		}
+		if create && t.pre[from].Nonce > 0 {
+			t.pre[from].Nonce--
+		}
+	}
+	if t.lookupAccount(to) {
+		if value != nil && from != to {
+			t.pre[to].Balance.Sub(t.pre[to].Balance, value)
+		}
+		if create {
+			t.pre[to] = &AccountState{Balance: new(big.Int)}
+			t.existed[to] = false
+		}
+	}
+	t.lookupAccount(t.env.Coinbase)
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface to record the callee of a
+// nested call before any value is transferred.
+func (t *PrestateTracer) CaptureEnter(typ CallType, from types.Address, to types.Address, input []byte, gas uint64, value *big.Int) error {
+	if t.env != nil {
+		t.lookupAccount(to)
+	}
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (t *PrestateTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface to record the storage slots
+// and accounts accessed by instructions.
+func (t *PrestateTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if t.env == nil || stack.len() == 0 {
+		return nil
+	}
+	switch op {
+	case SLOAD, SSTORE:
+		t.lookupStorage(contract.Address(), util.BigToHash(stack.peek()))
+	case BALANCE, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH, SELFDESTRUCT:
+		t.lookupAccount(util.BigToAddress(stack.peek()))
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface.
+func (t *PrestateTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (t *PrestateTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// lookupAccount records the current state of an account unless it has been
+// recorded already, and tells whether it was recorded now.
+func (t *PrestateTracer) lookupAccount(addr types.Address) bool {
+	if _, ok := t.pre[addr]; ok {
+		return false
+	}
+	db := t.env.StateDB
+	t.pre[addr] = &AccountState{
+		Balance: new(big.Int).Set(db.GetBalance(addr)),
+		Nonce:   db.GetNonce(addr),
+		Code:    db.GetCode(addr),
+		Storage: make(map[types.Hash]types.Hash),
+	}
+	t.existed[addr] = db.Exist(addr)
+	return true
+}
+
+// lookupStorage records the current value of a storage slot unless it has
+// been recorded already.
+func (t *PrestateTracer) lookupStorage(addr types.Address, key types.Hash) {
+	t.lookupAccount(addr)
+	account := t.pre[addr]
+	if account.Storage == nil {
+		account.Storage = make(map[types.Hash]types.Hash)
+	}
+	if _, ok := account.Storage[key]; !ok {
+		account.Storage[key] = t.env.StateDB.GetHashTypeState(addr, key)
+	}
+}
+
+// diff compares the recorded accounts with their current state. Accounts
+// which didn't exist before are left out of the pre state, self destructed
+// accounts out of the post state and unchanged fields and accounts out of
+// both.
+func (t *PrestateTracer) diff() (AccountStates, AccountStates) {
+	var (
+		db   = t.env.StateDB
+		pre  = make(AccountStates)
+		post = make(AccountStates)
+	)
+	for addr, prev := range t.pre {
+		if db.HasSuicided(addr) {
+			if t.existed[addr] {
+				pre[addr] = prev
+			}
+			continue
+		}
+		var (
+			before   = &AccountState{Balance: prev.Balance, Nonce: prev.Nonce, Code: prev.Code}
+			after    = &AccountState{}
+			modified bool
+		)
+		if balance := db.GetBalance(addr); balance.Cmp(prev.Balance) != 0 {
+			after.Balance, modified = new(big.Int).Set(balance), true
+		}
+		if nonce := db.GetNonce(addr); nonce != prev.Nonce {
+			after.Nonce, modified = nonce, true
+		}
+		if code := db.GetCode(addr); !bytes.Equal(code, prev.Code) {
+			after.Code, modified = code, true
+		}
+		for key, value := range prev.Storage {
+			current := db.GetHashTypeState(addr, key)
+			if current == value {
+				continue
+			}
+			if after.Storage == nil {
+				after.Storage = make(map[types.Hash]types.Hash)
+				before.Storage = make(map[types.Hash]types.Hash)
+			}
+			after.Storage[key], before.Storage[key], modified = current, value, true
+		}
+		if !modified {
+			continue
+		}
+		post[addr] = after
+		if t.existed[addr] {
+			pre[addr] = before
+		}
+	}
+	return pre, post
+}
+
+// Prestate returns the recorded accounts as they were when first accessed.
+func (t *PrestateTracer) Prestate() AccountStates { return t.pre }
+
+// Diff returns the changed accounts before and after the transaction. It
+// is only available in diff mode.
+func (t *PrestateTracer) Diff() (pre AccountStates, post AccountStates) {
+	return t.diffPre, t.diffPost
+}
+
+// GetResult returns the recorded state in the JSON format of the common
+// prestateTracer.
+func (t *PrestateTracer) GetResult() (json.RawMessage, error) {
+	if t.cfg.DiffMode {
+		return json.Marshal(struct {
+			Pre  AccountStates `json:"pre"`
+			Post AccountStates `json:"post"`
+		}{t.diffPre, t.diffPost})
+	}
+	return json.Marshal(t.pre)
+}
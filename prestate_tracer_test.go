@@ -0,0 +1,94 @@
+package evm
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrestateTracer(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		bc      = mockPreBlockChain()
+		other   = util.HexToAddress("0x000000000000000000000000000000000000000c")
+		slot1   = util.BigToHash(big.NewInt(1))
+		slot2   = util.BigToHash(big.NewInt(2))
+		five    = util.BigToHash(big.NewInt(5))
+		seven   = util.BigToHash(big.NewInt(7))
+		runCode = func(tracer *PrestateTracer) {
+			env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+			_, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, big.NewInt(10))
+			assert.Nil(err)
+		}
+	)
+	// Load slot 1, store 7 in slot 2 and read the balance of another account.
+	code := []byte{byte(PUSH1), 1, byte(SLOAD), byte(POP), byte(PUSH1), 7, byte(PUSH1), 2, byte(SSTORE), byte(PUSH20)}
+	code = append(code, other[:]...)
+	code = append(code, byte(BALANCE), byte(POP), byte(STOP))
+	bc.SetCode(contractAddress, code)
+	bc.SetHashTypeState(contractAddress, slot1, five)
+	bc.CreateAccount(other)
+	bc.AddBalance(other, big.NewInt(3))
+
+	tracer := NewPrestateTracer(nil)
+	runCode(tracer)
+	pre := tracer.Prestate()
+	assert.Equal(big.NewInt(1000), pre[callerAddress].Balance)
+	assert.Equal(0, pre[contractAddress].Balance.Sign())
+	assert.Equal(code, pre[contractAddress].Code)
+	assert.Equal(five, pre[contractAddress].Storage[slot1])
+	assert.Equal(util.BigToHash(new(big.Int)), pre[contractAddress].Storage[slot2])
+	assert.Equal(big.NewInt(3), pre[other].Balance)
+
+	res, err := tracer.GetResult()
+	assert.Nil(err)
+	var decoded map[string]map[string]interface{}
+	assert.Nil(json.Unmarshal(res, &decoded))
+	assert.Equal("0x3e8", decoded["0x8a8c58e424f4a6d2f0b2270860c96dfe34f10c78"]["balance"])
+	storage := decoded["0xf74cc8824a00bcb96e8546bf3b4dc47ace9cab2c"]["storage"].(map[string]interface{})
+	assert.Equal("0x0000000000000000000000000000000000000000000000000000000000000005", storage["0x0000000000000000000000000000000000000000000000000000000000000001"])
+
+	// Only the changes are reported in diff mode.
+	bc.SetHashTypeState(contractAddress, slot2, util.BigToHash(new(big.Int)))
+	tracer = NewPrestateTracer(&PrestateTracerConfig{DiffMode: true})
+	runCode(tracer)
+	diffPre, diffPost := tracer.Diff()
+	assert.NotContains(diffPre, other)
+	assert.NotContains(diffPost, other)
+	assert.Equal(big.NewInt(990), diffPre[callerAddress].Balance)
+	assert.Equal(big.NewInt(980), diffPost[callerAddress].Balance)
+	assert.Equal(big.NewInt(10), diffPre[contractAddress].Balance)
+	assert.Equal(big.NewInt(20), diffPost[contractAddress].Balance)
+	assert.Nil(diffPost[contractAddress].Code)
+	assert.NotContains(diffPost[contractAddress].Storage, slot1)
+	assert.Equal(seven, diffPost[contractAddress].Storage[slot2])
+	assert.Equal(util.BigToHash(new(big.Int)), diffPre[contractAddress].Storage[slot2])
+
+	res, err = tracer.GetResult()
+	assert.Nil(err)
+	var diff map[string]map[string]map[string]interface{}
+	assert.Nil(json.Unmarshal(res, &diff))
+	assert.Equal("0x3d4", diff["post"]["0x8a8c58e424f4a6d2f0b2270860c96dfe34f10c78"]["balance"])
+}
+
+func TestPrestateTracerCoinbaseSender(t *testing.T) {
+	assert := assert.New(t)
+	bc := mockPreBlockChain()
+	ctx := mockEVM(bc).Context
+	ctx.Coinbase = callerAddress
+	balance, nonce := new(big.Int).Set(bc.GetBalance(callerAddress)), bc.GetNonce(callerAddress)
+
+	// The coinbase creates a contract with a value.
+	tracer := NewPrestateTracer(nil)
+	env := NewEVMWithConfig(ctx, bc, params.TestChainConfig, Config{Debug: true, Tracer: tracer})
+	_, _, _, err := env.Create(AccountRef(callerAddress), []byte{byte(STOP)}, 1000000, big.NewInt(10))
+	assert.Nil(err)
+	pre := tracer.Prestate()
+	assert.Equal(balance, pre[callerAddress].Balance)
+	assert.Equal(nonce, pre[callerAddress].Nonce)
+	assert.Equal(nonce+1, bc.GetNonce(callerAddress))
+}
@@ -0,0 +1,277 @@
+package evm
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errInvalidArtifact = errors.New("invalid compiler artifact")
+
+// SourceMapEntry is the source range an instruction has been compiled from,
+// as listed in a solc source map. File is -1 for instructions not related to
+// a source file.
+type SourceMapEntry struct {
+	Offset        int
+	Length        int
+	File          int
+	Jump          byte // 'i' into a function, 'o' out of it or '-' for regular jumps
+	ModifierDepth int
+}
+
+// ParseSourceMap decodes a compressed solc source map, i.e. the srcmap or
+// srcmap-runtime output, with one entry per instruction of the code.
+func ParseSourceMap(srcmap string) ([]SourceMapEntry, error) {
+	if srcmap == "" {
+		return nil, nil
+	}
+	var (
+		items   = strings.Split(srcmap, ";")
+		entries = make([]SourceMapEntry, len(items))
+		prev    = SourceMapEntry{File: -1, Jump: '-'}
+	)
+	for i, item := range items {
+		entry := prev
+		for j, field := range strings.Split(item, ":") {
+			if field == "" {
+				continue
+			}
+			if j == 3 {
+				if field != "i" && field != "o" && field != "-" {
+					return nil, fmt.Errorf("invalid jump type %q in source map entry %d", field, i)
+				}
+				entry.Jump = field[0]
+				continue
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid source map entry %d: %v", i, err)
+			}
+			switch j {
+			case 0:
+				entry.Offset = n
+			case 1:
+				entry.Length = n
+			case 2:
+				entry.File = n
+			case 4:
+				entry.ModifierDepth = n
+			default:
+				return nil, fmt.Errorf("too many fields in source map entry %d", i)
+			}
+		}
+		entries[i], prev = entry, entry
+	}
+	return entries, nil
+}
+
+// instructionPcs returns the pc of every instruction of code, in order.
+func instructionPcs(code []byte) []uint64 {
+	var pcs []uint64
+	for pc := uint64(0); pc < uint64(len(code)); pc++ {
+		pcs = append(pcs, pc)
+		if op := OpCode(code[pc]); op >= PUSH1 && op <= PUSH32 {
+			pc += uint64(op - PUSH1 + 1)
+		}
+	}
+	return pcs
+}
+
+// SourceFile is a source file compiled into the contracts of an artifact.
+type SourceFile struct {
+	ID      int
+	Name    string
+	Content []byte // nil if not included in the artifact, see LoadSources
+
+	lines []int // offsets of the line starts
+}
+
+// line returns the 1-based line number of a byte offset.
+func (f *SourceFile) line(offset int) int {
+	if f.lines == nil {
+		f.lines = []int{0}
+		for i, c := range f.Content {
+			if c == '\n' {
+				f.lines = append(f.lines, i+1)
+			}
+		}
+	}
+	return sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset })
+}
+
+// CompiledContract is a contract of an artifact, with the source maps of
+// its creation and runtime code.
+type CompiledContract struct {
+	Name          string
+	Code          []byte // creation code
+	SourceMap     []SourceMapEntry
+	RuntimeCode   []byte
+	RuntimeSrcMap []SourceMapEntry
+}
+
+// CompilerArtifact is the output of solc needed to map executed code back
+// to the source files.
+type CompilerArtifact struct {
+	Sources   map[int]*SourceFile
+	Contracts []*CompiledContract
+}
+
+// combinedJSON is the output of solc --combined-json bin,bin-runtime,srcmap,srcmap-runtime.
+type combinedJSON struct {
+	Contracts map[string]struct {
+		Bin           string `json:"bin"`
+		BinRuntime    string `json:"bin-runtime"`
+		Srcmap        string `json:"srcmap"`
+		SrcmapRuntime string `json:"srcmap-runtime"`
+	} `json:"contracts"`
+	SourceList []string `json:"sourceList"`
+}
+
+// standardJSON is the output of solc --standard-json, optionally wrapped
+// with its input as in the build info files of development frameworks.
+type standardJSON struct {
+	Sources map[string]struct {
+		ID int `json:"id"`
+	} `json:"sources"`
+	Contracts map[string]map[string]struct {
+		EVM struct {
+			Bytecode         standardBytecode `json:"bytecode"`
+			DeployedBytecode standardBytecode `json:"deployedBytecode"`
+		} `json:"evm"`
+	} `json:"contracts"`
+}
+
+type standardBytecode struct {
+	Object    string `json:"object"`
+	SourceMap string `json:"sourceMap"`
+}
+
+type buildInfoJSON struct {
+	Input *struct {
+		Sources map[string]struct {
+			Content string `json:"content"`
+		} `json:"sources"`
+	} `json:"input"`
+	Output *standardJSON `json:"output"`
+}
+
+// LoadCompilerArtifact decodes the combined JSON or standard JSON output of
+// solc. The source files are only included if the artifact contains the
+// standard JSON input as well, otherwise they can be read by LoadSources.
+// Unlinked code can't be matched with executed code and is left out.
+func LoadCompilerArtifact(data []byte) (*CompilerArtifact, error) {
+	var combined combinedJSON
+	if err := json.Unmarshal(data, &combined); err != nil {
+		return nil, fmt.Errorf("%v: %v", errInvalidArtifact, err)
+	}
+	if combined.SourceList != nil {
+		return loadCombinedJSON(&combined)
+	}
+	var info buildInfoJSON
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("%v: %v", errInvalidArtifact, err)
+	}
+	if info.Output == nil {
+		info.Output = new(standardJSON)
+		if err := json.Unmarshal(data, info.Output); err != nil {
+			return nil, fmt.Errorf("%v: %v", errInvalidArtifact, err)
+		}
+	}
+	if info.Output.Sources == nil {
+		return nil, fmt.Errorf("%v: no sources", errInvalidArtifact)
+	}
+	artifact := &CompilerArtifact{Sources: make(map[int]*SourceFile)}
+	for name, source := range info.Output.Sources {
+		file := &SourceFile{ID: source.ID, Name: name}
+		if info.Input != nil {
+			if input, ok := info.Input.Sources[name]; ok {
+				file.Content = []byte(input.Content)
+			}
+		}
+		artifact.Sources[source.ID] = file
+	}
+	for file, contracts := range info.Output.Contracts {
+		for name, contract := range contracts {
+			compiled, err := newCompiledContract(file+":"+name,
+				contract.EVM.Bytecode.Object, contract.EVM.Bytecode.SourceMap,
+				contract.EVM.DeployedBytecode.Object, contract.EVM.DeployedBytecode.SourceMap)
+			if err != nil {
+				return nil, err
+			}
+			artifact.Contracts = append(artifact.Contracts, compiled)
+		}
+	}
+	artifact.sortContracts()
+	return artifact, nil
+}
+
+// loadCombinedJSON converts the combined JSON output of solc.
+func loadCombinedJSON(combined *combinedJSON) (*CompilerArtifact, error) {
+	artifact := &CompilerArtifact{Sources: make(map[int]*SourceFile)}
+	for id, name := range combined.SourceList {
+		artifact.Sources[id] = &SourceFile{ID: id, Name: name}
+	}
+	for name, contract := range combined.Contracts {
+		compiled, err := newCompiledContract(name, contract.Bin, contract.Srcmap, contract.BinRuntime, contract.SrcmapRuntime)
+		if err != nil {
+			return nil, err
+		}
+		artifact.Contracts = append(artifact.Contracts, compiled)
+	}
+	artifact.sortContracts()
+	return artifact, nil
+}
+
+// newCompiledContract decodes the hex code and source maps of a contract.
+func newCompiledContract(name, code, srcmap, runtimeCode, runtimeSrcmap string) (*CompiledContract, error) {
+	var (
+		contract = &CompiledContract{Name: name}
+		err      error
+	)
+	if contract.SourceMap, err = ParseSourceMap(srcmap); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if contract.RuntimeSrcMap, err = ParseSourceMap(runtimeSrcmap); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	contract.Code = decodeCompiledCode(code)
+	contract.RuntimeCode = decodeCompiledCode(runtimeCode)
+	return contract, nil
+}
+
+// decodeCompiledCode decodes hex code, or returns nil for unlinked code,
+// which contains library placeholders.
+func decodeCompiledCode(code string) []byte {
+	decoded, err := hex.DecodeString(strings.TrimPrefix(code, "0x"))
+	if err != nil || len(decoded) == 0 {
+		return nil
+	}
+	return decoded
+}
+
+// sortContracts orders the contracts by name, for deterministic matching.
+func (a *CompilerArtifact) sortContracts() {
+	sort.Slice(a.Contracts, func(i, j int) bool { return a.Contracts[i].Name < a.Contracts[j].Name })
+}
+
+// LoadSources reads the content of the source files missing from the
+// artifact, resolving their names relative to dir.
+func (a *CompilerArtifact) LoadSources(dir string) error {
+	for _, file := range a.Sources {
+		if file.Content != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Name)))
+		if err != nil {
+			return err
+		}
+		file.Content = content
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package evm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSourceMap(t *testing.T) {
+	assert := assert.New(t)
+	entries, err := ParseSourceMap("1:2:1;:9;2:1:2:i;;-1:0:-1:o:1")
+	assert.Nil(err)
+	assert.Equal([]SourceMapEntry{
+		{Offset: 1, Length: 2, File: 1, Jump: '-'},
+		{Offset: 1, Length: 9, File: 1, Jump: '-'},
+		{Offset: 2, Length: 1, File: 2, Jump: 'i'},
+		{Offset: 2, Length: 1, File: 2, Jump: 'i'},
+		{Offset: -1, Length: 0, File: -1, Jump: 'o', ModifierDepth: 1},
+	}, entries)
+
+	entries, err = ParseSourceMap("")
+	assert.Nil(err)
+	assert.Nil(entries)
+
+	_, err = ParseSourceMap("1:2:x")
+	assert.NotNil(err)
+	_, err = ParseSourceMap("1:2:1:j")
+	assert.NotNil(err)
+	_, err = ParseSourceMap("1:2:1:i:0:5")
+	assert.NotNil(err)
+}
+
+func TestInstructionPcs(t *testing.T) {
+	code := []byte{byte(PUSH1), 1, byte(PUSH2), 2, 3, byte(ADD), byte(PUSH32)}
+	assert.Equal(t, []uint64{0, 2, 5, 6}, instructionPcs(code))
+}
+
+func TestLoadCompilerArtifact(t *testing.T) {
+	assert := assert.New(t)
+	combined := `{
+		"contracts": {"c.sol:C": {"bin": "6001", "bin-runtime": "00", "srcmap": "0:1:0", "srcmap-runtime": "2:1:0"}},
+		"sourceList": ["c.sol"]
+	}`
+	artifact, err := LoadCompilerArtifact([]byte(combined))
+	assert.Nil(err)
+	assert.Equal("c.sol", artifact.Sources[0].Name)
+	assert.Nil(artifact.Sources[0].Content)
+	assert.Equal(1, len(artifact.Contracts))
+	assert.Equal("c.sol:C", artifact.Contracts[0].Name)
+	assert.Equal([]byte{0x60, 0x01}, artifact.Contracts[0].Code)
+	assert.Equal([]byte{0x00}, artifact.Contracts[0].RuntimeCode)
+	assert.Equal(2, artifact.Contracts[0].RuntimeSrcMap[0].Offset)
+
+	buildInfo := `{
+		"input": {"sources": {"c.sol": {"content": "contract C {}"}}},
+		"output": {
+			"sources": {"c.sol": {"id": 3}},
+			"contracts": {"c.sol": {"C": {"evm": {
+				"bytecode": {"object": "6001", "sourceMap": "0:1:3"},
+				"deployedBytecode": {"object": "__$0123$__", "sourceMap": ""}
+			}}}}
+		}
+	}`
+	artifact, err = LoadCompilerArtifact([]byte(buildInfo))
+	assert.Nil(err)
+	assert.Equal([]byte("contract C {}"), artifact.Sources[3].Content)
+	assert.Equal("c.sol:C", artifact.Contracts[0].Name)
+	assert.Equal([]byte{0x60, 0x01}, artifact.Contracts[0].Code)
+	assert.Nil(artifact.Contracts[0].RuntimeCode)
+
+	_, err = LoadCompilerArtifact([]byte(`{"contracts": {}}`))
+	assert.NotNil(err)
+	_, err = LoadCompilerArtifact([]byte(`[]`))
+	assert.NotNil(err)
+}
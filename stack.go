@@ -69,6 +69,26 @@ func (st *Stack) peek() *big.Int {
 	return st.data[st.len()-1]
 }
 
+// Push pushes a value onto the stack. The stack takes ownership of the value.
+func (st *Stack) Push(d *big.Int) {
+	st.push(d)
+}
+
+// Pop removes and returns the top of the stack.
+func (st *Stack) Pop() *big.Int {
+	return st.pop()
+}
+
+// Peek returns the top of the stack without removing it.
+func (st *Stack) Peek() *big.Int {
+	return st.peek()
+}
+
+// Len returns the number of items on the stack.
+func (st *Stack) Len() int {
+	return st.len()
+}
+
 // Back returns the n'th item in stack
 func (st *Stack) Back(n int) *big.Int {
 	return st.data[st.len()-n-1]
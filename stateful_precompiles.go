@@ -0,0 +1,138 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+)
+
+var errTooManyTopics = errors.New("too many log topics")
+
+// StatefulPrecompiledContract is a PrecompiledContract with access to the
+// context of its call. It is registered like any precompiled contract, see
+// PrecompileRegistry.Register, and RunStateful is executed instead of Run when it is
+// called by the EVM.
+//
+// RequiredGas is charged before RunStateful, which can charge further gas
+// through the context. The state changes are made under the snapshot of the
+// call and reverted if RunStateful fails.
+type StatefulPrecompiledContract interface {
+	PrecompiledContract
+	RunStateful(ctx *PrecompileContext, input []byte) ([]byte, error)
+}
+
+// PrecompileContext is the context of a call to a stateful precompiled
+// contract. The storage and logs belong to the address of the call, which
+// is the caller's one for DELEGATECALL and CALLCODE.
+type PrecompileContext struct {
+	evm      *EVM
+	contract *Contract
+	readOnly bool
+}
+
+// EVM returns the executing EVM, providing the block context.
+func (c *PrecompileContext) EVM() *EVM { return c.evm }
+
+// Caller returns the address of the caller.
+func (c *PrecompileContext) Caller() types.Address { return c.contract.Caller() }
+
+// Address returns the address of the call.
+func (c *PrecompileContext) Address() types.Address { return c.contract.Address() }
+
+// Value returns the value transferred by the call.
+func (c *PrecompileContext) Value() *big.Int { return c.contract.Value() }
+
+// ReadOnly tells whether state modifications are forbidden, in STATICCALLs.
+func (c *PrecompileContext) ReadOnly() bool { return c.readOnly }
+
+// Gas returns the gas left.
+func (c *PrecompileContext) Gas() uint64 { return c.contract.Gas }
+
+// UseGas charges gas, failing with ErrOutOfGas if not enough is left.
+func (c *PrecompileContext) UseGas(gas uint64) error {
+	if !c.contract.UseGas(gas) {
+		return ErrOutOfGas
+	}
+	return nil
+}
+
+// Revert returns the error reverting the state changes of the call without
+// consuming the gas left. The result returned along with it is the revert
+// data.
+func (c *PrecompileContext) Revert() error { return errExecutionReverted }
+
+// GetState returns the value of a storage slot, charged like SLOAD.
+func (c *PrecompileContext) GetState(key types.Hash) (types.Hash, error) {
+	if err := c.UseGas(c.evm.ChainConfig().GasTable(c.evm.BlockNumber).SLoad); err != nil {
+		return types.Hash{}, err
+	}
+	return c.evm.StateDB.GetHashTypeState(c.Address(), key), nil
+}
+
+// SetState writes a storage slot, charged by the legacy SSTORE rules.
+func (c *PrecompileContext) SetState(key, value types.Hash) error {
+	if c.readOnly {
+		return errWriteProtection
+	}
+	var (
+		current = c.evm.StateDB.GetHashTypeState(c.Address(), key)
+		cost    uint64
+		refund  uint64
+	)
+	switch {
+	case current == (types.Hash{}) && value != (types.Hash{}):
+		cost = params.SstoreSetGas
+	case current != (types.Hash{}) && value == (types.Hash{}):
+		cost, refund = params.SstoreClearGas, params.SstoreRefundGas
+	default:
+		cost = params.SstoreResetGas
+	}
+	if err := c.UseGas(cost); err != nil {
+		return err
+	}
+	if refund != 0 {
+		c.evm.StateDB.AddRefund(refund)
+	}
+	c.evm.StateDB.SetHashTypeState(c.Address(), key, value)
+	return nil
+}
+
+// AddLog emits a log, charged like LOG0 to LOG4.
+func (c *PrecompileContext) AddLog(topics []types.Hash, data []byte) error {
+	if c.readOnly {
+		return errWriteProtection
+	}
+	if len(topics) > 4 {
+		return errTooManyTopics
+	}
+	if err := c.UseGas(params.LogGas + uint64(len(topics))*params.LogTopicGas + uint64(len(data))*params.LogDataGas); err != nil {
+		return err
+	}
+	c.evm.StateDB.AddLog(&types.Log{
+		Address:     c.Address(),
+		Topics:      append([]types.Hash{}, topics...),
+		Data:        append([]byte{}, data...),
+		BlockNumber: c.evm.BlockNumber.Uint64(),
+	})
+	return nil
+}
+
+// runPrecompiledContract runs a precompiled contract called by the EVM,
+// providing stateful ones with the context of the call.
+func runPrecompiledContract(evm *EVM, p PrecompiledContract, input []byte, contract *Contract, readOnly bool) ([]byte, error) {
+	sp, ok := p.(StatefulPrecompiledContract)
+	if !ok {
+		return RunPrecompiledContract(p, input, contract)
+	}
+	if !contract.UseGas(sp.RequiredGas(input)) {
+		return nil, ErrOutOfGas
+	}
+	ctx := &PrecompileContext{
+		evm:      evm,
+		contract: contract,
+		readOnly: readOnly,
+	}
+	return sp.RunStateful(ctx, input)
+}
@@ -0,0 +1,142 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// counterPrecompile increments slot 0 by the call value plus one, logs the
+// caller and returns the new count. It reverts on the input 0xff.
+type counterPrecompile struct{}
+
+func (c *counterPrecompile) RequiredGas(input []byte) uint64 { return 100 }
+
+func (c *counterPrecompile) Run(input []byte) ([]byte, error) { return nil, nil }
+
+func (c *counterPrecompile) RunStateful(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	count, err := ctx.GetState(types.Hash{})
+	if err != nil {
+		return nil, err
+	}
+	next := new(big.Int).SetBytes(count[:])
+	next.Add(next, ctx.Value()).Add(next, big.NewInt(1))
+	if err := ctx.SetState(types.Hash{}, util.BigToHash(next)); err != nil {
+		return nil, err
+	}
+	caller := ctx.Caller()
+	if err := ctx.AddLog([]types.Hash{util.BytesToHash(caller[:])}, nil); err != nil {
+		return nil, err
+	}
+	if len(input) == 1 && input[0] == 0xff {
+		return []byte("nope"), ctx.Revert()
+	}
+	return util.HashToBytes(util.BigToHash(next)), nil
+}
+
+// nestingInterpreter runs code starting with 0xfe by calling the address
+// following it, forwarding the input and all the gas.
+type nestingInterpreter struct {
+	evm *EVM
+}
+
+func (in *nestingInterpreter) Run(contract *Contract, input []byte, static bool) ([]byte, error) {
+	ret, left, err := in.evm.Call(contract, util.BytesToAddress(contract.Code[1:]), input, contract.Gas, new(big.Int))
+	contract.Gas = left
+	return ret, err
+}
+
+func (in *nestingInterpreter) CanRun(code []byte) bool {
+	return len(code) > 0 && code[0] == 0xfe
+}
+
+func init() {
+	RegisterInterpreter("nesting", func(evm *EVM, cfg Config, options []string) (Interpreter, error) {
+		return &nestingInterpreter{evm: evm}, nil
+	})
+}
+
+// callPrecompile returns the code calling addr by op, with the CALL value
+// value, and returning the success flag.
+func callPrecompile(op OpCode, addr types.Address, value byte) []byte {
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0}
+	if op == CALL {
+		code = append(code, byte(PUSH1), value)
+	}
+	code = append(code, byte(PUSH20))
+	code = append(code, addr[:]...)
+	return append(code, byte(PUSH2), 0xff, 0xff, byte(op),
+		byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN))
+}
+
+func TestStatefulPrecompile(t *testing.T) {
+	assert := assert.New(t)
+	registry := NewPrecompileRegistry()
+	counterAddr := util.BytesToAddress([]byte{1, 1})
+	registry.Register(counterAddr, &counterPrecompile{}, 0)
+	bc := mockPreBlockChain()
+	newEnv := func() *EVM {
+		return NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{Precompiles: registry})
+	}
+	count := func() *big.Int {
+		value := bc.GetHashTypeState(counterAddr, types.Hash{})
+		return new(big.Int).SetBytes(value[:])
+	}
+
+	ret, left, err := newEnv().Call(AccountRef(callerAddress), counterAddr, nil, 100000, big.NewInt(2))
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(util.BigToHash(big.NewInt(3))), ret)
+	assert.Equal(uint64(100000-100-params.GasTableEIP158.SLoad-params.SstoreSetGas-params.LogGas-params.LogTopicGas), left)
+	assert.Equal(big.NewInt(3), count())
+	assert.Equal(big.NewInt(2), bc.GetBalance(counterAddr))
+	logs := bc.GetLogs(types.Hash{})
+	assert.Len(logs, 1)
+	assert.Equal(counterAddr, logs[0].Address)
+	assert.Equal(util.BytesToHash(callerAddress[:]), logs[0].Topics[0])
+
+	// Reverting keeps the gas left and undoes the changes.
+	ret, left, err = newEnv().Call(AccountRef(callerAddress), counterAddr, []byte{0xff}, 100000, big.NewInt(1))
+	assert.Equal(errExecutionReverted, err)
+	assert.Equal([]byte("nope"), ret)
+	assert.Equal(uint64(100000-100-params.GasTableEIP158.SLoad-params.SstoreResetGas-params.LogGas-params.LogTopicGas), left)
+	assert.Equal(big.NewInt(3), count())
+	assert.Equal(big.NewInt(2), bc.GetBalance(counterAddr))
+
+	// Failures consume all the gas.
+	_, left, err = newEnv().Call(AccountRef(callerAddress), counterAddr, nil, 5000, new(big.Int))
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(uint64(0), left)
+
+	// Writes fail in static calls, also in nested ones.
+	bc.SetCode(contractAddress, callPrecompile(STATICCALL, counterAddr, 0))
+	ret, _, err = newEnv().Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(types.Hash{}), ret)
+	_, _, err = newEnv().StaticCall(AccountRef(callerAddress), counterAddr, nil, 100000)
+	assert.Equal(errWriteProtection, err)
+
+	bc.SetCode(contractAddress, callPrecompile(CALL, counterAddr, 0))
+	ret, _, err = newEnv().StaticCall(AccountRef(callerAddress), contractAddress, nil, 1000000)
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(types.Hash{}), ret)
+	assert.Equal(big.NewInt(3), count())
+
+	ret, _, err = newEnv().Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(util.HashToBytes(util.BigToHash(big.NewInt(1))), ret)
+	assert.Equal(big.NewInt(4), count())
+
+	// Static calls apply to nested calls of any interpreter.
+	bc.SetCode(contractAddress, append([]byte{0xfe}, counterAddr[:]...))
+	env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{EVMInterpreter: "nesting", Precompiles: registry})
+	_, _, err = env.StaticCall(AccountRef(callerAddress), contractAddress, nil, 1000000)
+	assert.Equal(errWriteProtection, err)
+	assert.Equal(big.NewInt(4), count())
+	_, _, err = env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+	assert.Nil(err)
+	assert.Equal(big.NewInt(5), count())
+}
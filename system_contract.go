@@ -1,7 +1,15 @@
 package evm
 
 import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/math"
+	"github.com/DSiSc/evm-NG/params"
 	"github.com/DSiSc/evm-NG/system/contract/buffer"
 	"github.com/DSiSc/evm-NG/system/contract/rpc"
 	"github.com/DSiSc/evm-NG/system/contract/storage"
@@ -10,33 +18,307 @@ import (
 // SysContractExecutionFunc system contract execute function
 type SysContractExecutionFunc func(interpreter *EVM, contract ContractRef, input []byte) ([]byte, error)
 
-// system call routes
-var routes = make(map[types.Address]SysContractExecutionFunc)
+// SystemContract describes a system contract, a native contract called at an
+// address of the chains it is enabled on, from the block at height Activation
+// on until the one at height Deactivation.
+//
+// A call is charged the gas returned by RequiredGas for its input, plus
+// params.SystemContractInputByteGas per input byte, before execution and
+// params.SystemContractOutputWordGas per output word after it. Calls
+// transferring value fail unless the contract is payable, the value being
+// then transferred to its address. Calls from a static context fail.
+type SystemContract struct {
+	Name        string
+	ABI         string // JSON ABI of the contract
+	Address     types.Address
+	Exec        SysContractExecutionFunc
+	RequiredGas func(input []byte) uint64
+	Payable     bool
 
-func init() {
-	routes[buffer.SystemBufferAddr] = func(execEvm *EVM, contract ContractRef, input []byte) ([]byte, error) {
-		systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB)
-		return buffer.BufferExecute(systemBuffer, input)
+	Activation   uint64
+	Deactivation uint64     // 0 = never deactivated
+	ChainIDs     []*big.Int // nil = enabled on all chains
+}
+
+// activeAt returns whether the contract is active in the block at height
+// number of the chain with the given ID.
+func (c *SystemContract) activeAt(chainID, number *big.Int) bool {
+	if number == nil || number.Cmp(new(big.Int).SetUint64(c.Activation)) < 0 {
+		return false
+	}
+	if c.Deactivation != 0 && number.Cmp(new(big.Int).SetUint64(c.Deactivation)) >= 0 {
+		return false
+	}
+	if len(c.ChainIDs) == 0 {
+		return true
+	}
+	for _, id := range c.ChainIDs {
+		if chainID != nil && id.Cmp(chainID) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps returns whether both contracts may be active in the same block.
+func (c *SystemContract) overlaps(other *SystemContract) bool {
+	if c.Deactivation != 0 && c.Deactivation <= other.Activation ||
+		other.Deactivation != 0 && other.Deactivation <= c.Activation {
+		return false
+	}
+	if len(c.ChainIDs) == 0 || len(other.ChainIDs) == 0 {
+		return true
+	}
+	for _, id := range c.ChainIDs {
+		for _, otherID := range other.ChainIDs {
+			if id.Cmp(otherID) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SystemContractRegistry holds the system contracts by address, an address
+// having several versions active at different heights or on different chains.
+// It is safe for concurrent use.
+type SystemContractRegistry struct {
+	lock      sync.RWMutex
+	contracts map[types.Address][]*SystemContract
+}
+
+// NewSystemContractRegistry returns an empty registry.
+func NewSystemContractRegistry() *SystemContractRegistry {
+	return &SystemContractRegistry{contracts: make(map[types.Address][]*SystemContract)}
+}
+
+// DefaultSystemContracts is the registry used by the EVMs whose Config has
+// none.
+var DefaultSystemContracts = NewSystemContractRegistry()
+
+// Register adds a version of a system contract. It panics if the contract
+// has no execution or gas function, if it is deactivated before its activation or
+// if it may be active in a block together with another version at its
+// address.
+//
+// Registrations are taken into account by the EVMs created afterwards.
+func (r *SystemContractRegistry) Register(contract SystemContract) {
+	if contract.Exec == nil {
+		panic(fmt.Sprintf("nil execution function for system contract %q at %x", contract.Name, contract.Address))
+	}
+	if contract.RequiredGas == nil {
+		panic(fmt.Sprintf("nil gas function for system contract %q at %x", contract.Name, contract.Address))
+	}
+	if contract.Deactivation != 0 && contract.Deactivation <= contract.Activation {
+		panic(fmt.Sprintf("system contract %q at %x deactivated at %d before its activation at %d",
+			contract.Name, contract.Address, contract.Deactivation, contract.Activation))
+	}
+	contract.ChainIDs = append([]*big.Int(nil), contract.ChainIDs...)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	versions := r.contracts[contract.Address]
+	for _, version := range versions {
+		if version.overlaps(&contract) {
+			panic(fmt.Sprintf("system contract %q at %x overlaps %q", contract.Name, contract.Address, version.Name))
+		}
+	}
+	versions = append(versions, &contract)
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Activation < versions[j].Activation
+	})
+	r.contracts[contract.Address] = versions
+}
+
+// Disable deactivates the versions of the system contract at an address from
+// the block at height on.
+func (r *SystemContractRegistry) Disable(addr types.Address, height uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var versions []*SystemContract
+	for _, version := range r.contracts[addr] {
+		if version.Activation >= height {
+			continue
+		}
+		if version.Deactivation == 0 || version.Deactivation > height {
+			// Replace the version, the EVMs already created still use it
+			disabled := *version
+			disabled.Deactivation = height
+			version = &disabled
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		delete(r.contracts, addr)
+		return
+	}
+	r.contracts[addr] = versions
+}
+
+// Unregister removes all the versions of the system contract at an address.
+func (r *SystemContractRegistry) Unregister(addr types.Address) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.contracts, addr)
+}
+
+// Contracts returns the registered versions of the system contracts, by
+// address and activation. They must not be modified.
+func (r *SystemContractRegistry) Contracts() []*SystemContract {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var contracts []*SystemContract
+	for _, versions := range r.contracts {
+		contracts = append(contracts, versions...)
 	}
+	sort.Slice(contracts, func(i, j int) bool {
+		if c := bytes.Compare(contracts[i].Address[:], contracts[j].Address[:]); c != 0 {
+			return c < 0
+		}
+		return contracts[i].Activation < contracts[j].Activation
+	})
+	return contracts
+}
+
+// Active returns the system contracts active in the block at height number
+// of the chain with the given ID. They must not be modified.
+func (r *SystemContractRegistry) Active(chainID, number *big.Int) map[types.Address]*SystemContract {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 
-	routes[storage.TencentCosAddr] = func(execEvm *EVM, caller ContractRef, input []byte) ([]byte, error) {
-		systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB)
-		systemBufferReadWriter := buffer.NewSystemBufferReadWriterCloser(systemBuffer)
-		tencentCos := storage.NewTencentCosContract(systemBufferReadWriter)
-		return storage.CosExecute(tencentCos, input)
+	active := make(map[types.Address]*SystemContract)
+	for addr, versions := range r.contracts {
+		if version := activeVersion(versions, chainID, number); version != nil {
+			active[addr] = version
+		}
 	}
+	return active
+}
+
+// Get returns the system contract at an address active in the block at
+// height number of the chain with the given ID, nil if there is none.
+func (r *SystemContractRegistry) Get(chainID, number *big.Int, addr types.Address) *SystemContract {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return activeVersion(r.contracts[addr], chainID, number)
+}
 
-	routes[rpc.RpcContractAddr] = func(execEvm *EVM, caller ContractRef, input []byte) ([]byte, error) {
-		return rpc.Handler(input)
+func activeVersion(versions []*SystemContract, chainID, number *big.Int) *SystemContract {
+	for _, version := range versions {
+		if version.activeAt(chainID, number) {
+			return version
+		}
 	}
+	return nil
 }
 
-//IsSystemContract check the contract with specified address is system contract
-func IsSystemContract(addr types.Address) bool {
-	return routes[addr] != nil
+// ABIs of the built-in system contracts.
+const (
+	systemBufferABI = `[{"type":"function","name":"Read","inputs":[{"name":"offset","type":"uint64"},{"name":"size","type":"uint64"}],"outputs":[{"name":"","type":"bytes"}]},` +
+		`{"type":"function","name":"Write","inputs":[{"name":"data","type":"bytes"}],"outputs":[{"name":"","type":"uint64"}]},` +
+		`{"type":"function","name":"Length","inputs":[],"outputs":[{"name":"","type":"uint64"}]},` +
+		`{"type":"function","name":"Close","inputs":[],"outputs":[]}]`
+	tencentCosABI = `[{"type":"function","name":"GetObject","inputs":[{"name":"rawUrl","type":"string"},{"name":"objName","type":"string"}],"outputs":[{"name":"","type":"address"}]},` +
+		`{"type":"function","name":"PutObject","inputs":[{"name":"rawUrl","type":"string"},{"name":"objName","type":"string"}],"outputs":[{"name":"eTag","type":"string"},{"name":"versionId","type":"string"},{"name":"encryptionAlg","type":"string"}]}]`
+	rpcContractABI = `[{"type":"function","name":"ForwardFunds","inputs":[{"name":"toAddr","type":"string"},{"name":"amount","type":"uint64"},{"name":"payload","type":"string"},{"name":"chainFlag","type":"string"}],"outputs":[{"name":"","type":"string"},{"name":"","type":"string"},{"name":"","type":"uint64"}]},` +
+		`{"type":"function","name":"GetTxState","inputs":[{"name":"txHash","type":"string"},{"name":"amount","type":"uint64"},{"name":"tmp","type":"string"},{"name":"chainFlag","type":"string"}],"outputs":[{"name":"","type":"uint64"}]},` +
+		`{"type":"function","name":"ReceiveFunds","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint64"},{"name":"payload","type":"string"},{"name":"srcChainId","type":"uint64"}],"outputs":[{"name":"","type":"uint64"}]}]`
+)
+
+func init() {
+	DefaultSystemContracts.Register(SystemContract{
+		Name:    "SystemBuffer",
+		ABI:     systemBufferABI,
+		Address: buffer.SystemBufferAddr,
+		Exec: func(execEvm *EVM, contract ContractRef, input []byte) ([]byte, error) {
+			systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB)
+			return buffer.BufferExecute(systemBuffer, input)
+		},
+		RequiredGas: func(input []byte) uint64 {
+			return uint64(len(input)+31)/32*params.SystemBufferPerWordGas + params.SystemBufferBaseGas
+		},
+	})
+
+	DefaultSystemContracts.Register(SystemContract{
+		Name:    "TencentCos",
+		ABI:     tencentCosABI,
+		Address: storage.TencentCosAddr,
+		Exec: func(execEvm *EVM, caller ContractRef, input []byte) ([]byte, error) {
+			systemBuffer := buffer.NewSystemBufferContract(execEvm.StateDB)
+			systemBufferReadWriter := buffer.NewSystemBufferReadWriterCloser(systemBuffer)
+			tencentCos := storage.NewTencentCosContract(systemBufferReadWriter)
+			return storage.CosExecute(tencentCos, input)
+		},
+		RequiredGas: func(input []byte) uint64 { return params.TencentCosGas },
+	})
+
+	DefaultSystemContracts.Register(SystemContract{
+		Name:    "RPC",
+		ABI:     rpcContractABI,
+		Address: rpc.RpcContractAddr,
+		Exec: func(execEvm *EVM, caller ContractRef, input []byte) ([]byte, error) {
+			return rpc.Handler(input)
+		},
+		RequiredGas: func(input []byte) uint64 { return params.RpcContractGas },
+	})
+}
+
+// IsSystemContract check the contract with specified address is a system contract
+// of the registry, DefaultSystemContracts if nil, active in the block at height
+// number of the chain. Without chain config only the contracts of all chains
+// are active.
+func IsSystemContract(registry *SystemContractRegistry, config *params.ChainConfig, number *big.Int, addr types.Address) bool {
+	return GetSystemContractExecFunc(registry, config, number, addr) != nil
+}
+
+// GetSystemContractExecFunc get the execution function of the system contract of
+// the registry, DefaultSystemContracts if nil, at an address, active in the block
+// at height number of the chain, see IsSystemContract.
+func GetSystemContractExecFunc(registry *SystemContractRegistry, config *params.ChainConfig, number *big.Int, addr types.Address) SysContractExecutionFunc {
+	if registry == nil {
+		registry = DefaultSystemContracts
+	}
+	var chainID *big.Int
+	if config != nil {
+		chainID = config.ChainID
+	}
+	if contract := registry.Get(chainID, number, addr); contract != nil {
+		return contract.Exec
+	}
+	return nil
+}
+
+// requiredGas returns the gas charged for calling the contract with the
+// input, math.MaxUint64 if it overflows.
+func (c *SystemContract) requiredGas(input []byte) uint64 {
+	inputGas, overflow := math.SafeMul(uint64(len(input)), params.SystemContractInputByteGas)
+	if overflow {
+		return math.MaxUint64
+	}
+	gas, overflow := math.SafeAdd(c.RequiredGas(input), inputGas)
+	if overflow {
+		return math.MaxUint64
+	}
+	return gas
+}
+
+// outputGas returns the gas charged for the output of a call, math.MaxUint64
+// if it overflows.
+func outputGas(output []byte) uint64 {
+	gas, overflow := math.SafeMul(toWordSize(uint64(len(output))), params.SystemContractOutputWordGas)
+	if overflow {
+		return math.MaxUint64
+	}
+	return gas
 }
 
-// GetSystemContractExecFunc get system contract execution function by address
-func GetSystemContractExecFunc(addr types.Address) SysContractExecutionFunc {
-	return routes[addr]
+// SystemContract returns the system contract active at an address.
+func (evm *EVM) SystemContract(addr types.Address) (*SystemContract, bool) {
+	contract, ok := evm.systemContracts[addr]
+	return contract, ok
 }
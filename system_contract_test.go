@@ -0,0 +1,255 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/system/contract/buffer"
+	"github.com/DSiSc/evm-NG/system/contract/rpc"
+	"github.com/DSiSc/evm-NG/system/contract/storage"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoSystemContract returns a system contract execution function returning
+// its input prefixed by version.
+func echoSystemContract(version byte) SysContractExecutionFunc {
+	return func(evm *EVM, caller ContractRef, input []byte) ([]byte, error) {
+		return append([]byte{version}, input...), nil
+	}
+}
+
+// echoSystemContractGas is the gas function of the echo system contracts.
+func echoSystemContractGas(input []byte) uint64 { return 10 }
+
+func TestSystemContractRegistry(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		registry = NewSystemContractRegistry()
+		addr     = util.HexToAddress("0x0000000000000000000000000000000000012000")
+		other    = util.HexToAddress("0x0000000000000000000000000000000000012001")
+		chain1   = big.NewInt(1)
+		chain2   = big.NewInt(2)
+	)
+	registry.Register(SystemContract{Name: "v1", Address: addr, Exec: echoSystemContract(1), RequiredGas: echoSystemContractGas, Activation: 10, Deactivation: 20})
+	registry.Register(SystemContract{Name: "v2", Address: addr, Exec: echoSystemContract(2), RequiredGas: echoSystemContractGas, Activation: 20, ChainIDs: []*big.Int{chain1}})
+	registry.Register(SystemContract{Name: "v2b", Address: addr, Exec: echoSystemContract(3), RequiredGas: echoSystemContractGas, Activation: 30, ChainIDs: []*big.Int{chain2}})
+	registry.Register(SystemContract{Name: "other", Address: other, Exec: echoSystemContract(4), RequiredGas: echoSystemContractGas})
+
+	name := func(chainID *big.Int, number int64) string {
+		if contract := registry.Get(chainID, big.NewInt(number), addr); contract != nil {
+			return contract.Name
+		}
+		return ""
+	}
+	assert.Equal("", name(chain1, 9))
+	assert.Equal("v1", name(chain1, 10))
+	assert.Equal("v1", name(chain2, 19))
+	assert.Equal("v2", name(chain1, 20))
+	assert.Equal("", name(chain2, 20))
+	assert.Equal("v2b", name(chain2, 30))
+	assert.Equal("", name(nil, 30))
+	assert.Len(registry.Active(chain2, big.NewInt(25)), 1)
+	assert.Len(registry.Active(chain1, big.NewInt(25)), 2)
+	assert.Nil(registry.Get(chain1, nil, other))
+
+	contracts := registry.Contracts()
+	assert.Len(contracts, 4)
+	for i, name := range []string{"v1", "v2", "v2b", "other"} {
+		assert.Equal(name, contracts[i].Name)
+	}
+
+	// Versions may not overlap on a chain, and must have a valid range.
+	assert.Panics(func() {
+		registry.Register(SystemContract{Name: "v3", Address: addr, Exec: echoSystemContract(5), RequiredGas: echoSystemContractGas, Activation: 15, Deactivation: 21})
+	})
+	assert.Panics(func() {
+		registry.Register(SystemContract{Name: "v3", Address: addr, Exec: echoSystemContract(5), RequiredGas: echoSystemContractGas, Activation: 40, ChainIDs: []*big.Int{chain1}})
+	})
+	assert.Panics(func() {
+		registry.Register(SystemContract{Name: "v3", Address: other, Exec: echoSystemContract(5), RequiredGas: echoSystemContractGas, Activation: 5, Deactivation: 5})
+	})
+	assert.Panics(func() {
+		registry.Register(SystemContract{Name: "v3", Address: other, RequiredGas: echoSystemContractGas})
+	})
+	assert.Panics(func() { registry.Register(SystemContract{Name: "v3", Address: other, Exec: echoSystemContract(5)}) })
+
+	// Disabling keeps the earlier versions.
+	active := registry.Active(chain1, big.NewInt(25))
+	registry.Disable(addr, 25)
+	assert.Equal("v2", name(chain1, 24))
+	assert.Equal("", name(chain1, 25))
+	assert.Equal("", name(chain2, 30))
+	assert.Equal("v2", active[addr].Name)
+	assert.Equal(uint64(0), active[addr].Deactivation)
+	assert.Len(registry.Contracts(), 3)
+	registry.Disable(other, 0)
+	registry.Unregister(addr)
+	assert.Len(registry.Contracts(), 0)
+}
+
+func TestSystemContractCall(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		registry = NewSystemContractRegistry()
+		addr     = util.HexToAddress("0x0000000000000000000000000000000000012000")
+		bc       = mockPreBlockChain()
+	)
+	registry.Register(SystemContract{Name: "v1", Address: addr, Exec: echoSystemContract(1), RequiredGas: echoSystemContractGas, Activation: 10, Deactivation: 20})
+	registry.Register(SystemContract{Name: "v2", Address: addr, Exec: echoSystemContract(2), RequiredGas: echoSystemContractGas, Activation: 20})
+
+	// Call the system contract with the byte 0xaa, return the result and
+	// the code size at its address.
+	code := []byte{byte(PUSH1), 0xaa, byte(PUSH1), 0, byte(MSTORE8),
+		byte(PUSH1), 2, byte(PUSH1), 32, byte(PUSH1), 1, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, addr[:]...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(POP),
+		byte(PUSH20))
+	code = append(code, addr[:]...)
+	code = append(code, byte(EXTCODESIZE), byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 34, byte(PUSH1), 0, byte(RETURN))
+	bc.SetCode(contractAddress, code)
+
+	call := func(number int64) []byte {
+		ctx := mockEVM(bc).Context
+		ctx.BlockNumber = big.NewInt(number)
+		env := NewEVMWithConfig(ctx, bc, params.TestChainConfig, Config{SystemContracts: registry})
+		ret, _, err := env.Call(AccountRef(callerAddress), contractAddress, nil, 1000000, new(big.Int))
+		assert.Nil(err)
+		return ret
+	}
+	assert.Equal(append(make([]byte, 32), 0, 0), call(9))
+	assert.Equal(append(util.HashToBytes(util.BigToHash(big.NewInt(1))), 1, 0xaa), call(10))
+	assert.Equal(append(util.HashToBytes(util.BigToHash(big.NewInt(1))), 2, 0xaa), call(20))
+
+	ctx := mockEVM(bc).Context
+	ctx.BlockNumber = big.NewInt(10)
+	env := NewEVMWithConfig(ctx, bc, params.TestChainConfig, Config{SystemContracts: registry})
+	contract, ok := env.SystemContract(addr)
+	assert.True(ok)
+	assert.Equal("v1", contract.Name)
+
+	// The registry is resolved like by the EVMs.
+	assert.True(IsSystemContract(registry, params.TestChainConfig, big.NewInt(20), addr))
+	assert.False(IsSystemContract(registry, params.TestChainConfig, big.NewInt(9), addr))
+	assert.False(IsSystemContract(nil, params.TestChainConfig, big.NewInt(20), addr))
+
+	// Without chain config only the contracts of all chains are active.
+	assert.True(IsSystemContract(registry, nil, big.NewInt(20), addr))
+	local := util.BytesToAddress([]byte{0x0f, 0xf1})
+	registry.Register(SystemContract{Name: "local", Address: local, Exec: echoSystemContract(3), RequiredGas: echoSystemContractGas, ChainIDs: []*big.Int{big.NewInt(1)}})
+	assert.True(IsSystemContract(registry, params.TestChainConfig, big.NewInt(20), local))
+	assert.False(IsSystemContract(registry, nil, big.NewInt(20), local))
+	assert.Nil(GetSystemContractExecFunc(registry, nil, big.NewInt(20), local))
+	ret, err := GetSystemContractExecFunc(registry, params.TestChainConfig, big.NewInt(20), addr)(env, AccountRef(callerAddress), []byte{0xaa})
+	assert.Nil(err)
+	assert.Equal([]byte{2, 0xaa}, ret)
+}
+
+func TestSystemContractGasAndValue(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		registry = NewSystemContractRegistry()
+		echo     = util.HexToAddress("0x0000000000000000000000000000000000012000")
+		vault    = util.HexToAddress("0x0000000000000000000000000000000000012001")
+		failing  = util.HexToAddress("0x0000000000000000000000000000000000012002")
+		bc       = mockPreBlockChain()
+		caller   = AccountRef(callerAddress)
+	)
+	registry.Register(SystemContract{Name: "echo", Address: echo, Exec: echoSystemContract(1), RequiredGas: echoSystemContractGas})
+	registry.Register(SystemContract{Name: "vault", Address: vault, Exec: echoSystemContract(2), RequiredGas: echoSystemContractGas, Payable: true})
+	registry.Register(SystemContract{
+		Name:    "failing",
+		Address: failing,
+		Exec: func(evm *EVM, caller ContractRef, input []byte) ([]byte, error) {
+			evm.StateDB.AddBalance(contractAddress, big.NewInt(7))
+			if len(input) > 0 {
+				return []byte("nope"), errExecutionReverted
+			}
+			return nil, ErrInsufficientBalance
+		},
+		RequiredGas: echoSystemContractGas,
+	})
+	env := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{SystemContracts: registry})
+	input := []byte{0xaa, 0xbb}
+	requiredGas := 10 + 2*params.SystemContractInputByteGas
+	outputGas := params.SystemContractOutputWordGas
+
+	ret, left, err := sysContractCall(env, caller, echo, input, 1000, new(big.Int), false)
+	assert.Nil(err)
+	assert.Equal([]byte{1, 0xaa, 0xbb}, ret)
+	assert.Equal(1000-requiredGas-outputGas, left)
+
+	// The output is charged after the execution.
+	ret, left, err = sysContractCall(env, caller, echo, input, requiredGas+outputGas-1, new(big.Int), false)
+	assert.Equal(ErrOutOfGas, err)
+	assert.Nil(ret)
+	assert.Equal(uint64(0), left)
+
+	// System contracts can't be called statically or above the depth limit.
+	_, left, err = sysContractCall(env, caller, echo, input, 1000, new(big.Int), true)
+	assert.Equal(errWriteProtection, err)
+	assert.Equal(uint64(0), left)
+	env.depth = int(params.CallCreateDepth) + 1
+	_, left, err = sysContractCall(env, caller, echo, input, 1000, new(big.Int), false)
+	assert.Equal(ErrDepth, err)
+	assert.Equal(uint64(1000), left)
+	env.depth = 0
+	noRecursion := NewEVMWithConfig(mockEVM(bc).Context, bc, params.TestChainConfig, Config{SystemContracts: registry, NoRecursion: true})
+	noRecursion.depth = 1
+	ret, left, err = sysContractCall(noRecursion, caller, echo, input, 1000, new(big.Int), false)
+	assert.Nil(err)
+	assert.Nil(ret)
+	assert.Equal(uint64(1000), left)
+
+	_, left, err = sysContractCall(env, caller, echo, input, requiredGas-1, new(big.Int), false)
+	assert.Equal(ErrOutOfGas, err)
+	assert.Equal(uint64(0), left)
+
+	// Value is only transferred to payable contracts.
+	_, left, err = sysContractCall(env, caller, echo, input, 1000, big.NewInt(5), false)
+	assert.Equal(ErrSystemContractValueTransfer, err)
+	assert.Equal(uint64(1000), left)
+	assert.Equal(big.NewInt(1000), bc.GetBalance(callerAddress))
+
+	_, left, err = sysContractCall(env, caller, vault, input, 1000, big.NewInt(5), false)
+	assert.Nil(err)
+	assert.Equal(1000-requiredGas-outputGas, left)
+	assert.Equal(big.NewInt(995), bc.GetBalance(callerAddress))
+	assert.Equal(big.NewInt(5), bc.GetBalance(vault))
+
+	_, left, err = sysContractCall(env, caller, vault, input, 1000, big.NewInt(1000), false)
+	assert.Equal(ErrInsufficientBalance, err)
+	assert.Equal(uint64(1000), left)
+
+	// Failures revert the state, consuming the gas left unless reverting.
+	balance := bc.GetBalance(contractAddress)
+	_, left, err = sysContractCall(env, caller, failing, nil, 1000, new(big.Int), false)
+	assert.Equal(ErrInsufficientBalance, err)
+	assert.Equal(uint64(0), left)
+	assert.Equal(balance, bc.GetBalance(contractAddress))
+
+	ret, left, err = sysContractCall(env, caller, failing, input, 1000, new(big.Int), false)
+	assert.Equal(errExecutionReverted, err)
+	assert.Equal([]byte("nope"), ret)
+	assert.Equal(1000-requiredGas-outputGas, left)
+	assert.Equal(balance, bc.GetBalance(contractAddress))
+}
+
+func TestDefaultSystemContracts(t *testing.T) {
+	assert := assert.New(t)
+	for _, addr := range []types.Address{buffer.SystemBufferAddr, storage.TencentCosAddr, rpc.RpcContractAddr} {
+		assert.True(IsSystemContract(nil, params.TestChainConfig, big.NewInt(0), addr))
+		assert.NotNil(GetSystemContractExecFunc(nil, params.TestChainConfig, big.NewInt(0), addr))
+		assert.True(DefaultSystemContracts.Get(nil, big.NewInt(0), addr).requiredGas(nil) >= params.SystemBufferBaseGas)
+	}
+	assert.False(IsSystemContract(nil, params.TestChainConfig, big.NewInt(0), contractAddress))
+	assert.Len(DefaultSystemContracts.Contracts(), 3)
+	for _, contract := range DefaultSystemContracts.Contracts() {
+		assert.NotEmpty(contract.Name)
+		assert.NotEmpty(contract.ABI)
+		assert.False(contract.Payable)
+	}
+}
@@ -0,0 +1,157 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/common/hexutil"
+	"github.com/DSiSc/repository"
+)
+
+var errMissingApply = errors.New("trace without state transition")
+
+// Names of the tracers available to TraceTransaction and TraceBlock.
+const (
+	StructTracerName   = "structLogger"
+	CallTracerName     = "callTracer"
+	PrestateTracerName = "prestateTracer"
+	FourByteTracerName = "4byteTracer"
+)
+
+// ApplyFunc applies a transaction of a block to the repository with the
+// state transition of the node, running the EVM with the given
+// configuration, e.g. to trace it. It returns the output of the execution,
+// the gas used and whether the execution failed, or an error if the
+// transaction is invalid, leaving the repository unchanged.
+type ApplyFunc func(block *types.Block, tx *types.Transaction, repo *repository.Repository, vmConfig Config) (ret []byte, usedGas uint64, failed bool, err error)
+
+// TraceConfig are the options of TraceTransaction and TraceBlock.
+type TraceConfig struct {
+	Tracer string // name of the tracer, the struct logger by default
+
+	LogConfig      *LogConfig            // options of the struct logger
+	CallConfig     *CallTracerConfig     // options of the call tracer
+	PrestateConfig *PrestateTracerConfig // options of the prestate tracer
+
+	Apply ApplyFunc // state transition of the node, required
+}
+
+// ExecutionResult is the result of a transaction traced by the struct logger.
+type ExecutionResult struct {
+	Gas         uint64        `json:"gas"`
+	Failed      bool          `json:"failed"`
+	ReturnValue hexutil.Bytes `json:"returnValue"`
+	StructLogs  []StructLog   `json:"structLogs"`
+}
+
+// TxTraceResult is the trace of a transaction of a block, either its result
+// or the error making it invalid.
+type TxTraceResult struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// resultTracer is a Tracer encoding its result as JSON.
+type resultTracer interface {
+	Tracer
+	GetResult() (json.RawMessage, error)
+}
+
+// structTracer encodes the struct logs of a transaction with its outcome.
+type structTracer struct {
+	*StructLogger
+	gas    uint64
+	failed bool
+	ret    []byte
+}
+
+// GetResult returns the ExecutionResult as JSON.
+func (t *structTracer) GetResult() (json.RawMessage, error) {
+	logs := t.StructLogs()
+	if logs == nil {
+		logs = []StructLog{}
+	}
+	return json.Marshal(&ExecutionResult{
+		Gas:         t.gas,
+		Failed:      t.failed,
+		ReturnValue: t.ret,
+		StructLogs:  logs,
+	})
+}
+
+// newTracer returns the tracer configured by cfg.
+func newTracer(cfg *TraceConfig) (resultTracer, error) {
+	switch cfg.Tracer {
+	case "", StructTracerName:
+		return &structTracer{StructLogger: NewStructLogger(cfg.LogConfig)}, nil
+	case CallTracerName:
+		return NewCallTracer(cfg.CallConfig), nil
+	case PrestateTracerName:
+		return NewPrestateTracer(cfg.PrestateConfig), nil
+	case FourByteTracerName:
+		return NewFourByteTracer(), nil
+	}
+	return nil, fmt.Errorf("unknown tracer %q", cfg.Tracer)
+}
+
+// TraceTransaction executes the transactions of a block up to the one at
+// txIndex and returns the trace of that one, as JSON. The repository has to
+// hold the state of the parent block, the execution runs on a copy of it.
+func TraceTransaction(block *types.Block, txIndex int, repo *repository.Repository, cfg *TraceConfig) (json.RawMessage, error) {
+	if cfg == nil || cfg.Apply == nil {
+		return nil, errMissingApply
+	}
+	if txIndex < 0 || txIndex >= len(block.Transactions) {
+		return nil, fmt.Errorf("transaction index %d out of range, block has %d", txIndex, len(block.Transactions))
+	}
+	state := repo.Copy()
+	for i, tx := range block.Transactions[:txIndex] {
+		if _, _, _, err := cfg.Apply(block, tx, state, Config{}); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+	}
+	return traceTransaction(block, block.Transactions[txIndex], state, cfg)
+}
+
+// TraceBlock executes all the transactions of a block and returns their
+// traces, in order. Invalid transactions are reported in their trace and
+// don't change the state. The repository has to hold the state of the
+// parent block, the execution runs on a copy of it.
+func TraceBlock(block *types.Block, repo *repository.Repository, cfg *TraceConfig) ([]*TxTraceResult, error) {
+	if cfg == nil || cfg.Apply == nil {
+		return nil, errMissingApply
+	}
+	if _, err := newTracer(cfg); err != nil {
+		return nil, err
+	}
+	state := repo.Copy()
+	results := make([]*TxTraceResult, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		result, err := traceTransaction(block, tx, state, cfg)
+		if err != nil {
+			results[i] = &TxTraceResult{Error: err.Error()}
+		} else {
+			results[i] = &TxTraceResult{Result: result}
+		}
+	}
+	return results, nil
+}
+
+// traceTransaction executes a transaction with the tracer configured by cfg
+// and returns its result.
+func traceTransaction(block *types.Block, tx *types.Transaction, repo *repository.Repository, cfg *TraceConfig) (json.RawMessage, error) {
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ret, usedGas, failed, err := cfg.Apply(block, tx, repo, Config{Debug: true, Tracer: tracer})
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := tracer.(*structTracer); ok {
+		t.gas, t.failed, t.ret = usedGas, failed, ret
+	}
+	return tracer.GetResult()
+}
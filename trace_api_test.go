@@ -0,0 +1,108 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/evm-NG/params"
+	"github.com/DSiSc/evm-NG/util"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// traceBlock returns a chain with a counter contract, incrementing slot 0 on
+// every call, and a block calling it with the given nonces.
+func traceBlock(nonces ...uint64) (*repository.Repository, *types.Block) {
+	bc := mockPreBlockChain()
+	bc.AddBalance(callerAddress, big.NewInt(1000000))
+	bc.SetCode(contractAddress, []byte{byte(PUSH1), 0, byte(SLOAD), byte(PUSH1), 1, byte(ADD), byte(PUSH1), 0, byte(SSTORE), byte(STOP)})
+
+	block := &types.Block{Header: &types.Header{Height: 1, CoinBase: util.HexToAddress("0x000000000000000000000000000000000000000c")}}
+	for _, nonce := range nonces {
+		block.Transactions = append(block.Transactions, &types.Transaction{
+			Data: types.TxData{
+				AccountNonce: nonce,
+				Price:        big.NewInt(1),
+				GasLimit:     100000,
+				Recipient:    &contractAddress,
+				From:         &callerAddress,
+				Amount:       new(big.Int),
+			},
+		})
+	}
+	return bc, block
+}
+
+// applyTestTransaction is the state transition of a node calling contracts
+// only, for the intrinsic gas and without fees.
+func applyTestTransaction(block *types.Block, tx *types.Transaction, repo *repository.Repository, vmConfig Config) ([]byte, uint64, bool, error) {
+	from := *tx.Data.From
+	if nonce := repo.GetNonce(from); nonce != tx.Data.AccountNonce {
+		return nil, 0, false, fmt.Errorf("invalid nonce %d of %x, expected %d", tx.Data.AccountNonce, from, nonce)
+	}
+	ctx := NewEVMContext(*tx, block.Header, repo, block.Header.CoinBase)
+	env := NewEVMWithConfig(ctx, repo, params.TestChainConfig, vmConfig)
+	repo.SetNonce(from, tx.Data.AccountNonce+1)
+	ret, left, err := env.Call(AccountRef(from), *tx.Data.Recipient, tx.Data.Payload, tx.Data.GasLimit-params.TxGas, tx.Data.Amount)
+	repo.Finalise(true)
+	return ret, tx.Data.GasLimit - left, err != nil, nil
+}
+
+func TestTraceTransaction(t *testing.T) {
+	assert := assert.New(t)
+	bc, block := traceBlock(0, 1)
+	res, err := TraceTransaction(block, 1, bc, &TraceConfig{Apply: applyTestTransaction})
+	assert.Nil(err)
+	var result ExecutionResult
+	assert.Nil(json.Unmarshal(res, &result))
+	assert.False(result.Failed)
+	assert.Equal(uint64(params.TxGas+3+200+3+3+3+5000), result.Gas)
+	assert.Len(result.StructLogs, 7)
+	assert.Equal("SSTORE", result.StructLogs[5].Op.String())
+
+	// The preceding transaction is replayed on a copy of the state.
+	res, err = TraceTransaction(block, 1, bc, &TraceConfig{Tracer: PrestateTracerName, Apply: applyTestTransaction})
+	assert.Nil(err)
+	var prestate map[string]map[string]interface{}
+	assert.Nil(json.Unmarshal(res, &prestate))
+	storage := prestate["0xf74cc8824a00bcb96e8546bf3b4dc47ace9cab2c"]["storage"].(map[string]interface{})
+	assert.Equal("0x0000000000000000000000000000000000000000000000000000000000000001", storage["0x0000000000000000000000000000000000000000000000000000000000000000"])
+	assert.Equal(uint64(0), bc.GetNonce(callerAddress))
+	assert.Equal(types.Hash{}, bc.GetHashTypeState(contractAddress, util.BigToHash(new(big.Int))))
+	assert.Equal(big.NewInt(1001000), bc.GetBalance(callerAddress))
+
+	_, err = TraceTransaction(block, 2, bc, &TraceConfig{Apply: applyTestTransaction})
+	assert.NotNil(err)
+	_, err = TraceTransaction(block, 0, bc, &TraceConfig{Tracer: "unknown", Apply: applyTestTransaction})
+	assert.NotNil(err)
+	_, err = TraceTransaction(block, 1, bc, nil)
+	assert.Equal(errMissingApply, err)
+	_, err = TraceTransaction(block, 1, bc, &TraceConfig{})
+	assert.Equal(errMissingApply, err)
+}
+
+func TestTraceBlock(t *testing.T) {
+	assert := assert.New(t)
+	bc, block := traceBlock(0, 5, 1)
+	results, err := TraceBlock(block, bc, &TraceConfig{Tracer: CallTracerName, Apply: applyTestTransaction})
+	assert.Nil(err)
+	assert.Len(results, 3)
+	assert.NotNil(results[0].Result)
+	assert.Empty(results[0].Error)
+	assert.Nil(results[1].Result)
+	assert.Equal("invalid nonce 5 of 8a8c58e424f4a6d2f0b2270860c96dfe34f10c78, expected 1", results[1].Error)
+	assert.NotNil(results[2].Result)
+
+	var call map[string]interface{}
+	assert.Nil(json.Unmarshal(results[2].Result, &call))
+	assert.Equal("0xf74cc8824a00bcb96e8546bf3b4dc47ace9cab2c", call["to"])
+	assert.Equal(types.Hash{}, bc.GetHashTypeState(contractAddress, util.BigToHash(new(big.Int))))
+
+	_, err = TraceBlock(block, bc, &TraceConfig{Tracer: "unknown", Apply: applyTestTransaction})
+	assert.NotNil(err)
+	_, err = TraceBlock(block, bc, nil)
+	assert.Equal(errMissingApply, err)
+}
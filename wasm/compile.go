@@ -0,0 +1,817 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxLocals bounds the number of locals of a single function so that a tiny
+// body can't request a huge allocation per call.
+const maxLocals = 50000
+
+// unknownType is the type of values popped off a polymorphic stack in
+// unreachable code.
+const unknownType = ValueType(0)
+
+var (
+	errStackUnderflow = errors.New("wasm: operand stack underflow")
+	errTypeMismatch   = errors.New("wasm: type mismatch")
+	errNoMemory       = errors.New("wasm: memory instruction without memory")
+	errFloat          = errors.New("wasm: floating point instructions are not allowed")
+)
+
+// CostFunc returns the gas charged for executing a single instruction.
+type CostFunc func(op byte) uint64
+
+// DefaultCost is a flat cost table which charges one unit per instruction
+// and roughly reflects the relative expense of multiplications, divisions,
+// memory accesses and calls. Structural instructions are free.
+func DefaultCost(op byte) uint64 {
+	switch op {
+	case opNop, opBlock, opLoop, opElse, opEnd:
+		return 0
+	case opI32Mul, opI64Mul:
+		return 3
+	case opI32DivS, opI32DivU, opI32RemS, opI32RemU, opI64DivS, opI64DivU, opI64RemS, opI64RemU:
+		return 5
+	case opCall:
+		return 5
+	case opCallIndirect:
+		return 10
+	case opMemoryGrow:
+		return 10
+	}
+	if op >= opI32Load && op <= opI64Store32 {
+		return 3
+	}
+	return 1
+}
+
+// instr is a single instruction of a compiled function.
+type instr struct {
+	op     byte
+	imm    uint64 // constant, index, memory offset or gas amount
+	target int    // branch target
+	drop   int    // values discarded below the kept ones when branching
+	keep   int    // values carried over to the branch target
+}
+
+// branch is an entry of a compiled br_table.
+type branch struct {
+	target, drop, keep int
+}
+
+// compiledFunc is a validated function body translated into a flat
+// instruction stream with resolved branch targets.
+type compiledFunc struct {
+	sig       *FunctionSig
+	numLocals int // parameters included
+	code      []instr
+	tables    [][]branch
+	maxStack  int
+}
+
+// CompiledModule is a validated module ready to be instantiated. It is
+// immutable and may be shared by any number of VM instances.
+type CompiledModule struct {
+	Module *Module
+
+	sigs       []*FunctionSig // signatures of the whole function index space
+	funcs      []*compiledFunc
+	numImports int
+	hasMemory  bool
+	hasTable   bool
+}
+
+// Compile validates a decoded module and translates its functions. Every
+// basic block is instrumented with a gas charge computed from cost, which
+// defaults to DefaultCost.
+func Compile(m *Module, cost CostFunc) (*CompiledModule, error) {
+	if cost == nil {
+		cost = DefaultCost
+	}
+	cm := &CompiledModule{Module: m}
+
+	for _, imp := range m.Imports {
+		switch imp.Kind {
+		case ExternalFunction:
+			if int(imp.Func) >= len(m.Types) {
+				return nil, fmt.Errorf("wasm: import %s.%s has invalid type index %d", imp.Module, imp.Field, imp.Func)
+			}
+			cm.sigs = append(cm.sigs, &m.Types[imp.Func])
+			cm.numImports++
+		default:
+			return nil, fmt.Errorf("wasm: import %s.%s: only function imports are supported", imp.Module, imp.Field)
+		}
+	}
+	for _, typ := range m.Functions {
+		if int(typ) >= len(m.Types) {
+			return nil, fmt.Errorf("wasm: function has invalid type index %d", typ)
+		}
+		cm.sigs = append(cm.sigs, &m.Types[typ])
+	}
+	if len(m.Memories) > 1 || len(m.Tables) > 1 {
+		return nil, errors.New("wasm: at most one memory and one table are supported")
+	}
+	cm.hasMemory, cm.hasTable = len(m.Memories) == 1, len(m.Tables) == 1
+	if cm.hasMemory && m.Memories[0].Min > maxPages {
+		return nil, errors.New("wasm: memory size exceeds 4GiB")
+	}
+	if cm.hasTable && m.Tables[0].Min > maxTableSize {
+		return nil, fmt.Errorf("wasm: table size exceeds %d elements", maxTableSize)
+	}
+	for i, g := range m.Globals {
+		if g.Type.Type != ValueTypeI32 && g.Type.Type != ValueTypeI64 {
+			return nil, errFloat
+		}
+		if _, err := evalConstExpr(g.Init, g.Type.Type); err != nil {
+			return nil, fmt.Errorf("wasm: global %d: %v", i, err)
+		}
+	}
+	for _, exp := range m.Exports {
+		var limit int
+		switch exp.Kind {
+		case ExternalFunction:
+			limit = len(cm.sigs)
+		case ExternalTable:
+			limit = len(m.Tables)
+		case ExternalMemory:
+			limit = len(m.Memories)
+		case ExternalGlobal:
+			limit = len(m.Globals)
+		}
+		if int(exp.Index) >= limit {
+			return nil, fmt.Errorf("wasm: export %q has invalid index %d", exp.Field, exp.Index)
+		}
+	}
+	if m.Start != nil {
+		if int(*m.Start) >= len(cm.sigs) {
+			return nil, errors.New("wasm: invalid start function index")
+		}
+		if sig := cm.sigs[*m.Start]; len(sig.Params) != 0 || len(sig.Results) != 0 {
+			return nil, errors.New("wasm: start function must have an empty signature")
+		}
+	}
+	for _, seg := range m.Elements {
+		if seg.Table != 0 || !cm.hasTable {
+			return nil, errors.New("wasm: element segment refers to a missing table")
+		}
+		if _, err := evalConstExpr(seg.Offset, ValueTypeI32); err != nil {
+			return nil, err
+		}
+		for _, idx := range seg.Elems {
+			if int(idx) >= len(cm.sigs) {
+				return nil, fmt.Errorf("wasm: element segment has invalid function index %d", idx)
+			}
+		}
+	}
+	for _, seg := range m.Data {
+		if seg.Memory != 0 || !cm.hasMemory {
+			return nil, errors.New("wasm: data segment refers to a missing memory")
+		}
+		if _, err := evalConstExpr(seg.Offset, ValueTypeI32); err != nil {
+			return nil, err
+		}
+	}
+	for i, body := range m.Codes {
+		fn, err := compileFunction(cm, cm.sigs[cm.numImports+i], body, cost)
+		if err != nil {
+			return nil, fmt.Errorf("wasm: function %d: %v", cm.numImports+i, err)
+		}
+		cm.funcs = append(cm.funcs, fn)
+	}
+	return cm, nil
+}
+
+// Signature returns the signature of a function.
+func (cm *CompiledModule) Signature(fn uint32) (*FunctionSig, error) {
+	if int(fn) >= len(cm.sigs) {
+		return nil, fmt.Errorf("wasm: invalid function index %d", fn)
+	}
+	return cm.sigs[fn], nil
+}
+
+// evalConstExpr evaluates a constant initializer expression of the given type.
+func evalConstExpr(expr []byte, want ValueType) (uint64, error) {
+	r := newReader(expr)
+	op, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case op == opI32Const && want == ValueTypeI32:
+		v, err := r.readVarInt32()
+		return uint64(uint32(v)), err
+	case op == opI64Const && want == ValueTypeI64:
+		v, err := r.readVarInt64()
+		return uint64(v), err
+	case op == opGlobalGet:
+		return 0, errors.New("wasm: imported globals are not supported")
+	}
+	return 0, errTypeMismatch
+}
+
+// ctrlFrame is an entry of the control stack maintained while compiling.
+type ctrlFrame struct {
+	op          byte
+	results     []ValueType
+	height      int  // operand stack height when the frame was entered
+	unreachable bool // the rest of the frame can't be reached
+	start       int  // branch target of a loop
+	ifJump      int  // instruction to patch with the else target of an if
+	patches     []patch
+}
+
+// labelTypes returns the types a branch to the frame carries.
+func (f *ctrlFrame) labelTypes() []ValueType {
+	if f.op == opLoop {
+		return nil
+	}
+	return f.results
+}
+
+// patch is a branch whose target is only known at the end of its frame.
+type patch struct {
+	instr int // instruction index, or -1 for a br_table entry
+	table int
+	entry int
+}
+
+type compiler struct {
+	module *CompiledModule
+	fn     *compiledFunc
+	cost   CostFunc
+	locals []ValueType
+
+	stack []ValueType
+	ctrl  []ctrlFrame
+	meter int // index of the meter instruction of the current basic block
+}
+
+func compileFunction(cm *CompiledModule, sig *FunctionSig, body FunctionBody, cost CostFunc) (*compiledFunc, error) {
+	for _, t := range append(append([]ValueType{}, sig.Params...), sig.Results...) {
+		if t != ValueTypeI32 && t != ValueTypeI64 {
+			return nil, errFloat
+		}
+	}
+	c := &compiler{
+		module: cm,
+		fn:     &compiledFunc{sig: sig},
+		cost:   cost,
+		locals: append(append([]ValueType{}, sig.Params...), body.Locals...),
+	}
+	for _, t := range body.Locals {
+		if t != ValueTypeI32 && t != ValueTypeI64 {
+			return nil, errFloat
+		}
+	}
+	c.fn.numLocals = len(c.locals)
+	c.ctrl = append(c.ctrl, ctrlFrame{results: sig.Results})
+	c.startBlock()
+
+	r := newReader(body.Code)
+	for len(c.ctrl) > 0 {
+		op, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.compile(op, r); err != nil {
+			return nil, fmt.Errorf("offset %d: %v", r.pos-1, err)
+		}
+	}
+	if r.len() != 0 {
+		return nil, errors.New("wasm: trailing bytes after function end")
+	}
+	return c.fn, nil
+}
+
+// emit appends an instruction and adds its cost to the current basic block.
+func (c *compiler) emit(op byte, ins instr) int {
+	ins.op = op
+	c.fn.code = append(c.fn.code, ins)
+	return len(c.fn.code) - 1
+}
+
+// startBlock begins a new basic block by emitting its gas charge.
+func (c *compiler) startBlock() int {
+	c.meter = c.emit(opMeter, instr{})
+	return c.meter
+}
+
+func (c *compiler) push(t ValueType) {
+	c.stack = append(c.stack, t)
+	if len(c.stack) > c.fn.maxStack {
+		c.fn.maxStack = len(c.stack)
+	}
+}
+
+func (c *compiler) pop(want ValueType) (ValueType, error) {
+	frame := &c.ctrl[len(c.ctrl)-1]
+	if len(c.stack) == frame.height {
+		if frame.unreachable {
+			return unknownType, nil
+		}
+		return 0, errStackUnderflow
+	}
+	got := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	if got != want && got != unknownType && want != unknownType {
+		return 0, errTypeMismatch
+	}
+	return got, nil
+}
+
+func (c *compiler) popTypes(types []ValueType) error {
+	for i := len(types) - 1; i >= 0; i-- {
+		if _, err := c.pop(types[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) pushTypes(types []ValueType) {
+	for _, t := range types {
+		c.push(t)
+	}
+}
+
+// setUnreachable marks the rest of the current frame as dead code.
+func (c *compiler) setUnreachable() {
+	frame := &c.ctrl[len(c.ctrl)-1]
+	c.stack = c.stack[:frame.height]
+	frame.unreachable = true
+}
+
+// branchTo computes the stack adjustment of a branch to the given label
+// depth. It must be called with the label values still on the stack.
+func (c *compiler) branchTo(depth uint32) (*ctrlFrame, branch, error) {
+	if int(depth) >= len(c.ctrl) {
+		return nil, branch{}, fmt.Errorf("wasm: invalid branch depth %d", depth)
+	}
+	frame := &c.ctrl[len(c.ctrl)-1-int(depth)]
+	keep := len(frame.labelTypes())
+	drop := len(c.stack) - frame.height - keep
+	if drop < 0 {
+		// Only possible in unreachable code, where the branch never runs.
+		drop = 0
+	}
+	return frame, branch{target: frame.start, drop: drop, keep: keep}, nil
+}
+
+// addPatch records a forward branch which is resolved when frame ends.
+func addPatch(frame *ctrlFrame, p patch) {
+	if frame.op != opLoop {
+		frame.patches = append(frame.patches, p)
+	}
+}
+
+func (c *compiler) readBlockType(r *reader) ([]ValueType, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch ValueType(b) {
+	case 0x40:
+		return nil, nil
+	case ValueTypeI32, ValueTypeI64:
+		return []ValueType{ValueType(b)}, nil
+	case ValueTypeF32, ValueTypeF64:
+		return nil, errFloat
+	}
+	return nil, fmt.Errorf("wasm: unsupported block type 0x%x", b)
+}
+
+func (c *compiler) compile(op byte, r *reader) error {
+	if isFloatOp(op) {
+		return errFloat
+	}
+	c.fn.code[c.meter].imm += c.cost(op)
+
+	switch op {
+	case opUnreachable:
+		c.emit(opUnreachable, instr{})
+		c.setUnreachable()
+
+	case opNop:
+
+	case opBlock, opLoop:
+		results, err := c.readBlockType(r)
+		if err != nil {
+			return err
+		}
+		c.ctrl = append(c.ctrl, ctrlFrame{op: op, results: results, height: len(c.stack)})
+		start := c.startBlock()
+		c.ctrl[len(c.ctrl)-1].start = start
+
+	case opIf:
+		results, err := c.readBlockType(r)
+		if err != nil {
+			return err
+		}
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+		jump := c.emit(opJumpIfZ, instr{})
+		c.ctrl = append(c.ctrl, ctrlFrame{op: op, results: results, height: len(c.stack), ifJump: jump})
+		c.startBlock()
+
+	case opElse:
+		frame := &c.ctrl[len(c.ctrl)-1]
+		if frame.op != opIf {
+			return errors.New("wasm: else without if")
+		}
+		if err := c.popTypes(frame.results); err != nil {
+			return err
+		}
+		if len(c.stack) != frame.height {
+			return errTypeMismatch
+		}
+		jump := c.emit(opJump, instr{})
+		frame.patches = append(frame.patches, patch{instr: jump})
+		frame.op = opElse
+		frame.unreachable = false
+		c.fn.code[frame.ifJump].target = c.startBlock()
+		frame.ifJump = -1
+
+	case opEnd:
+		frame := &c.ctrl[len(c.ctrl)-1]
+		if err := c.popTypes(frame.results); err != nil {
+			return err
+		}
+		if len(c.stack) != frame.height {
+			return errTypeMismatch
+		}
+		if frame.op == opIf && len(frame.results) != 0 {
+			return errors.New("wasm: if without else must not produce values")
+		}
+		c.ctrl = c.ctrl[:len(c.ctrl)-1]
+		c.pushTypes(frame.results)
+		var next int
+		if len(c.ctrl) == 0 {
+			// Branches to the function body behave like return.
+			next = c.emit(opReturn, instr{})
+		} else {
+			next = c.startBlock()
+		}
+		if frame.op == opIf {
+			c.fn.code[frame.ifJump].target = next
+		}
+		for _, p := range frame.patches {
+			if p.instr >= 0 {
+				c.fn.code[p.instr].target = next
+			} else {
+				c.fn.tables[p.table][p.entry].target = next
+			}
+		}
+
+	case opBr:
+		depth, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		frame, br, err := c.branchTo(depth)
+		if err != nil {
+			return err
+		}
+		if err := c.popTypes(frame.labelTypes()); err != nil {
+			return err
+		}
+		idx := c.emit(opBr, instr{target: br.target, drop: br.drop, keep: br.keep})
+		addPatch(frame, patch{instr: idx})
+		c.setUnreachable()
+
+	case opBrIf:
+		depth, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+		frame, br, err := c.branchTo(depth)
+		if err != nil {
+			return err
+		}
+		types := frame.labelTypes()
+		if err := c.popTypes(types); err != nil {
+			return err
+		}
+		c.pushTypes(types)
+		idx := c.emit(opBrIf, instr{target: br.target, drop: br.drop, keep: br.keep})
+		addPatch(frame, patch{instr: idx})
+		c.startBlock()
+
+	case opBrTable:
+		var depths []uint32
+		err := decodeVector(r, func() error {
+			depth, err := r.readVarUint32()
+			depths = append(depths, depth)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		def, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		depths = append(depths, def)
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+		table := len(c.fn.tables)
+		c.fn.tables = append(c.fn.tables, make([]branch, len(depths)))
+
+		arity := -1
+		for i, depth := range depths {
+			frame, br, err := c.branchTo(depth)
+			if err != nil {
+				return err
+			}
+			if arity >= 0 && arity != len(frame.labelTypes()) {
+				return errors.New("wasm: br_table targets have inconsistent arity")
+			}
+			arity = len(frame.labelTypes())
+			c.fn.tables[table][i] = br
+			addPatch(frame, patch{instr: -1, table: table, entry: i})
+		}
+		frame, _, _ := c.branchTo(def)
+		if err := c.popTypes(frame.labelTypes()); err != nil {
+			return err
+		}
+		c.emit(opBrTable, instr{imm: uint64(table)})
+		c.setUnreachable()
+
+	case opReturn:
+		if err := c.popTypes(c.fn.sig.Results); err != nil {
+			return err
+		}
+		c.emit(opReturn, instr{})
+		c.setUnreachable()
+
+	case opCall:
+		idx, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		if int(idx) >= len(c.module.sigs) {
+			return fmt.Errorf("wasm: invalid function index %d", idx)
+		}
+		sig := c.module.sigs[idx]
+		if err := c.popTypes(sig.Params); err != nil {
+			return err
+		}
+		c.pushTypes(sig.Results)
+		if int(idx) < c.module.numImports {
+			c.emit(opCallHost, instr{imm: uint64(idx)})
+		} else {
+			c.emit(opCall, instr{imm: uint64(idx)})
+		}
+
+	case opCallIndirect:
+		typ, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		if reserved, err := r.readByte(); err != nil || reserved != 0 {
+			return errors.New("wasm: invalid call_indirect reserved byte")
+		}
+		if !c.module.hasTable {
+			return errors.New("wasm: call_indirect without table")
+		}
+		if int(typ) >= len(c.module.Module.Types) {
+			return fmt.Errorf("wasm: invalid type index %d", typ)
+		}
+		sig := &c.module.Module.Types[typ]
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+		if err := c.popTypes(sig.Params); err != nil {
+			return err
+		}
+		c.pushTypes(sig.Results)
+		c.emit(opCallIndirect, instr{imm: uint64(typ)})
+
+	case opDrop:
+		if _, err := c.pop(unknownType); err != nil {
+			return err
+		}
+		c.emit(opDrop, instr{})
+
+	case opSelect:
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+		t1, err := c.pop(unknownType)
+		if err != nil {
+			return err
+		}
+		t2, err := c.pop(t1)
+		if err != nil {
+			return err
+		}
+		if t1 == unknownType {
+			t1 = t2
+		}
+		c.push(t1)
+		c.emit(opSelect, instr{})
+
+	case opLocalGet, opLocalSet, opLocalTee:
+		idx, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		if int(idx) >= len(c.locals) {
+			return fmt.Errorf("wasm: invalid local index %d", idx)
+		}
+		t := c.locals[idx]
+		switch op {
+		case opLocalGet:
+			c.push(t)
+		case opLocalSet:
+			if _, err := c.pop(t); err != nil {
+				return err
+			}
+		case opLocalTee:
+			if _, err := c.pop(t); err != nil {
+				return err
+			}
+			c.push(t)
+		}
+		c.emit(op, instr{imm: uint64(idx)})
+
+	case opGlobalGet, opGlobalSet:
+		idx, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		globals := c.module.Module.Globals
+		if int(idx) >= len(globals) {
+			return fmt.Errorf("wasm: invalid global index %d", idx)
+		}
+		if op == opGlobalGet {
+			c.push(globals[idx].Type.Type)
+		} else {
+			if !globals[idx].Type.Mutable {
+				return fmt.Errorf("wasm: global %d is immutable", idx)
+			}
+			if _, err := c.pop(globals[idx].Type.Type); err != nil {
+				return err
+			}
+		}
+		c.emit(op, instr{imm: uint64(idx)})
+
+	case opMemorySize, opMemoryGrow:
+		if reserved, err := r.readByte(); err != nil || reserved != 0 {
+			return errors.New("wasm: invalid memory instruction reserved byte")
+		}
+		if !c.module.hasMemory {
+			return errNoMemory
+		}
+		if op == opMemoryGrow {
+			if _, err := c.pop(ValueTypeI32); err != nil {
+				return err
+			}
+		}
+		c.push(ValueTypeI32)
+		c.emit(op, instr{})
+
+	case opI32Const:
+		v, err := r.readVarInt32()
+		if err != nil {
+			return err
+		}
+		c.push(ValueTypeI32)
+		c.emit(op, instr{imm: uint64(uint32(v))})
+
+	case opI64Const:
+		v, err := r.readVarInt64()
+		if err != nil {
+			return err
+		}
+		c.push(ValueTypeI64)
+		c.emit(op, instr{imm: uint64(v)})
+
+	default:
+		if op >= opI32Load && op <= opI64Store32 {
+			return c.compileMemory(op, r)
+		}
+		in, out, ok := numericSig(op)
+		if !ok {
+			return fmt.Errorf("wasm: unknown opcode 0x%x", op)
+		}
+		if err := c.popTypes(in); err != nil {
+			return err
+		}
+		c.push(out)
+		c.emit(op, instr{})
+	}
+	return nil
+}
+
+// memoryAccess returns the value type and access width of a load or store.
+func memoryAccess(op byte) (typ ValueType, size uint64, store bool) {
+	switch op {
+	case opI32Load:
+		return ValueTypeI32, 4, false
+	case opI64Load:
+		return ValueTypeI64, 8, false
+	case opI32Load8S, opI32Load8U:
+		return ValueTypeI32, 1, false
+	case opI32Load16S, opI32Load16U:
+		return ValueTypeI32, 2, false
+	case opI64Load8S, opI64Load8U:
+		return ValueTypeI64, 1, false
+	case opI64Load16S, opI64Load16U:
+		return ValueTypeI64, 2, false
+	case opI64Load32S, opI64Load32U:
+		return ValueTypeI64, 4, false
+	case opI32Store:
+		return ValueTypeI32, 4, true
+	case opI64Store:
+		return ValueTypeI64, 8, true
+	case opI32Store8:
+		return ValueTypeI32, 1, true
+	case opI32Store16:
+		return ValueTypeI32, 2, true
+	case opI64Store8:
+		return ValueTypeI64, 1, true
+	case opI64Store16:
+		return ValueTypeI64, 2, true
+	case opI64Store32:
+		return ValueTypeI64, 4, true
+	}
+	return 0, 0, false
+}
+
+func (c *compiler) compileMemory(op byte, r *reader) error {
+	align, err := r.readVarUint32()
+	if err != nil {
+		return err
+	}
+	offset, err := r.readVarUint32()
+	if err != nil {
+		return err
+	}
+	if !c.module.hasMemory {
+		return errNoMemory
+	}
+	typ, size, store := memoryAccess(op)
+	if align >= 64 || uint64(1)<<align > size {
+		return errors.New("wasm: alignment must not be larger than natural")
+	}
+	if store {
+		if _, err := c.pop(typ); err != nil {
+			return err
+		}
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+	} else {
+		if _, err := c.pop(ValueTypeI32); err != nil {
+			return err
+		}
+		c.push(typ)
+	}
+	c.emit(op, instr{imm: uint64(offset)})
+	return nil
+}
+
+var (
+	i32x1 = []ValueType{ValueTypeI32}
+	i32x2 = []ValueType{ValueTypeI32, ValueTypeI32}
+	i64x1 = []ValueType{ValueTypeI64}
+	i64x2 = []ValueType{ValueTypeI64, ValueTypeI64}
+)
+
+// numericSig returns the operand and result types of a numeric instruction.
+func numericSig(op byte) ([]ValueType, ValueType, bool) {
+	switch {
+	case op == opI32Eqz:
+		return i32x1, ValueTypeI32, true
+	case op >= opI32Eq && op <= opI32GeU:
+		return i32x2, ValueTypeI32, true
+	case op == opI64Eqz:
+		return i64x1, ValueTypeI32, true
+	case op >= opI64Eq && op <= opI64GeU:
+		return i64x2, ValueTypeI32, true
+	case op >= opI32Clz && op <= opI32Popcnt:
+		return i32x1, ValueTypeI32, true
+	case op >= opI32Add && op <= opI32Rotr:
+		return i32x2, ValueTypeI32, true
+	case op >= opI64Clz && op <= opI64Popcnt:
+		return i64x1, ValueTypeI64, true
+	case op >= opI64Add && op <= opI64Rotr:
+		return i64x2, ValueTypeI64, true
+	case op == opI32WrapI64:
+		return i64x1, ValueTypeI32, true
+	case op == opI64ExtendI32S, op == opI64ExtendI32U:
+		return i32x1, ValueTypeI64, true
+	case op == opI32Extend8S, op == opI32Extend16S:
+		return i32x1, ValueTypeI32, true
+	case op >= opI64Extend8S && op <= opI64Extend32S:
+		return i64x1, ValueTypeI64, true
+	}
+	return nil, 0, false
+}
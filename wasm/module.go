@@ -0,0 +1,612 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Magic is the preamble every WebAssembly binary module starts with.
+var Magic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// Version is the only binary format version understood by the decoder.
+const Version = uint32(1)
+
+// PageSize is the size of a linear memory page.
+const PageSize = 65536
+
+// maxPages is the largest number of pages addressable by a 32 bit memory.
+const maxPages = 65536
+
+// maxTableSize is the largest number of elements of a table.
+const maxTableSize = 1 << 16
+
+var (
+	errInvalidMagic   = errors.New("wasm: invalid magic number")
+	errInvalidVersion = errors.New("wasm: unsupported binary version")
+)
+
+// ValueType is the type of a WebAssembly value.
+type ValueType byte
+
+// Value types of the MVP. Floating point types are decoded so that modules
+// using them produce a meaningful error, but they can't be executed.
+const (
+	ValueTypeI32 ValueType = 0x7f
+	ValueTypeI64 ValueType = 0x7e
+	ValueTypeF32 ValueType = 0x7d
+	ValueTypeF64 ValueType = 0x7c
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case ValueTypeI32:
+		return "i32"
+	case ValueTypeI64:
+		return "i64"
+	case ValueTypeF32:
+		return "f32"
+	case ValueTypeF64:
+		return "f64"
+	}
+	return fmt.Sprintf("<unknown value type 0x%x>", byte(t))
+}
+
+// ExternalKind is the kind of an imported or exported definition.
+type ExternalKind byte
+
+// External kinds of imports and exports.
+const (
+	ExternalFunction ExternalKind = 0x00
+	ExternalTable    ExternalKind = 0x01
+	ExternalMemory   ExternalKind = 0x02
+	ExternalGlobal   ExternalKind = 0x03
+)
+
+// Section identifiers.
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionTable    = 4
+	sectionMemory   = 5
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionStart    = 8
+	sectionElement  = 9
+	sectionCode     = 10
+	sectionData     = 11
+)
+
+// elemTypeFuncref is the only table element type of the MVP.
+const elemTypeFuncref = 0x70
+
+// FunctionSig is the signature of a function.
+type FunctionSig struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+// Equal reports whether two signatures are structurally identical.
+func (s *FunctionSig) Equal(other *FunctionSig) bool {
+	return bytes.Equal(valueTypeBytes(s.Params), valueTypeBytes(other.Params)) &&
+		bytes.Equal(valueTypeBytes(s.Results), valueTypeBytes(other.Results))
+}
+
+func (s *FunctionSig) String() string {
+	return fmt.Sprintf("%v -> %v", s.Params, s.Results)
+}
+
+func valueTypeBytes(types []ValueType) []byte {
+	b := make([]byte, len(types))
+	for i, t := range types {
+		b[i] = byte(t)
+	}
+	return b
+}
+
+// Limits describe the initial and optional maximum size of a table or memory.
+type Limits struct {
+	Min    uint32
+	Max    uint32
+	HasMax bool
+}
+
+// GlobalType is the type of a global variable.
+type GlobalType struct {
+	Type    ValueType
+	Mutable bool
+}
+
+// Import is an entry of the import section.
+type Import struct {
+	Module string
+	Field  string
+	Kind   ExternalKind
+
+	Func   uint32 // type index of an imported function
+	Table  Limits
+	Memory Limits
+	Global GlobalType
+}
+
+// Export is an entry of the export section.
+type Export struct {
+	Field string
+	Kind  ExternalKind
+	Index uint32
+}
+
+// Global is a global variable defined by the module.
+type Global struct {
+	Type GlobalType
+	Init []byte // constant initializer expression, including the final end
+}
+
+// ElementSegment initialises a range of a table with function indices.
+type ElementSegment struct {
+	Table  uint32
+	Offset []byte // constant offset expression
+	Elems  []uint32
+}
+
+// DataSegment initialises a range of linear memory.
+type DataSegment struct {
+	Memory uint32
+	Offset []byte // constant offset expression
+	Data   []byte
+}
+
+// FunctionBody is the body of a function defined by the module.
+type FunctionBody struct {
+	Locals []ValueType // declared locals, excluding parameters
+	Code   []byte      // instructions, including the final end
+}
+
+// Module is a decoded WebAssembly binary module.
+type Module struct {
+	Types     []FunctionSig
+	Imports   []Import
+	Functions []uint32 // type indices of the functions defined by the module
+	Tables    []Limits
+	Memories  []Limits
+	Globals   []Global
+	Exports   []Export
+	Start     *uint32
+	Elements  []ElementSegment
+	Codes     []FunctionBody
+	Data      []DataSegment
+}
+
+// HasMagic reports whether code starts with the WebAssembly preamble.
+func HasMagic(code []byte) bool {
+	return len(code) >= len(Magic) && bytes.Equal(code[:len(Magic)], Magic)
+}
+
+// DecodeModule parses a binary WebAssembly module. The module is only checked
+// for being well formed, its functions are validated when compiled.
+func DecodeModule(code []byte) (*Module, error) {
+	r := newReader(code)
+	magic, err := r.readBytes(4)
+	if err != nil || !bytes.Equal(magic, Magic) {
+		return nil, errInvalidMagic
+	}
+	version, err := r.readBytes(4)
+	if err != nil || binary.LittleEndian.Uint32(version) != Version {
+		return nil, errInvalidVersion
+	}
+	var (
+		module = new(Module)
+		last   byte
+	)
+	for r.len() > 0 {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.readVarUint32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.readBytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+		if id == sectionCustom {
+			continue
+		}
+		if id > sectionData {
+			return nil, fmt.Errorf("wasm: unknown section id %d", id)
+		}
+		if id <= last {
+			return nil, fmt.Errorf("wasm: section %d out of order", id)
+		}
+		last = id
+
+		sr := newReader(payload)
+		if err := module.decodeSection(id, sr); err != nil {
+			return nil, err
+		}
+		if sr.len() != 0 {
+			return nil, fmt.Errorf("wasm: section %d size mismatch", id)
+		}
+	}
+	if len(module.Functions) != len(module.Codes) {
+		return nil, errors.New("wasm: function and code section have inconsistent lengths")
+	}
+	return module, nil
+}
+
+func (m *Module) decodeSection(id byte, r *reader) error {
+	switch id {
+	case sectionType:
+		return decodeVector(r, func() error {
+			form, err := r.readByte()
+			if err != nil {
+				return err
+			}
+			if form != 0x60 {
+				return fmt.Errorf("wasm: invalid function type form 0x%x", form)
+			}
+			var sig FunctionSig
+			if sig.Params, err = readValueTypes(r); err != nil {
+				return err
+			}
+			if sig.Results, err = readValueTypes(r); err != nil {
+				return err
+			}
+			if len(sig.Results) > 1 {
+				return errors.New("wasm: multiple return values are not supported")
+			}
+			m.Types = append(m.Types, sig)
+			return nil
+		})
+	case sectionImport:
+		return decodeVector(r, func() error {
+			var (
+				imp Import
+				err error
+			)
+			if imp.Module, err = r.readName(); err != nil {
+				return err
+			}
+			if imp.Field, err = r.readName(); err != nil {
+				return err
+			}
+			kind, err := r.readByte()
+			if err != nil {
+				return err
+			}
+			imp.Kind = ExternalKind(kind)
+			switch imp.Kind {
+			case ExternalFunction:
+				imp.Func, err = r.readVarUint32()
+			case ExternalTable:
+				imp.Table, err = readTableType(r)
+			case ExternalMemory:
+				imp.Memory, err = readLimits(r)
+			case ExternalGlobal:
+				imp.Global, err = readGlobalType(r)
+			default:
+				err = fmt.Errorf("wasm: invalid import kind 0x%x", kind)
+			}
+			if err != nil {
+				return err
+			}
+			m.Imports = append(m.Imports, imp)
+			return nil
+		})
+	case sectionFunction:
+		return decodeVector(r, func() error {
+			idx, err := r.readVarUint32()
+			if err != nil {
+				return err
+			}
+			m.Functions = append(m.Functions, idx)
+			return nil
+		})
+	case sectionTable:
+		return decodeVector(r, func() error {
+			limits, err := readTableType(r)
+			if err != nil {
+				return err
+			}
+			m.Tables = append(m.Tables, limits)
+			return nil
+		})
+	case sectionMemory:
+		return decodeVector(r, func() error {
+			limits, err := readLimits(r)
+			if err != nil {
+				return err
+			}
+			m.Memories = append(m.Memories, limits)
+			return nil
+		})
+	case sectionGlobal:
+		return decodeVector(r, func() error {
+			typ, err := readGlobalType(r)
+			if err != nil {
+				return err
+			}
+			init, err := readConstExpr(r)
+			if err != nil {
+				return err
+			}
+			m.Globals = append(m.Globals, Global{Type: typ, Init: init})
+			return nil
+		})
+	case sectionExport:
+		seen := make(map[string]bool)
+		return decodeVector(r, func() error {
+			var (
+				exp Export
+				err error
+			)
+			if exp.Field, err = r.readName(); err != nil {
+				return err
+			}
+			if seen[exp.Field] {
+				return fmt.Errorf("wasm: duplicate export %q", exp.Field)
+			}
+			seen[exp.Field] = true
+
+			kind, err := r.readByte()
+			if err != nil {
+				return err
+			}
+			if kind > byte(ExternalGlobal) {
+				return fmt.Errorf("wasm: invalid export kind 0x%x", kind)
+			}
+			exp.Kind = ExternalKind(kind)
+			if exp.Index, err = r.readVarUint32(); err != nil {
+				return err
+			}
+			m.Exports = append(m.Exports, exp)
+			return nil
+		})
+	case sectionStart:
+		idx, err := r.readVarUint32()
+		if err != nil {
+			return err
+		}
+		m.Start = &idx
+		return nil
+	case sectionElement:
+		return decodeVector(r, func() error {
+			var (
+				seg ElementSegment
+				err error
+			)
+			if seg.Table, err = r.readVarUint32(); err != nil {
+				return err
+			}
+			if seg.Offset, err = readConstExpr(r); err != nil {
+				return err
+			}
+			err = decodeVector(r, func() error {
+				idx, err := r.readVarUint32()
+				if err != nil {
+					return err
+				}
+				seg.Elems = append(seg.Elems, idx)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			m.Elements = append(m.Elements, seg)
+			return nil
+		})
+	case sectionCode:
+		return decodeVector(r, func() error {
+			size, err := r.readVarUint32()
+			if err != nil {
+				return err
+			}
+			body, err := r.readBytes(int(size))
+			if err != nil {
+				return err
+			}
+			br := newReader(body)
+			var fn FunctionBody
+			err = decodeVector(br, func() error {
+				count, err := br.readVarUint32()
+				if err != nil {
+					return err
+				}
+				typ, err := readValueType(br)
+				if err != nil {
+					return err
+				}
+				if uint64(len(fn.Locals))+uint64(count) > maxLocals {
+					return errors.New("wasm: too many locals")
+				}
+				for i := uint32(0); i < count; i++ {
+					fn.Locals = append(fn.Locals, typ)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			fn.Code = body[br.pos:]
+			m.Codes = append(m.Codes, fn)
+			return nil
+		})
+	case sectionData:
+		return decodeVector(r, func() error {
+			var (
+				seg DataSegment
+				err error
+			)
+			if seg.Memory, err = r.readVarUint32(); err != nil {
+				return err
+			}
+			if seg.Offset, err = readConstExpr(r); err != nil {
+				return err
+			}
+			size, err := r.readVarUint32()
+			if err != nil {
+				return err
+			}
+			if seg.Data, err = r.readBytes(int(size)); err != nil {
+				return err
+			}
+			m.Data = append(m.Data, seg)
+			return nil
+		})
+	}
+	return nil
+}
+
+// ImportedFunctions returns the function imports in index space order.
+func (m *Module) ImportedFunctions() []Import {
+	var funcs []Import
+	for _, imp := range m.Imports {
+		if imp.Kind == ExternalFunction {
+			funcs = append(funcs, imp)
+		}
+	}
+	return funcs
+}
+
+// Export looks up an export by name.
+func (m *Module) Export(field string) (Export, bool) {
+	for _, exp := range m.Exports {
+		if exp.Field == field {
+			return exp, true
+		}
+	}
+	return Export{}, false
+}
+
+// decodeVector reads a vector length and calls fn once per element.
+func decodeVector(r *reader, fn func() error) error {
+	n, err := r.readVarUint32()
+	if err != nil {
+		return err
+	}
+	// Every element occupies at least one byte, reject lengths which can't
+	// possibly fit into the remaining input before allocating anything.
+	if int(n) > r.len() {
+		return errUnexpectedEOF
+	}
+	for i := uint32(0); i < n; i++ {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readValueType(r *reader) (ValueType, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := ValueType(b); t {
+	case ValueTypeI32, ValueTypeI64, ValueTypeF32, ValueTypeF64:
+		return t, nil
+	}
+	return 0, fmt.Errorf("wasm: invalid value type 0x%x", b)
+}
+
+func readValueTypes(r *reader) ([]ValueType, error) {
+	var types []ValueType
+	err := decodeVector(r, func() error {
+		t, err := readValueType(r)
+		if err != nil {
+			return err
+		}
+		types = append(types, t)
+		return nil
+	})
+	return types, err
+}
+
+func readLimits(r *reader) (Limits, error) {
+	var (
+		limits Limits
+		err    error
+	)
+	flag, err := r.readByte()
+	if err != nil {
+		return limits, err
+	}
+	if flag > 1 {
+		return limits, fmt.Errorf("wasm: invalid limits flag 0x%x", flag)
+	}
+	if limits.Min, err = r.readVarUint32(); err != nil {
+		return limits, err
+	}
+	if flag == 1 {
+		limits.HasMax = true
+		if limits.Max, err = r.readVarUint32(); err != nil {
+			return limits, err
+		}
+		if limits.Max < limits.Min {
+			return limits, errors.New("wasm: limits maximum is smaller than the minimum")
+		}
+	}
+	return limits, nil
+}
+
+func readTableType(r *reader) (Limits, error) {
+	elem, err := r.readByte()
+	if err != nil {
+		return Limits{}, err
+	}
+	if elem != elemTypeFuncref {
+		return Limits{}, fmt.Errorf("wasm: invalid table element type 0x%x", elem)
+	}
+	return readLimits(r)
+}
+
+func readGlobalType(r *reader) (GlobalType, error) {
+	typ, err := readValueType(r)
+	if err != nil {
+		return GlobalType{}, err
+	}
+	mut, err := r.readByte()
+	if err != nil {
+		return GlobalType{}, err
+	}
+	if mut > 1 {
+		return GlobalType{}, fmt.Errorf("wasm: invalid global mutability 0x%x", mut)
+	}
+	return GlobalType{Type: typ, Mutable: mut == 1}, nil
+}
+
+// readConstExpr reads a constant initializer expression consisting of a
+// single constant instruction followed by end.
+func readConstExpr(r *reader) ([]byte, error) {
+	start := r.pos
+	op, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case opI32Const:
+		_, err = r.readVarInt32()
+	case opI64Const:
+		_, err = r.readVarInt64()
+	case opGlobalGet:
+		_, err = r.readVarUint32()
+	default:
+		err = fmt.Errorf("wasm: unsupported constant expression opcode 0x%x", op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	end, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if end != opEnd {
+		return nil, errors.New("wasm: constant expression is not terminated")
+	}
+	return r.buf[start:r.pos], nil
+}
@@ -0,0 +1,247 @@
+package wasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// moduleBuilder assembles binary modules for tests.
+type moduleBuilder struct {
+	types   [][]byte
+	imports [][]byte
+	funcs   []uint32
+	codes   [][]byte
+	exports [][]byte
+	memory  []byte
+	table   []byte
+	globals [][]byte
+	elems   [][]byte
+	data    [][]byte
+	start   []byte
+}
+
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if v == 0 {
+			return out
+		}
+	}
+}
+
+func sleb(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func name(s string) []byte {
+	return append(uleb(uint64(len(s))), s...)
+}
+
+func vec(items [][]byte) []byte {
+	out := uleb(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func (b *moduleBuilder) typ(params, results []ValueType) uint32 {
+	enc := []byte{0x60}
+	enc = append(enc, uleb(uint64(len(params)))...)
+	enc = append(enc, valueTypeBytes(params)...)
+	enc = append(enc, uleb(uint64(len(results)))...)
+	enc = append(enc, valueTypeBytes(results)...)
+	b.types = append(b.types, enc)
+	return uint32(len(b.types) - 1)
+}
+
+func (b *moduleBuilder) importFunc(module, field string, typ uint32) {
+	enc := append(name(module), name(field)...)
+	enc = append(enc, byte(ExternalFunction))
+	b.imports = append(b.imports, append(enc, uleb(uint64(typ))...))
+}
+
+// function adds a function with the given locals and body, the final end is
+// appended automatically.
+func (b *moduleBuilder) function(typ uint32, locals []ValueType, body ...byte) {
+	b.funcs = append(b.funcs, typ)
+	var decls [][]byte
+	for _, l := range locals {
+		decls = append(decls, []byte{1, byte(l)})
+	}
+	enc := append(vec(decls), body...)
+	enc = append(enc, opEnd)
+	b.codes = append(b.codes, append(uleb(uint64(len(enc))), enc...))
+}
+
+func (b *moduleBuilder) export(field string, kind ExternalKind, idx uint32) {
+	enc := append(name(field), byte(kind))
+	b.exports = append(b.exports, append(enc, uleb(uint64(idx))...))
+}
+
+func (b *moduleBuilder) section(out []byte, id byte, payload []byte) []byte {
+	out = append(out, id)
+	out = append(out, uleb(uint64(len(payload)))...)
+	return append(out, payload...)
+}
+
+func (b *moduleBuilder) bytes() []byte {
+	out := append([]byte{}, Magic...)
+	out = append(out, 1, 0, 0, 0)
+	if len(b.types) > 0 {
+		out = b.section(out, sectionType, vec(b.types))
+	}
+	if len(b.imports) > 0 {
+		out = b.section(out, sectionImport, vec(b.imports))
+	}
+	if len(b.funcs) > 0 {
+		var funcs [][]byte
+		for _, f := range b.funcs {
+			funcs = append(funcs, uleb(uint64(f)))
+		}
+		out = b.section(out, sectionFunction, vec(funcs))
+	}
+	if b.table != nil {
+		out = b.section(out, sectionTable, append([]byte{1, elemTypeFuncref}, b.table...))
+	}
+	if b.memory != nil {
+		out = b.section(out, sectionMemory, append([]byte{1}, b.memory...))
+	}
+	if len(b.globals) > 0 {
+		out = b.section(out, sectionGlobal, vec(b.globals))
+	}
+	if len(b.exports) > 0 {
+		out = b.section(out, sectionExport, vec(b.exports))
+	}
+	if b.start != nil {
+		out = b.section(out, sectionStart, b.start)
+	}
+	if len(b.elems) > 0 {
+		out = b.section(out, sectionElement, vec(b.elems))
+	}
+	if len(b.codes) > 0 {
+		out = b.section(out, sectionCode, vec(b.codes))
+	}
+	if len(b.data) > 0 {
+		out = b.section(out, sectionData, vec(b.data))
+	}
+	return out
+}
+
+var (
+	i32 = ValueTypeI32
+	i64 = ValueTypeI64
+)
+
+func TestReadVarInt(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		size uint
+		want int64
+		err  error
+	}{
+		{[]byte{0x00}, 32, 0, nil},
+		{[]byte{0x7f}, 32, -1, nil},
+		{[]byte{0x80, 0x7f}, 32, -128, nil},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x07}, 32, 0x7fffffff, nil},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x78}, 32, -0x80000000, nil},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 32, 0, errLEBOverflow},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 32, 0, errLEBOverflow},
+		{[]byte{0x80}, 32, 0, errUnexpectedEOF},
+		{sleb(-1 << 63), 64, -1 << 63, nil},
+		{sleb(1<<63 - 1), 64, 1<<63 - 1, nil},
+	}
+	for i, test := range tests {
+		got, err := newReader(test.in).readVarInt(test.size)
+		if err != test.err || got != test.want {
+			t.Errorf("test %d: have (%d, %v), want (%d, %v)", i, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestReadVarUint(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want uint64
+		err  error
+	}{
+		{[]byte{0x00}, 0, nil},
+		{[]byte{0xe5, 0x8e, 0x26}, 624485, nil},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 0xffffffff, nil},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x1f}, 0, errLEBOverflow},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, errLEBOverflow},
+	}
+	for i, test := range tests {
+		got, err := newReader(test.in).readVarUint(32)
+		if err != test.err || got != test.want {
+			t.Errorf("test %d: have (%d, %v), want (%d, %v)", i, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestDecodeModule(t *testing.T) {
+	b := new(moduleBuilder)
+	typ := b.typ([]ValueType{i32}, []ValueType{i64})
+	b.importFunc("env", "ext", typ)
+	b.function(typ, []ValueType{i64}, opLocalGet, 0, opCall, 0)
+	b.memory = []byte{1, 1, 2}
+	b.export("run", ExternalFunction, 1)
+	b.export("memory", ExternalMemory, 0)
+	b.data = append(b.data, append([]byte{0, opI32Const, 8, opEnd}, name("hi")...))
+
+	m, err := DecodeModule(b.bytes())
+	if err != nil {
+		t.Fatalf("failed to decode module: %v", err)
+	}
+	if len(m.Types) != 1 || !m.Types[0].Equal(&FunctionSig{Params: []ValueType{i32}, Results: []ValueType{i64}}) {
+		t.Errorf("unexpected types %v", m.Types)
+	}
+	if imports := m.ImportedFunctions(); len(imports) != 1 || imports[0].Module != "env" || imports[0].Field != "ext" {
+		t.Errorf("unexpected imports %v", imports)
+	}
+	if exp, ok := m.Export("run"); !ok || exp.Index != 1 {
+		t.Errorf("unexpected export %v", exp)
+	}
+	if m.Memories[0] != (Limits{Min: 1, Max: 2, HasMax: true}) {
+		t.Errorf("unexpected memory %v", m.Memories[0])
+	}
+	if len(m.Codes) != 1 || len(m.Codes[0].Locals) != 1 {
+		t.Errorf("unexpected code %v", m.Codes)
+	}
+	if len(m.Data) != 1 || !bytes.Equal(m.Data[0].Data, []byte("hi")) {
+		t.Errorf("unexpected data %v", m.Data)
+	}
+}
+
+func TestDecodeModuleErrors(t *testing.T) {
+	valid := new(moduleBuilder)
+	valid.function(valid.typ(nil, nil), nil)
+	code := valid.bytes()
+
+	tests := map[string][]byte{
+		"magic":     append([]byte{0, 'a', 's', 'n'}, code[4:]...),
+		"version":   append(append([]byte{}, code[:4]...), append([]byte{2, 0, 0, 0}, code[8:]...)...),
+		"truncated": code[:len(code)-1],
+		"order":     append(append([]byte{}, code...), sectionType, 1, 0),
+		"unknown":   append(append([]byte{}, code...), 12, 0),
+	}
+	for name, code := range tests {
+		if _, err := DecodeModule(code); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package wasm
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+var (
+	errUnexpectedEOF = errors.New("wasm: unexpected end of input")
+	errLEBOverflow   = errors.New("wasm: LEB128 integer too large")
+	errInvalidUTF8   = errors.New("wasm: invalid UTF-8 name")
+)
+
+// reader is a cursor over a binary module or a function body.
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func newReader(buf []byte) *reader {
+	return &reader{buf: buf}
+}
+
+// len returns the number of unread bytes.
+func (r *reader) len() int {
+	return len(r.buf) - r.pos
+}
+
+func (r *reader) readByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errUnexpectedEOF
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) readBytes(n int) ([]byte, error) {
+	if n < 0 || r.len() < n {
+		return nil, errUnexpectedEOF
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// readVarUint32 reads an unsigned LEB128 encoded 32 bit integer.
+func (r *reader) readVarUint32() (uint32, error) {
+	v, err := r.readVarUint(32)
+	return uint32(v), err
+}
+
+// readVarUint reads an unsigned LEB128 encoded integer of at most size bits.
+func (r *reader) readVarUint(size uint) (uint64, error) {
+	var result uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= size {
+			return 0, errLEBOverflow
+		}
+		b, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+		// The final byte may only carry the remaining payload bits and must
+		// not have the continuation bit set.
+		if rem := size - shift; rem < 7 && b >= 1<<rem {
+			return 0, errLEBOverflow
+		}
+		result |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+}
+
+// readVarInt32 reads a signed LEB128 encoded 32 bit integer.
+func (r *reader) readVarInt32() (int32, error) {
+	v, err := r.readVarInt(32)
+	return int32(v), err
+}
+
+// readVarInt64 reads a signed LEB128 encoded 64 bit integer.
+func (r *reader) readVarInt64() (int64, error) {
+	return r.readVarInt(64)
+}
+
+// readVarInt reads a signed LEB128 encoded integer of at most size bits.
+func (r *reader) readVarInt(size uint) (int64, error) {
+	var result int64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= size {
+			return 0, errLEBOverflow
+		}
+		b, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+		// The unused bits of the final byte must be a sign extension of the
+		// last payload bit.
+		if rem := size - shift; rem < 7 {
+			if b&0x80 != 0 {
+				return 0, errLEBOverflow
+			}
+			upper := b >> rem
+			if sign := (b >> (rem - 1)) & 1; (sign == 0 && upper != 0) || (sign == 1 && upper != 0x7f>>rem) {
+				return 0, errLEBOverflow
+			}
+		}
+		result |= int64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if shift+7 < 64 && b&0x40 != 0 {
+				result |= -1 << (shift + 7)
+			}
+			return result, nil
+		}
+	}
+}
+
+// readName reads a length prefixed UTF-8 string.
+func (r *reader) readName() (string, error) {
+	n, err := r.readVarUint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.readBytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errInvalidUTF8
+	}
+	return string(b), nil
+}
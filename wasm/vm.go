@@ -0,0 +1,687 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Traps abort the execution of a module.
+var (
+	ErrUnreachable              = errors.New("wasm: unreachable executed")
+	ErrMemoryOutOfBounds        = errors.New("wasm: out of bounds memory access")
+	ErrIntegerDivideByZero      = errors.New("wasm: integer divide by zero")
+	ErrIntegerOverflow          = errors.New("wasm: integer overflow")
+	ErrUndefinedElement         = errors.New("wasm: undefined table element")
+	ErrIndirectCallTypeMismatch = errors.New("wasm: indirect call type mismatch")
+	ErrCallStackExhausted       = errors.New("wasm: call stack exhausted")
+)
+
+const (
+	defaultMaxCallDepth = 1024
+	maxStackValues      = 1 << 20
+)
+
+// HostFunction is a function implemented by the embedder and imported by a
+// module. Call receives the arguments in declaration order and returns the
+// single result, if the signature has one. Any error aborts the execution
+// and is returned unchanged to the caller of Invoke.
+type HostFunction struct {
+	Sig  FunctionSig
+	Call func(vm *VM, args []uint64) (uint64, error)
+}
+
+// ImportResolver resolves a function import to its host implementation.
+type ImportResolver func(module, field string) (*HostFunction, error)
+
+// Config are the instance options of a VM.
+type Config struct {
+	// MaxMemoryPages caps the linear memory, defaults to 4GiB.
+	MaxMemoryPages uint32
+	// MaxCallDepth caps the depth of nested calls, defaults to 1024.
+	MaxCallDepth int
+	// Meter is invoked with the gas of every basic block before it is
+	// executed and with MemoryPageGas per page before memory is allocated
+	// or grows. An error aborts the execution.
+	Meter func(gas uint64) error
+	// MemoryPageGas is the gas charged per page of the initial memory and
+	// per page allocated by memory.grow.
+	MemoryPageGas uint64
+}
+
+// VM is an instance of a compiled module. It is not safe for concurrent use.
+type VM struct {
+	module *CompiledModule
+	cfg    Config
+	host   []*HostFunction
+
+	// Memory is the linear memory of the instance.
+	Memory  []byte
+	maxMem  uint32
+	globals []uint64
+	table   []int64 // function index or -1 for uninitialised elements
+
+	stack []uint64
+	sp    int
+	depth int
+}
+
+// NewVM instantiates a compiled module: imports are resolved, globals, the
+// table and memory are initialised and the start function, if any, is run.
+func NewVM(cm *CompiledModule, resolve ImportResolver, cfg Config) (*VM, error) {
+	if cfg.MaxMemoryPages == 0 || cfg.MaxMemoryPages > maxPages {
+		cfg.MaxMemoryPages = maxPages
+	}
+	if cfg.MaxCallDepth == 0 {
+		cfg.MaxCallDepth = defaultMaxCallDepth
+	}
+	vm := &VM{module: cm, cfg: cfg}
+	m := cm.Module
+
+	for _, imp := range m.ImportedFunctions() {
+		if resolve == nil {
+			return nil, fmt.Errorf("wasm: unresolved import %s.%s", imp.Module, imp.Field)
+		}
+		fn, err := resolve(imp.Module, imp.Field)
+		if err != nil {
+			return nil, err
+		}
+		if !fn.Sig.Equal(&m.Types[imp.Func]) {
+			return nil, fmt.Errorf("wasm: import %s.%s signature mismatch, have %v, want %v", imp.Module, imp.Field, &fn.Sig, &m.Types[imp.Func])
+		}
+		vm.host = append(vm.host, fn)
+	}
+	for _, g := range m.Globals {
+		v, _ := evalConstExpr(g.Init, g.Type.Type)
+		vm.globals = append(vm.globals, v)
+	}
+	if cm.hasTable {
+		vm.table = make([]int64, m.Tables[0].Min)
+		for i := range vm.table {
+			vm.table[i] = -1
+		}
+		for _, seg := range m.Elements {
+			offset, _ := evalConstExpr(seg.Offset, ValueTypeI32)
+			if offset+uint64(len(seg.Elems)) > uint64(len(vm.table)) {
+				return nil, errors.New("wasm: element segment does not fit")
+			}
+			for i, idx := range seg.Elems {
+				vm.table[offset+uint64(i)] = int64(idx)
+			}
+		}
+	}
+	if cm.hasMemory {
+		limits := m.Memories[0]
+		vm.maxMem = cfg.MaxMemoryPages
+		if limits.HasMax && limits.Max < vm.maxMem {
+			vm.maxMem = limits.Max
+		}
+		if limits.Min > vm.maxMem {
+			return nil, errors.New("wasm: initial memory exceeds the limit")
+		}
+		gas := uint64(math.MaxUint64)
+		if hi, lo := bits.Mul64(uint64(limits.Min), cfg.MemoryPageGas); hi == 0 {
+			gas = lo
+		}
+		if err := vm.charge(gas); err != nil {
+			return nil, err
+		}
+		vm.Memory = make([]byte, uint64(limits.Min)*PageSize)
+		for _, seg := range m.Data {
+			offset, _ := evalConstExpr(seg.Offset, ValueTypeI32)
+			if offset+uint64(len(seg.Data)) > uint64(len(vm.Memory)) {
+				return nil, errors.New("wasm: data segment does not fit")
+			}
+			copy(vm.Memory[offset:], seg.Data)
+		}
+	}
+	if m.Start != nil {
+		if _, err := vm.Invoke(*m.Start); err != nil {
+			return nil, err
+		}
+	}
+	return vm, nil
+}
+
+// ExportedFunction returns the index of an exported function.
+func (vm *VM) ExportedFunction(name string) (uint32, error) {
+	exp, ok := vm.module.Module.Export(name)
+	if !ok || exp.Kind != ExternalFunction {
+		return 0, fmt.Errorf("wasm: function %q is not exported", name)
+	}
+	return exp.Index, nil
+}
+
+// Signature returns the signature of a function.
+func (vm *VM) Signature(fn uint32) (*FunctionSig, error) {
+	return vm.module.Signature(fn)
+}
+
+// Invoke calls a function with the given arguments and returns its result,
+// or zero for functions without result.
+func (vm *VM) Invoke(fn uint32, args ...uint64) (uint64, error) {
+	sig, err := vm.Signature(fn)
+	if err != nil {
+		return 0, err
+	}
+	if len(args) != len(sig.Params) {
+		return 0, fmt.Errorf("wasm: function %d expects %d arguments, got %d", fn, len(sig.Params), len(args))
+	}
+	vm.sp, vm.depth = 0, 0
+	if err := vm.reserve(len(args)); err != nil {
+		return 0, err
+	}
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.call(fn); err != nil {
+		return 0, err
+	}
+	if len(sig.Results) == 0 {
+		return 0, nil
+	}
+	return vm.pop(), nil
+}
+
+// MemoryRead returns a copy of size bytes of linear memory at offset.
+func (vm *VM) MemoryRead(offset, size uint32) ([]byte, error) {
+	if uint64(offset)+uint64(size) > uint64(len(vm.Memory)) {
+		return nil, ErrMemoryOutOfBounds
+	}
+	return append([]byte{}, vm.Memory[offset:offset+size]...), nil
+}
+
+// MemoryWrite copies data into linear memory at offset.
+func (vm *VM) MemoryWrite(offset uint32, data []byte) error {
+	if uint64(offset)+uint64(len(data)) > uint64(len(vm.Memory)) {
+		return ErrMemoryOutOfBounds
+	}
+	copy(vm.Memory[offset:], data)
+	return nil
+}
+
+func (vm *VM) push(v uint64) {
+	vm.stack[vm.sp] = v
+	vm.sp++
+}
+
+func (vm *VM) pop() uint64 {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// reserve makes room for n more values on the operand stack.
+func (vm *VM) reserve(n int) error {
+	need := vm.sp + n
+	if need <= len(vm.stack) {
+		return nil
+	}
+	if need > maxStackValues {
+		return ErrCallStackExhausted
+	}
+	size := 2 * len(vm.stack)
+	if size < need {
+		size = need
+	}
+	if size > maxStackValues {
+		size = maxStackValues
+	}
+	stack := make([]uint64, size)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	return nil
+}
+
+func (vm *VM) charge(gas uint64) error {
+	if vm.cfg.Meter == nil || gas == 0 {
+		return nil
+	}
+	return vm.cfg.Meter(gas)
+}
+
+// call invokes a function with its arguments on top of the operand stack and
+// replaces them with the result.
+func (vm *VM) call(idx uint32) error {
+	sig := vm.module.sigs[idx]
+	nparams := len(sig.Params)
+
+	if int(idx) < vm.module.numImports {
+		args := make([]uint64, nparams)
+		vm.sp -= nparams
+		copy(args, vm.stack[vm.sp:])
+		res, err := vm.host[idx].Call(vm, args)
+		if err != nil {
+			return err
+		}
+		if len(sig.Results) > 0 {
+			vm.push(res)
+		}
+		return nil
+	}
+	if vm.depth >= vm.cfg.MaxCallDepth {
+		return ErrCallStackExhausted
+	}
+	vm.depth++
+	defer func() { vm.depth-- }()
+
+	f := vm.module.funcs[int(idx)-vm.module.numImports]
+	locals := make([]uint64, f.numLocals)
+	vm.sp -= nparams
+	copy(locals, vm.stack[vm.sp:vm.sp+nparams])
+	base := vm.sp
+
+	if err := vm.execute(f, locals); err != nil {
+		return err
+	}
+	if len(sig.Results) > 0 {
+		vm.stack[base] = vm.stack[vm.sp-1]
+		vm.sp = base + 1
+	} else {
+		vm.sp = base
+	}
+	return nil
+}
+
+// branch moves the kept values of a branch down over the dropped ones.
+func (vm *VM) branch(drop, keep int) {
+	if drop > 0 {
+		copy(vm.stack[vm.sp-keep-drop:], vm.stack[vm.sp-keep:vm.sp])
+		vm.sp -= drop
+	}
+}
+
+// address computes the effective address of a memory access and checks it
+// against the bounds of linear memory.
+func (vm *VM) address(base uint64, offset uint64, size uint64) (uint64, error) {
+	addr := uint64(uint32(base)) + offset
+	if addr+size > uint64(len(vm.Memory)) {
+		return 0, ErrMemoryOutOfBounds
+	}
+	return addr, nil
+}
+
+func (vm *VM) execute(f *compiledFunc, locals []uint64) error {
+	if err := vm.reserve(f.maxStack); err != nil {
+		return err
+	}
+	code := f.code
+	for pc := 0; pc < len(code); pc++ {
+		ins := &code[pc]
+		switch ins.op {
+		case opMeter:
+			if err := vm.charge(ins.imm); err != nil {
+				return err
+			}
+		case opUnreachable:
+			return ErrUnreachable
+		case opJump:
+			pc = ins.target - 1
+		case opJumpIfZ:
+			if uint32(vm.pop()) == 0 {
+				pc = ins.target - 1
+			}
+		case opBr:
+			vm.branch(ins.drop, ins.keep)
+			pc = ins.target - 1
+		case opBrIf:
+			if uint32(vm.pop()) != 0 {
+				vm.branch(ins.drop, ins.keep)
+				pc = ins.target - 1
+			}
+		case opBrTable:
+			table := f.tables[ins.imm]
+			i := uint64(uint32(vm.pop()))
+			if i >= uint64(len(table)) {
+				i = uint64(len(table) - 1)
+			}
+			br := table[i]
+			vm.branch(br.drop, br.keep)
+			pc = br.target - 1
+		case opReturn:
+			return nil
+		case opCall, opCallHost:
+			if err := vm.call(uint32(ins.imm)); err != nil {
+				return err
+			}
+		case opCallIndirect:
+			i := uint64(uint32(vm.pop()))
+			if i >= uint64(len(vm.table)) || vm.table[i] < 0 {
+				return ErrUndefinedElement
+			}
+			fn := uint32(vm.table[i])
+			if !vm.module.sigs[fn].Equal(&vm.module.Module.Types[ins.imm]) {
+				return ErrIndirectCallTypeMismatch
+			}
+			if err := vm.call(fn); err != nil {
+				return err
+			}
+
+		case opDrop:
+			vm.sp--
+		case opSelect:
+			c := uint32(vm.pop())
+			b := vm.pop()
+			if c == 0 {
+				vm.stack[vm.sp-1] = b
+			}
+
+		case opLocalGet:
+			vm.push(locals[ins.imm])
+		case opLocalSet:
+			locals[ins.imm] = vm.pop()
+		case opLocalTee:
+			locals[ins.imm] = vm.stack[vm.sp-1]
+		case opGlobalGet:
+			vm.push(vm.globals[ins.imm])
+		case opGlobalSet:
+			vm.globals[ins.imm] = vm.pop()
+
+		case opMemorySize:
+			vm.push(uint64(len(vm.Memory) / PageSize))
+		case opMemoryGrow:
+			pages := uint64(uint32(vm.pop()))
+			old := uint64(len(vm.Memory) / PageSize)
+			if old+pages > uint64(vm.maxMem) {
+				vm.push(uint64(math.MaxUint32))
+				break
+			}
+			if err := vm.charge(pages * vm.cfg.MemoryPageGas); err != nil {
+				return err
+			}
+			vm.Memory = append(vm.Memory, make([]byte, pages*PageSize)...)
+			vm.push(old)
+
+		case opI32Const, opI64Const:
+			vm.push(ins.imm)
+
+		default:
+			var err error
+			if ins.op >= opI32Load && ins.op <= opI64Store32 {
+				err = vm.memoryOp(ins)
+			} else {
+				err = vm.numericOp(ins.op)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (vm *VM) memoryOp(ins *instr) error {
+	_, size, store := memoryAccess(ins.op)
+	var value uint64
+	if store {
+		value = vm.pop()
+	}
+	addr, err := vm.address(vm.pop(), ins.imm, size)
+	if err != nil {
+		return err
+	}
+	mem := vm.Memory[addr : addr+size]
+	if store {
+		switch size {
+		case 1:
+			mem[0] = byte(value)
+		case 2:
+			binary.LittleEndian.PutUint16(mem, uint16(value))
+		case 4:
+			binary.LittleEndian.PutUint32(mem, uint32(value))
+		case 8:
+			binary.LittleEndian.PutUint64(mem, value)
+		}
+		return nil
+	}
+	switch ins.op {
+	case opI32Load, opI64Load32U:
+		value = uint64(binary.LittleEndian.Uint32(mem))
+	case opI64Load:
+		value = binary.LittleEndian.Uint64(mem)
+	case opI32Load8S:
+		value = uint64(uint32(int32(int8(mem[0]))))
+	case opI32Load8U, opI64Load8U:
+		value = uint64(mem[0])
+	case opI32Load16S:
+		value = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(mem)))))
+	case opI32Load16U, opI64Load16U:
+		value = uint64(binary.LittleEndian.Uint16(mem))
+	case opI64Load8S:
+		value = uint64(int64(int8(mem[0])))
+	case opI64Load16S:
+		value = uint64(int64(int16(binary.LittleEndian.Uint16(mem))))
+	case opI64Load32S:
+		value = uint64(int64(int32(binary.LittleEndian.Uint32(mem))))
+	}
+	vm.push(value)
+	return nil
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (vm *VM) numericOp(op byte) error {
+	switch op {
+	case opI32Eqz:
+		vm.stack[vm.sp-1] = b2u(uint32(vm.stack[vm.sp-1]) == 0)
+		return nil
+	case opI64Eqz:
+		vm.stack[vm.sp-1] = b2u(vm.stack[vm.sp-1] == 0)
+		return nil
+	case opI32Clz:
+		vm.stack[vm.sp-1] = uint64(bits.LeadingZeros32(uint32(vm.stack[vm.sp-1])))
+		return nil
+	case opI32Ctz:
+		vm.stack[vm.sp-1] = uint64(bits.TrailingZeros32(uint32(vm.stack[vm.sp-1])))
+		return nil
+	case opI32Popcnt:
+		vm.stack[vm.sp-1] = uint64(bits.OnesCount32(uint32(vm.stack[vm.sp-1])))
+		return nil
+	case opI64Clz:
+		vm.stack[vm.sp-1] = uint64(bits.LeadingZeros64(vm.stack[vm.sp-1]))
+		return nil
+	case opI64Ctz:
+		vm.stack[vm.sp-1] = uint64(bits.TrailingZeros64(vm.stack[vm.sp-1]))
+		return nil
+	case opI64Popcnt:
+		vm.stack[vm.sp-1] = uint64(bits.OnesCount64(vm.stack[vm.sp-1]))
+		return nil
+	case opI32WrapI64:
+		vm.stack[vm.sp-1] = uint64(uint32(vm.stack[vm.sp-1]))
+		return nil
+	case opI64ExtendI32S:
+		vm.stack[vm.sp-1] = uint64(int64(int32(vm.stack[vm.sp-1])))
+		return nil
+	case opI64ExtendI32U:
+		vm.stack[vm.sp-1] = uint64(uint32(vm.stack[vm.sp-1]))
+		return nil
+	case opI32Extend8S:
+		vm.stack[vm.sp-1] = uint64(uint32(int32(int8(vm.stack[vm.sp-1]))))
+		return nil
+	case opI32Extend16S:
+		vm.stack[vm.sp-1] = uint64(uint32(int32(int16(vm.stack[vm.sp-1]))))
+		return nil
+	case opI64Extend8S:
+		vm.stack[vm.sp-1] = uint64(int64(int8(vm.stack[vm.sp-1])))
+		return nil
+	case opI64Extend16S:
+		vm.stack[vm.sp-1] = uint64(int64(int16(vm.stack[vm.sp-1])))
+		return nil
+	case opI64Extend32S:
+		vm.stack[vm.sp-1] = uint64(int64(int32(vm.stack[vm.sp-1])))
+		return nil
+	}
+
+	y := vm.pop()
+	x := vm.pop()
+	var res uint64
+	if op >= opI32Eq && op <= opI32GeU || op >= opI32Add && op <= opI32Rotr {
+		r, err := i32BinOp(op, uint32(x), uint32(y))
+		if err != nil {
+			return err
+		}
+		res = r
+	} else {
+		r, err := i64BinOp(op, x, y)
+		if err != nil {
+			return err
+		}
+		res = r
+	}
+	vm.push(res)
+	return nil
+}
+
+func i32BinOp(op byte, x, y uint32) (uint64, error) {
+	switch op {
+	case opI32Eq:
+		return b2u(x == y), nil
+	case opI32Ne:
+		return b2u(x != y), nil
+	case opI32LtS:
+		return b2u(int32(x) < int32(y)), nil
+	case opI32LtU:
+		return b2u(x < y), nil
+	case opI32GtS:
+		return b2u(int32(x) > int32(y)), nil
+	case opI32GtU:
+		return b2u(x > y), nil
+	case opI32LeS:
+		return b2u(int32(x) <= int32(y)), nil
+	case opI32LeU:
+		return b2u(x <= y), nil
+	case opI32GeS:
+		return b2u(int32(x) >= int32(y)), nil
+	case opI32GeU:
+		return b2u(x >= y), nil
+	case opI32Add:
+		return uint64(x + y), nil
+	case opI32Sub:
+		return uint64(x - y), nil
+	case opI32Mul:
+		return uint64(x * y), nil
+	case opI32DivS:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		if int32(x) == math.MinInt32 && int32(y) == -1 {
+			return 0, ErrIntegerOverflow
+		}
+		return uint64(uint32(int32(x) / int32(y))), nil
+	case opI32DivU:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		return uint64(x / y), nil
+	case opI32RemS:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		if int32(y) == -1 {
+			return 0, nil
+		}
+		return uint64(uint32(int32(x) % int32(y))), nil
+	case opI32RemU:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		return uint64(x % y), nil
+	case opI32And:
+		return uint64(x & y), nil
+	case opI32Or:
+		return uint64(x | y), nil
+	case opI32Xor:
+		return uint64(x ^ y), nil
+	case opI32Shl:
+		return uint64(x << (y & 31)), nil
+	case opI32ShrS:
+		return uint64(uint32(int32(x) >> (y & 31))), nil
+	case opI32ShrU:
+		return uint64(x >> (y & 31)), nil
+	case opI32Rotl:
+		return uint64(bits.RotateLeft32(x, int(y&31))), nil
+	case opI32Rotr:
+		return uint64(bits.RotateLeft32(x, -int(y&31))), nil
+	}
+	return 0, fmt.Errorf("wasm: invalid opcode 0x%x", op)
+}
+
+func i64BinOp(op byte, x, y uint64) (uint64, error) {
+	switch op {
+	case opI64Eq:
+		return b2u(x == y), nil
+	case opI64Ne:
+		return b2u(x != y), nil
+	case opI64LtS:
+		return b2u(int64(x) < int64(y)), nil
+	case opI64LtU:
+		return b2u(x < y), nil
+	case opI64GtS:
+		return b2u(int64(x) > int64(y)), nil
+	case opI64GtU:
+		return b2u(x > y), nil
+	case opI64LeS:
+		return b2u(int64(x) <= int64(y)), nil
+	case opI64LeU:
+		return b2u(x <= y), nil
+	case opI64GeS:
+		return b2u(int64(x) >= int64(y)), nil
+	case opI64GeU:
+		return b2u(x >= y), nil
+	case opI64Add:
+		return x + y, nil
+	case opI64Sub:
+		return x - y, nil
+	case opI64Mul:
+		return x * y, nil
+	case opI64DivS:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		if int64(x) == math.MinInt64 && int64(y) == -1 {
+			return 0, ErrIntegerOverflow
+		}
+		return uint64(int64(x) / int64(y)), nil
+	case opI64DivU:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		return x / y, nil
+	case opI64RemS:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		if int64(y) == -1 {
+			return 0, nil
+		}
+		return uint64(int64(x) % int64(y)), nil
+	case opI64RemU:
+		if y == 0 {
+			return 0, ErrIntegerDivideByZero
+		}
+		return x % y, nil
+	case opI64And:
+		return x & y, nil
+	case opI64Or:
+		return x | y, nil
+	case opI64Xor:
+		return x ^ y, nil
+	case opI64Shl:
+		return x << (y & 63), nil
+	case opI64ShrS:
+		return uint64(int64(x) >> (y & 63)), nil
+	case opI64ShrU:
+		return x >> (y & 63), nil
+	case opI64Rotl:
+		return bits.RotateLeft64(x, int(y&63)), nil
+	case opI64Rotr:
+		return bits.RotateLeft64(x, -int(y&63)), nil
+	}
+	return 0, fmt.Errorf("wasm: invalid opcode 0x%x", op)
+}
@@ -0,0 +1,332 @@
+package wasm
+
+import (
+	"errors"
+	"testing"
+)
+
+func instantiate(t *testing.T, b *moduleBuilder, resolve ImportResolver, cfg Config) *VM {
+	t.Helper()
+	m, err := DecodeModule(b.bytes())
+	if err != nil {
+		t.Fatalf("failed to decode module: %v", err)
+	}
+	cm, err := Compile(m, nil)
+	if err != nil {
+		t.Fatalf("failed to compile module: %v", err)
+	}
+	vm, err := NewVM(cm, resolve, cfg)
+	if err != nil {
+		t.Fatalf("failed to instantiate module: %v", err)
+	}
+	return vm
+}
+
+func i32c(v int32) []byte {
+	return append([]byte{opI32Const}, sleb(int64(v))...)
+}
+
+func i64c(v int64) []byte {
+	return append([]byte{opI64Const}, sleb(v)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestFactorialLoop(t *testing.T) {
+	b := new(moduleBuilder)
+	typ := b.typ([]ValueType{i64}, []ValueType{i64})
+	// acc = 1; loop { if n == 0 break; acc *= n; n-- }
+	b.function(typ, []ValueType{i64}, concat(
+		i64c(1), []byte{opLocalSet, 1},
+		[]byte{opBlock, 0x40, opLoop, 0x40},
+		[]byte{opLocalGet, 0, opI64Eqz, opBrIf, 1},
+		[]byte{opLocalGet, 1, opLocalGet, 0, opI64Mul, opLocalSet, 1},
+		[]byte{opLocalGet, 0}, i64c(1), []byte{opI64Sub, opLocalSet, 0},
+		[]byte{opBr, 0, opEnd, opEnd},
+		[]byte{opLocalGet, 1},
+	)...)
+	vm := instantiate(t, b, nil, Config{})
+	for n, want := range map[uint64]uint64{0: 1, 1: 1, 5: 120, 20: 2432902008176640000} {
+		if got, err := vm.Invoke(0, n); err != nil || got != want {
+			t.Errorf("fac(%d): have (%d, %v), want %d", n, got, err, want)
+		}
+	}
+}
+
+func TestRecursion(t *testing.T) {
+	b := new(moduleBuilder)
+	typ := b.typ([]ValueType{i32}, []ValueType{i32})
+	// fib(n) = n < 2 ? n : fib(n-1) + fib(n-2)
+	b.function(typ, nil, concat(
+		[]byte{opLocalGet, 0}, i32c(2), []byte{opI32LtU},
+		[]byte{opIf, byte(i32), opLocalGet, 0, opElse},
+		[]byte{opLocalGet, 0}, i32c(1), []byte{opI32Sub, opCall, 0},
+		[]byte{opLocalGet, 0}, i32c(2), []byte{opI32Sub, opCall, 0},
+		[]byte{opI32Add, opEnd},
+	)...)
+	vm := instantiate(t, b, nil, Config{})
+	if got, err := vm.Invoke(0, 15); err != nil || got != 610 {
+		t.Errorf("fib(15): have (%d, %v), want 610", got, err)
+	}
+
+	// Unbounded recursion must hit the depth limit instead of the Go stack.
+	b = new(moduleBuilder)
+	b.function(b.typ(nil, nil), nil, opCall, 0)
+	vm = instantiate(t, b, nil, Config{MaxCallDepth: 100})
+	if _, err := vm.Invoke(0); err != ErrCallStackExhausted {
+		t.Errorf("have %v, want %v", err, ErrCallStackExhausted)
+	}
+}
+
+func TestBrTable(t *testing.T) {
+	b := new(moduleBuilder)
+	typ := b.typ([]ValueType{i32}, []ValueType{i32})
+	// Values carried through br_table must survive the stack unwinding.
+	b.function(typ, nil, concat(
+		[]byte{opBlock, byte(i32), opBlock, byte(i32), opBlock, byte(i32)},
+		i32c(99), i32c(10), []byte{opLocalGet, 0, opBrTable, 2, 0, 1, 2},
+		[]byte{opEnd}, i32c(1), []byte{opI32Add, opReturn},
+		[]byte{opEnd}, i32c(2), []byte{opI32Add, opReturn},
+		[]byte{opEnd},
+	)...)
+	vm := instantiate(t, b, nil, Config{})
+	for in, want := range map[uint64]uint64{0: 11, 1: 12, 2: 10, 100: 10} {
+		if got, err := vm.Invoke(0, in); err != nil || got != want {
+			t.Errorf("br_table(%d): have (%d, %v), want %d", in, got, err, want)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	b := new(moduleBuilder)
+	b.memory = []byte{1, 1, 2}
+	b.data = append(b.data, concat([]byte{0}, i32c(16), []byte{opEnd}, name("\xff\xfe"))) // 0xfeff at 16
+	typ := b.typ([]ValueType{i32}, []ValueType{i64})
+	b.function(typ, nil, concat(
+		[]byte{opLocalGet, 0}, i64c(-2), []byte{opI64Store, 3, 0},
+		[]byte{opLocalGet, 0, opI64Load32U, 2, 0},
+	)...)
+	b.function(b.typ(nil, []ValueType{i32}), nil, concat(
+		i32c(16), []byte{opI32Load16S, 1, 0},
+	)...)
+	b.function(b.typ([]ValueType{i32}, []ValueType{i32}), nil, opLocalGet, 0, opMemoryGrow, 0)
+	b.function(b.typ(nil, []ValueType{i32}), nil, opMemorySize, 0)
+
+	var gas uint64
+	vm := instantiate(t, b, nil, Config{
+		Meter:         func(g uint64) error { gas += g; return nil },
+		MemoryPageGas: 1000,
+	})
+	if gas != 1000 {
+		t.Errorf("initial memory: have %d gas, want 1000", gas)
+	}
+	if got, err := vm.Invoke(0, 8); err != nil || got != 0xfffffffe {
+		t.Errorf("have (%x, %v), want 0xfffffffe", got, err)
+	}
+	if _, err := vm.Invoke(0, PageSize-4); err != ErrMemoryOutOfBounds {
+		t.Errorf("have %v, want %v", err, ErrMemoryOutOfBounds)
+	}
+	if got, err := vm.Invoke(1); err != nil || got != 0xfffffeff {
+		t.Errorf("have (%x, %v), want 0xfffffeff", got, err)
+	}
+	gas = 0
+	if got, err := vm.Invoke(2, 1); err != nil || got != 1 {
+		t.Errorf("grow: have (%d, %v), want 1", got, err)
+	}
+	if gas < 1000 {
+		t.Errorf("memory growth not charged, gas %d", gas)
+	}
+	if got, err := vm.Invoke(2, 1); err != nil || got != 0xffffffff {
+		t.Errorf("grow beyond maximum: have (%d, %v), want -1", got, err)
+	}
+	if got, _ := vm.Invoke(3); got != 2 {
+		t.Errorf("memory size: have %d, want 2", got)
+	}
+}
+
+func TestMemoryLimits(t *testing.T) {
+	b := new(moduleBuilder)
+	b.memory = []byte{0, 3}
+	m, err := DecodeModule(b.bytes())
+	if err != nil {
+		t.Fatalf("failed to decode module: %v", err)
+	}
+	cm, err := Compile(m, nil)
+	if err != nil {
+		t.Fatalf("failed to compile module: %v", err)
+	}
+	// The initial memory is charged before being allocated.
+	errOutOfGas := errors.New("out of gas")
+	meter := func(g uint64) error {
+		if g > 2000 {
+			return errOutOfGas
+		}
+		return nil
+	}
+	if _, err := NewVM(cm, nil, Config{Meter: meter, MemoryPageGas: 1000}); err != errOutOfGas {
+		t.Errorf("have %v, want %v", err, errOutOfGas)
+	}
+	if _, err := NewVM(cm, nil, Config{MaxMemoryPages: 2}); err == nil {
+		t.Errorf("memory above the maximum accepted")
+	}
+	if _, err := NewVM(cm, nil, Config{MaxMemoryPages: 3}); err != nil {
+		t.Errorf("failed to instantiate module: %v", err)
+	}
+
+	b = new(moduleBuilder)
+	b.table = append([]byte{0}, uleb(maxTableSize+1)...)
+	if m, err = DecodeModule(b.bytes()); err != nil {
+		t.Fatalf("failed to decode module: %v", err)
+	}
+	if _, err := Compile(m, nil); err == nil {
+		t.Errorf("table above the maximum size accepted")
+	}
+}
+
+func TestTraps(t *testing.T) {
+	tests := []struct {
+		body []byte
+		want error
+	}{
+		{[]byte{opUnreachable}, ErrUnreachable},
+		{concat(i32c(1), i32c(0), []byte{opI32DivU, opDrop}), ErrIntegerDivideByZero},
+		{concat(i32c(-1<<31), i32c(-1), []byte{opI32DivS, opDrop}), ErrIntegerOverflow},
+		{concat(i64c(7), i64c(0), []byte{opI64RemS, opDrop}), ErrIntegerDivideByZero},
+		{concat(i32c(1), []byte{opCallIndirect, 0, 0}), ErrUndefinedElement},
+		{concat(i32c(0), []byte{opCallIndirect, 1, 0, opDrop}), ErrIndirectCallTypeMismatch},
+	}
+	for i, test := range tests {
+		b := new(moduleBuilder)
+		b.typ(nil, nil)
+		b.typ(nil, []ValueType{i32})
+		b.table = []byte{0, 2}
+		b.elems = append(b.elems, concat([]byte{0}, i32c(0), []byte{opEnd, 1, 0}))
+		b.function(0, nil, test.body...)
+		vm := instantiate(t, b, nil, Config{})
+		if _, err := vm.Invoke(0); err != test.want {
+			t.Errorf("test %d: have %v, want %v", i, err, test.want)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	tests := map[string][]byte{
+		"underflow":      {opI32Add},
+		"type mismatch":  concat(i32c(1), i64c(1), []byte{opI32Add, opDrop}),
+		"float":          {opF32Const, 0, 0, 0, 0, opDrop},
+		"bad local":      {opLocalGet, 3, opDrop},
+		"bad branch":     {opBr, 1},
+		"leftover value": i32c(1),
+		"if result":      concat(i32c(1), []byte{opIf, byte(i32)}, i32c(1), []byte{opEnd, opDrop}),
+		"no memory":      concat(i32c(0), []byte{opI32Load, 2, 0, opDrop}),
+		"missing end":    {opBlock, 0x40},
+	}
+	for name, body := range tests {
+		b := new(moduleBuilder)
+		b.function(b.typ(nil, nil), nil, body...)
+		m, err := DecodeModule(b.bytes())
+		if err != nil {
+			t.Fatalf("%s: failed to decode module: %v", name, err)
+		}
+		if _, err := Compile(m, nil); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	// Code after an unconditional branch is validated against a polymorphic stack.
+	b := new(moduleBuilder)
+	b.function(b.typ(nil, []ValueType{i32}), nil, concat(
+		[]byte{opBlock, byte(i32), opUnreachable, opI32Add, opEnd},
+	)...)
+	m, _ := DecodeModule(b.bytes())
+	if _, err := Compile(m, nil); err != nil {
+		t.Errorf("unreachable code rejected: %v", err)
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	errAbort := errors.New("abort")
+
+	b := new(moduleBuilder)
+	typ := b.typ([]ValueType{i32, i64}, []ValueType{i64})
+	b.importFunc("env", "add", typ)
+	b.importFunc("env", "abort", b.typ(nil, nil))
+	b.function(b.typ(nil, []ValueType{i64}), nil, concat(i32c(2), i64c(40), []byte{opCall, 0})...)
+	b.function(b.typ(nil, nil), nil, opCall, 1)
+
+	resolve := func(module, field string) (*HostFunction, error) {
+		switch field {
+		case "add":
+			return &HostFunction{
+				Sig: FunctionSig{Params: []ValueType{i32, i64}, Results: []ValueType{i64}},
+				Call: func(vm *VM, args []uint64) (uint64, error) {
+					return args[0] + args[1], nil
+				},
+			}, nil
+		case "abort":
+			return &HostFunction{Call: func(vm *VM, args []uint64) (uint64, error) {
+				return 0, errAbort
+			}}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	vm := instantiate(t, b, resolve, Config{})
+	if got, err := vm.Invoke(2); err != nil || got != 42 {
+		t.Errorf("have (%d, %v), want 42", got, err)
+	}
+	if _, err := vm.Invoke(3); err != errAbort {
+		t.Errorf("have %v, want %v", err, errAbort)
+	}
+
+	m, _ := DecodeModule(b.bytes())
+	cm, _ := Compile(m, nil)
+	mismatch := func(module, field string) (*HostFunction, error) {
+		return &HostFunction{}, nil
+	}
+	if _, err := NewVM(cm, mismatch, Config{}); err == nil {
+		t.Error("expected signature mismatch")
+	}
+}
+
+func TestMetering(t *testing.T) {
+	b := new(moduleBuilder)
+	// Count down from the argument; every iteration executes the loop block.
+	b.function(b.typ([]ValueType{i32}, nil), nil, concat(
+		[]byte{opLoop, 0x40},
+		[]byte{opLocalGet, 0}, i32c(1), []byte{opI32Sub, opLocalTee, 0, opBrIf, 0},
+		[]byte{opEnd},
+	)...)
+
+	run := func(n uint64) uint64 {
+		var gas uint64
+		vm := instantiate(t, b, nil, Config{Meter: func(g uint64) error { gas += g; return nil }})
+		if _, err := vm.Invoke(0, n); err != nil {
+			t.Fatalf("execution failed: %v", err)
+		}
+		return gas
+	}
+	one, ten := run(1), run(10)
+	// Each iteration costs local.get, i32.const, i32.sub, local.tee and br_if.
+	if ten-one != 9*5 {
+		t.Errorf("have %d gas per 9 iterations, want %d", ten-one, 9*5)
+	}
+
+	errOutOfGas := errors.New("out of gas")
+	var left uint64 = 20
+	vm := instantiate(t, b, nil, Config{Meter: func(g uint64) error {
+		if g > left {
+			return errOutOfGas
+		}
+		left -= g
+		return nil
+	}})
+	if _, err := vm.Invoke(0, 1000); err != errOutOfGas {
+		t.Errorf("have %v, want %v", err, errOutOfGas)
+	}
+}